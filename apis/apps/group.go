@@ -167,6 +167,7 @@ const (
 
 // PackageManagers
 const (
+	HELM      = "helm"
 	KSONNET   = "ksonnet"
 	KUSTOMIZE = "kustomize"
 )
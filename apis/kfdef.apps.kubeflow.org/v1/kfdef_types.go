@@ -39,6 +39,8 @@ type KfDefSpec struct {
 	Plugins      []Plugin      `json:"plugins,omitempty"`
 	Secrets      []Secret      `json:"secrets,omitempty"`
 	Repos        []Repo        `json:"repos,omitempty"`
+	// Placement is applied to the pod templates of the workloads rendered for every application.
+	Placement *Placement `json:"placement,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -66,12 +68,84 @@ type KfDefList struct {
 type Application struct {
 	Name            string           `json:"name,omitempty"`
 	KustomizeConfig *KustomizeConfig `json:"kustomizeConfig,omitempty"`
+	// HelmConfig renders the application from a Helm chart instead of a kustomize package.
+	// Chart hooks aren't run; the resources annotated with helm.sh/hook are left out.
+	HelmConfig *HelmConfig `json:"helmConfig,omitempty"`
+	// Placement overrides the KfDef level placement for the workloads of this application.
+	Placement *Placement `json:"placement,omitempty"`
+	// Resources overrides the requests and limits of the rendered containers. Keys are either
+	// a container name or a workload name; a workload name applies to all of its containers.
+	Resources map[string]v1.ResourceRequirements `json:"resources,omitempty"`
+	// Outputs are values read from the objects of the application once applied, which other
+	// applications use in their params as ${output:application.name}.
+	Outputs []ApplicationOutput `json:"outputs,omitempty"`
+}
+
+// ApplicationOutput is a field of an object of an application, e.g. the host of its Route.
+type ApplicationOutput struct {
+	Name       string `json:"name"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	ObjectName string `json:"objectName"`
+	// Namespace of the object, the namespace of the KfDef by default. Empty for cluster scoped objects.
+	Namespace string `json:"namespace,omitempty"`
+	// FieldPath is a JSONPath expression selecting the value in the object, e.g. {.spec.host}.
+	FieldPath string `json:"fieldPath"`
 }
 
 type KustomizeConfig struct {
 	RepoRef    *RepoRef    `json:"repoRef,omitempty"`
 	Overlays   []string    `json:"overlays,omitempty"`
 	Parameters []NameValue `json:"parameters,omitempty"`
+	// Include lists glob patterns selecting the manifests of a RepoRef.Path that is a plain directory
+	// of YAML without a kustomization.yaml. Patterns without a slash match file names, the others match
+	// paths relative to RepoRef.Path. All .yaml, .yml and .json files are read when empty.
+	Include []string `json:"include,omitempty"`
+	// PatchesStrategicMerge are inline strategic merge patches applied to the resources of the application.
+	PatchesStrategicMerge []string `json:"patchesStrategicMerge,omitempty"`
+	// PatchesJson6902 are inline JSON patches applied to the resource selected by their target.
+	PatchesJson6902 []PatchJson6902 `json:"patchesJson6902,omitempty"`
+	// ConditionalOverlays are applied after the Overlays, in order, when the cluster matches their conditions.
+	ConditionalOverlays []ConditionalOverlay `json:"conditionalOverlays,omitempty"`
+}
+
+// ConditionalOverlay is an overlay applied only when the cluster matches all its conditions.
+type ConditionalOverlay struct {
+	Name string `json:"name"`
+	// WhenAPIGroupPresent is an API group the cluster must serve, e.g. networking.istio.io.
+	WhenAPIGroupPresent string `json:"whenAPIGroupPresent,omitempty"`
+	// WhenPlatform is the platform of the cluster: OpenShift or Kubernetes.
+	WhenPlatform string `json:"whenPlatform,omitempty"`
+	// WhenClusterVersion is a constraint on the version of the cluster, the OpenShift version on
+	// OpenShift, e.g. ">=4.10". The operator is one of >=, >, <=, < or ==, >= if omitted.
+	WhenClusterVersion string `json:"whenClusterVersion,omitempty"`
+}
+
+// HelmConfig describes a Helm chart and the values it is rendered with.
+type HelmConfig struct {
+	// RepoRef points at a chart directory or a packaged chart (.tgz) inside a repo.
+	RepoRef *RepoRef `json:"repoRef,omitempty"`
+	// ReleaseName is the release name the chart is rendered with. Defaults to the application name.
+	ReleaseName string `json:"releaseName,omitempty"`
+	// Namespace the chart is rendered into. Defaults to the KfDef namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// Values override the defaults of the chart and the values read from ValuesFrom.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Values *runtime.RawExtension `json:"values,omitempty"`
+	// ValuesFrom lists values files held in ConfigMaps or Secrets, merged in order.
+	ValuesFrom []ValuesReference `json:"valuesFrom,omitempty"`
+}
+
+// ValuesReference refers to a key of a ConfigMap or Secret in the KfDef namespace holding a Helm values file.
+type ValuesReference struct {
+	// Kind is either ConfigMap or Secret.
+	Kind string `json:"kind"`
+	// Name of the ConfigMap or Secret.
+	Name string `json:"name"`
+	// Key holding the values file. Defaults to values.yaml.
+	Key string `json:"key,omitempty"`
+	// Optional allows the ConfigMap, Secret or key to be missing.
+	Optional bool `json:"optional,omitempty"`
 }
 
 type RepoRef struct {
@@ -84,6 +158,36 @@ type NameValue struct {
 	Value string `json:"value,omitempty"`
 }
 
+// PatchJson6902 is an inline RFC 6902 JSON patch, written in JSON or YAML.
+type PatchJson6902 struct {
+	// Target selects the resource the patch is applied to.
+	Target *PatchTarget `json:"target"`
+	// Patch is the list of patch operations.
+	Patch string `json:"patch"`
+}
+
+// PatchTarget selects a resource by its group, version, kind, name and namespace.
+type PatchTarget struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Placement controls where the pods of the rendered Deployments, StatefulSets, DaemonSets,
+// DeploymentConfigs and Jobs are scheduled.
+type Placement struct {
+	// NodeSelector is merged into the nodeSelector of every pod template.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations are appended to the tolerations of every pod template.
+	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
+	// Affinity replaces the affinity of every pod template.
+	Affinity *v1.Affinity `json:"affinity,omitempty"`
+	// PriorityClassName replaces the priorityClassName of every pod template.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+}
+
 // Plugin can be used to customize the generation and deployment of Kubeflow
 type Plugin struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -127,6 +231,58 @@ type Repo struct {
 	// Can use any URI understood by go-getter:
 	// https://github.com/hashicorp/go-getter/blob/master/README.md#installation-and-usage
 	URI string `json:"uri,omitempty"`
+	// PullSecret is the name of a Secret of type kubernetes.io/dockerconfigjson in the KfDef
+	// namespace holding the registry credentials used to pull oci:// URIs.
+	PullSecret string `json:"pullSecret,omitempty"`
+	// AuthSecret is the name of a Secret in the KfDef namespace holding the credentials used
+	// to fetch the repo. git:: URIs accept a kubernetes.io/basic-auth or a kubernetes.io/ssh-auth
+	// Secret. http(s) archives accept a kubernetes.io/basic-auth Secret, a Secret with a bearer
+	// token under the token key and, alone or with either of them, a client certificate under
+	// the tls.crt and tls.key keys of a kubernetes.io/tls Secret.
+	AuthSecret string `json:"authSecret,omitempty"`
+	// CABundle refers to the key of a ConfigMap or Secret in the KfDef namespace holding PEM
+	// encoded certificates trusted, in addition to the system ones, by https archive downloads.
+	CABundle *KeyReference `json:"caBundle,omitempty"`
+	// SHA256 is the expected hex encoded sha256 digest of the repo archive. The archive is
+	// verified before it is unpacked. Only archives can be verified: git::, oci:// and directory
+	// repos with a sha256 or a signature are rejected.
+	SHA256 string `json:"sha256,omitempty"`
+	// Signature is a detached signature of the repo archive verified before it is unpacked.
+	Signature *RepoSignature `json:"signature,omitempty"`
+	// Update periodically checks a repo pointing to a mutable ref, i.e. a git branch or tag,
+	// an OCI tag or an http(s) archive without a sha256, for new versions.
+	Update *RepoUpdatePolicy `json:"update,omitempty"`
+}
+
+// RepoUpdatePolicy controls how new versions of a repo are detected and applied.
+type RepoUpdatePolicy struct {
+	// Interval between two checks. Defaults to 1h.
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Auto applies a new version as soon as it's found. Otherwise the repo is kept at its cached
+	// version, which the UpdateAvailable condition reports with the new one, until the repo
+	// changes in the spec or the operator restarts.
+	Auto bool `json:"auto,omitempty"`
+}
+
+// RepoSignature is a detached signature of a repo archive.
+type RepoSignature struct {
+	// URI where the signature can be obtained, e.g. the output of cosign sign-blob or a .minisig file.
+	URI string `json:"uri"`
+	// Format is either cosign or minisign. Defaults to cosign.
+	Format string `json:"format,omitempty"`
+	// PublicKey refers to the key of a Secret or ConfigMap in the KfDef namespace holding the
+	// public key, PEM encoded for cosign.
+	PublicKey KeyReference `json:"publicKey"`
+}
+
+// KeyReference refers to a key of a ConfigMap or Secret in the KfDef namespace.
+type KeyReference struct {
+	// Kind is either ConfigMap or Secret.
+	Kind string `json:"kind"`
+	// Name of the ConfigMap or Secret.
+	Name string `json:"name"`
+	// Key holding the value.
+	Key string `json:"key"`
 }
 
 // KfDefStatus defines the observed state of KfDef
@@ -134,11 +290,56 @@ type KfDefStatus struct {
 	Conditions []KfDefCondition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 	// ReposCache is used to cache information about local caching of the URIs.
 	ReposCache []RepoCache `json:"reposCache,omitempty"`
+	// ClusterFacts are the facts about the cluster the applications were rendered with.
+	ClusterFacts *ClusterFacts `json:"clusterFacts,omitempty"`
+	// Overlays are the overlays applied to the applications, conditional overlays included.
+	Overlays []ApplicationOverlays `json:"overlays,omitempty"`
+	// Outputs are the outputs of the applications read after they were applied.
+	Outputs []ApplicationOutputs `json:"outputs,omitempty"`
 }
 
 type RepoCache struct {
 	Name      string `json:"name,omitempty"`
 	LocalPath string `json:"localPath,string"`
+	// Revision is the commit SHA the repo resolved to for git repos, the manifest digest for
+	// oci repos, or the ETag, else the Last-Modified date, of http(s) archives.
+	Revision string `json:"revision,omitempty"`
+}
+
+// ApplicationOverlays are the overlays applied to an application.
+type ApplicationOverlays struct {
+	Name     string   `json:"name"`
+	Overlays []string `json:"overlays,omitempty"`
+}
+
+// ApplicationOutputs are the values of the outputs of an application.
+type ApplicationOutputs struct {
+	Name   string      `json:"name"`
+	Values []NameValue `json:"values,omitempty"`
+}
+
+// ClusterFacts are facts about the cluster discovered by the operator, usable as render params.
+type ClusterFacts struct {
+	// Platform is OpenShift or Kubernetes.
+	Platform string `json:"platform,omitempty"`
+	// Version is the OpenShift version on OpenShift, else the Kubernetes version.
+	Version           string `json:"version,omitempty"`
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// IngressDomain is the domain of the routes of the cluster on OpenShift.
+	IngressDomain string `json:"ingressDomain,omitempty"`
+	// APIGroups are the API groups served by the cluster.
+	APIGroups []string `json:"apiGroups,omitempty"`
+	// APIVersions are the group versions served by the cluster, e.g. apps/v1.
+	APIVersions         []string `json:"apiVersions,omitempty"`
+	DefaultStorageClass string   `json:"defaultStorageClass,omitempty"`
+	// Proxy is the cluster wide proxy configuration on OpenShift, if any.
+	Proxy *ClusterProxy `json:"proxy,omitempty"`
+}
+
+type ClusterProxy struct {
+	HTTPProxy  string `json:"httpProxy,omitempty"`
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	NoProxy    string `json:"noProxy,omitempty"`
 }
 
 type KfDefConditionType string
@@ -152,6 +353,19 @@ const (
 
 	// Pending means Kubeflow services is being updated.
 	Pending KfDefConditionType = "Pending"
+
+	// KfRepoVerificationFailed means a repo archive did not match its sha256 or signature.
+	KfRepoVerificationFailed KfDefConditionType = "RepoVerificationFailed"
+
+	// KfUpdateAvailable means a repo pointing to a mutable ref has a new version upstream.
+	KfUpdateAvailable KfDefConditionType = "UpdateAvailable"
+
+	// KfInvalidParameters means the parameters of an application don't match its params.schema.yaml.
+	KfInvalidParameters KfDefConditionType = "InvalidParameters"
+
+	// KfDeploymentConfigMigrationPending means DeploymentConfigs are kept until the Deployments
+	// converted from them are available.
+	KfDeploymentConfigMigrationPending KfDefConditionType = "DeploymentConfigMigrationPending"
 )
 
 type KfDefCondition struct {
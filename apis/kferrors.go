@@ -35,6 +35,8 @@ type KfError struct {
 	// Code is the HTTP response status code.
 	Code    int    `json:"code"`
 	Message string `json:"message,omitempty"`
+	// Err is the error this one wraps, if any, for errors.As.
+	Err error `json:"-"`
 }
 
 func (e *KfError) Error() string {
@@ -42,6 +44,10 @@ func (e *KfError) Error() string {
 		e.Code, e.Message)
 }
 
+func (e *KfError) Unwrap() error {
+	return e.Err
+}
+
 func IsNotFound(e error) bool {
 	kfError, ok := e.(*KfError)
 	return ok && kfError.Code == int(NOT_FOUND)
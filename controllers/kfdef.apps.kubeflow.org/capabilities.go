@@ -0,0 +1,126 @@
+package kfdefappskubefloworg
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+)
+
+// The optional capabilities of the operator, which need OpenShift APIs.
+const (
+	CapabilityDeploymentConfigs = "DeploymentConfigs"
+	CapabilityImageStreams      = "ImageStreams"
+	CapabilityBuildConfigs      = "BuildConfigs"
+	CapabilityRoutes            = "Routes"
+	CapabilityOAuthClients      = "OAuthClients"
+
+	// capabilitiesConfigMap, in the namespace of the operator, lists the enabled and disabled capabilities.
+	capabilitiesConfigMap = "opendatahub-operator-capabilities"
+)
+
+// capabilityAPIs are the group versions and kinds each capability needs.
+var capabilityAPIs = map[string]struct {
+	groupVersion string
+	kind         string
+}{
+	CapabilityDeploymentConfigs: {"apps.openshift.io/v1", "DeploymentConfig"},
+	CapabilityImageStreams:      {"image.openshift.io/v1", "ImageStream"},
+	CapabilityBuildConfigs:      {"build.openshift.io/v1", "BuildConfig"},
+	CapabilityRoutes:            {"route.openshift.io/v1", "Route"},
+	CapabilityOAuthClients:      {"oauth.openshift.io/v1", "OAuthClient"},
+}
+
+// Capabilities are the optional capabilities of the operator the cluster supports. A nil
+// Capabilities has every capability enabled.
+type Capabilities struct {
+	enabled map[string]bool
+}
+
+// DetectCapabilities returns the capabilities whose APIs the cluster serves. A capability whose
+// group version can't be discovered is disabled, and the error logged to log.
+func DetectCapabilities(d discovery.DiscoveryInterface, log logr.Logger) (*Capabilities, error) {
+	apis, err := kfconfig.DiscoverAPIs(d)
+	if err != nil {
+		return nil, err
+	}
+	c := &Capabilities{enabled: map[string]bool{}}
+	served := map[string]map[string]bool{}
+	for name, api := range capabilityAPIs {
+		if !apis.HasAPIVersion(api.groupVersion) {
+			continue
+		}
+		kinds, ok := served[api.groupVersion]
+		if !ok {
+			kinds = map[string]bool{}
+			resources, err := d.ServerResourcesForGroupVersion(api.groupVersion)
+			if err != nil {
+				log.Error(err, "failed to discover the resources of a group version; capabilities needing it are disabled",
+					"groupVersion", api.groupVersion)
+			} else {
+				for _, r := range resources.APIResources {
+					kinds[r.Kind] = true
+				}
+			}
+			served[api.groupVersion] = kinds
+		}
+		c.enabled[name] = kinds[api.kind]
+	}
+	return c, nil
+}
+
+// Has returns true if the capability name is enabled.
+func (c *Capabilities) Has(name string) bool {
+	return c == nil || c.enabled[name]
+}
+
+// Enabled returns the names of the enabled capabilities.
+func (c *Capabilities) Enabled() []string {
+	return c.list(true)
+}
+
+// Disabled returns the names of the capabilities disabled because the cluster lacks their APIs.
+func (c *Capabilities) Disabled() []string {
+	return c.list(false)
+}
+
+func (c *Capabilities) list(enabled bool) []string {
+	names := []string{}
+	for name := range capabilityAPIs {
+		if c.Has(name) == enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Publish lists the enabled and disabled capabilities in a ConfigMap in namespace.
+func (c *Capabilities) Publish(ctx context.Context, cli client.Client, namespace string) error {
+	data := map[string]string{
+		"enabled":  strings.Join(c.Enabled(), ","),
+		"disabled": strings.Join(c.Disabled(), ","),
+	}
+	cm := &v1.ConfigMap{}
+	err := cli.Get(ctx, types.NamespacedName{Namespace: namespace, Name: capabilitiesConfigMap}, cm)
+	if errors.IsNotFound(err) {
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: capabilitiesConfigMap, Namespace: namespace},
+			Data:       data,
+		}
+		return cli.Create(ctx, cm)
+	} else if err != nil {
+		return err
+	}
+	cm.Data = data
+	return cli.Update(ctx, cm)
+}
@@ -0,0 +1,151 @@
+package kfdefappskubefloworg
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// failingDiscovery fails to discover the resources of a group version.
+type failingDiscovery struct {
+	*fakediscovery.FakeDiscovery
+	groupVersion string
+}
+
+func (d *failingDiscovery) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	if groupVersion == d.groupVersion {
+		return nil, fmt.Errorf("the server is currently unable to handle the request")
+	}
+	return d.FakeDiscovery.ServerResourcesForGroupVersion(groupVersion)
+}
+
+func TestDetectCapabilities(t *testing.T) {
+	resources := func(groupVersion string, kinds ...string) *metav1.APIResourceList {
+		list := &metav1.APIResourceList{GroupVersion: groupVersion}
+		for _, kind := range kinds {
+			list.APIResources = append(list.APIResources, metav1.APIResource{Kind: kind})
+		}
+		return list
+	}
+
+	type testCase struct {
+		Name      string
+		Resources []*metav1.APIResourceList
+		Enabled   []string
+		Disabled  []string
+		// Failing is a group version whose resources can't be discovered.
+		Failing string
+	}
+	testCases := []testCase{
+		{
+			Name: "openshift",
+			Resources: []*metav1.APIResourceList{
+				resources("v1", "ConfigMap"),
+				resources("apps.openshift.io/v1", "DeploymentConfig"),
+				resources("image.openshift.io/v1", "ImageStream", "ImageStreamTag"),
+				resources("build.openshift.io/v1", "BuildConfig", "Build"),
+				resources("route.openshift.io/v1", "Route"),
+				resources("oauth.openshift.io/v1", "OAuthClient"),
+			},
+			Enabled:  []string{CapabilityBuildConfigs, CapabilityDeploymentConfigs, CapabilityImageStreams, CapabilityOAuthClients, CapabilityRoutes},
+			Disabled: []string{},
+		},
+		{
+			Name: "kubernetes",
+			Resources: []*metav1.APIResourceList{
+				resources("v1", "ConfigMap"),
+				resources("apps/v1", "Deployment"),
+			},
+			Enabled:  []string{},
+			Disabled: []string{CapabilityBuildConfigs, CapabilityDeploymentConfigs, CapabilityImageStreams, CapabilityOAuthClients, CapabilityRoutes},
+		},
+		{
+			Name: "microshift",
+			Resources: []*metav1.APIResourceList{
+				resources("v1", "ConfigMap"),
+				resources("route.openshift.io/v1", "Route"),
+				resources("image.openshift.io/v1"),
+			},
+			Enabled:  []string{CapabilityRoutes},
+			Disabled: []string{CapabilityBuildConfigs, CapabilityDeploymentConfigs, CapabilityImageStreams, CapabilityOAuthClients},
+		},
+		{
+			Name: "unavailable-group-version",
+			Resources: []*metav1.APIResourceList{
+				resources("v1", "ConfigMap"),
+				resources("apps.openshift.io/v1", "DeploymentConfig"),
+				resources("route.openshift.io/v1", "Route"),
+			},
+			Failing:  "apps.openshift.io/v1",
+			Enabled:  []string{CapabilityRoutes},
+			Disabled: []string{CapabilityBuildConfigs, CapabilityDeploymentConfigs, CapabilityImageStreams, CapabilityOAuthClients},
+		},
+	}
+
+	for _, c := range testCases {
+		d := &failingDiscovery{
+			FakeDiscovery: &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: c.Resources}},
+			groupVersion:  c.Failing,
+		}
+		capabilities, err := DetectCapabilities(d, logr.Discard())
+		if err != nil {
+			t.Fatalf("Case %v: failed to detect the capabilities: %v", c.Name, err)
+		}
+		if !reflect.DeepEqual(capabilities.Enabled(), c.Enabled) {
+			t.Errorf("Case %v: expected enabled %v; got %v", c.Name, c.Enabled, capabilities.Enabled())
+		}
+		if !reflect.DeepEqual(capabilities.Disabled(), c.Disabled) {
+			t.Errorf("Case %v: expected disabled %v; got %v", c.Name, c.Disabled, capabilities.Disabled())
+		}
+	}
+
+	var all *Capabilities
+	if !all.Has(CapabilityRoutes) || len(all.Disabled()) != 0 {
+		t.Errorf("expected nil capabilities to have every capability enabled")
+	}
+}
+
+func TestPublishCapabilities(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	cli := fake.NewClientBuilder().WithScheme(scheme).Build()
+	key := types.NamespacedName{Namespace: "opendatahub-operator", Name: capabilitiesConfigMap}
+
+	capabilities := &Capabilities{enabled: map[string]bool{CapabilityRoutes: true}}
+	if err := capabilities.Publish(context.TODO(), cli, key.Namespace); err != nil {
+		t.Fatalf("failed to publish the capabilities: %v", err)
+	}
+	cm := &v1.ConfigMap{}
+	if err := cli.Get(context.TODO(), key, cm); err != nil {
+		t.Fatalf("failed to get the capabilities: %v", err)
+	}
+	expected := map[string]string{
+		"enabled":  "Routes",
+		"disabled": "BuildConfigs,DeploymentConfigs,ImageStreams,OAuthClients",
+	}
+	if !reflect.DeepEqual(cm.Data, expected) {
+		t.Errorf("expected %v; got %v", expected, cm.Data)
+	}
+
+	capabilities = &Capabilities{enabled: map[string]bool{}}
+	if err := capabilities.Publish(context.TODO(), cli, key.Namespace); err != nil {
+		t.Fatalf("failed to update the capabilities: %v", err)
+	}
+	if err := cli.Get(context.TODO(), key, cm); err != nil {
+		t.Fatalf("failed to get the capabilities: %v", err)
+	}
+	if cm.Data["enabled"] != "" || cm.Data["disabled"] != "BuildConfigs,DeploymentConfigs,ImageStreams,OAuthClients,Routes" {
+		t.Errorf("expected every capability disabled; got %v", cm.Data)
+	}
+}
@@ -0,0 +1,110 @@
+package kfdefappskubefloworg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kfdefappskubefloworgv1 "github.com/opendatahub-io/opendatahub-operator/apis/kfdef.apps.kubeflow.org/v1"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+)
+
+const (
+	// catalogKfDefLabel and catalogRepoLabel are set on the catalog ConfigMaps to the names of
+	// the KfDef and of the repo they list the applications of.
+	catalogKfDefLabel = "opendatahub.io/catalog-kfdef"
+	catalogRepoLabel  = "opendatahub.io/catalog-repo"
+	// catalogKey is the key of the catalog in the data of its ConfigMap.
+	catalogKey = "catalog.yaml"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// catalogConfigMapName returns the name of the ConfigMap of the catalog of repo.
+func catalogConfigMapName(instance *kfdefappskubefloworgv1.KfDef, repo string) string {
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(fmt.Sprintf("%v-%v-catalog", instance.Name, repo)), "-")
+	if len(name) > 253 {
+		name = name[:253]
+	}
+	return strings.Trim(name, "-")
+}
+
+// publishCatalogs publishes the applications of each cached repo of instance in a ConfigMap owned
+// by instance, and deletes the ConfigMaps of the repos no longer cached.
+func (r *KfDefReconciler) publishCatalogs(ctx context.Context, instance *kfdefappskubefloworgv1.KfDef) error {
+	published := map[string]bool{}
+	for _, cache := range instance.Status.ReposCache {
+		if _, err := os.Stat(cache.LocalPath); err != nil {
+			// Keep the catalog until the repo is synced again.
+			published[catalogConfigMapName(instance, cache.Name)] = true
+			continue
+		}
+		catalog, err := kfconfig.BuildCatalog(cache.Name, cache.LocalPath)
+		if err != nil {
+			return err
+		}
+		data, err := yaml.Marshal(catalog)
+		if err != nil {
+			return err
+		}
+		cm := &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      catalogConfigMapName(instance, cache.Name),
+				Namespace: instance.Namespace,
+				Labels: map[string]string{
+					catalogKfDefLabel: instance.Name,
+					catalogRepoLabel:  cache.Name,
+				},
+			},
+			Data: map[string]string{catalogKey: string(data)},
+		}
+		if err := controllerutil.SetControllerReference(instance, cm, r.Scheme); err != nil {
+			return err
+		}
+		published[cm.Name] = true
+
+		found := &v1.ConfigMap{}
+		err = r.Client.Get(ctx, types.NamespacedName{Namespace: cm.Namespace, Name: cm.Name}, found)
+		if errors.IsNotFound(err) {
+			if err := r.Client.Create(ctx, cm); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		if found.Data[catalogKey] == cm.Data[catalogKey] {
+			continue
+		}
+		found.Labels = cm.Labels
+		found.Data = cm.Data
+		if err := r.Client.Update(ctx, found); err != nil {
+			return err
+		}
+	}
+
+	catalogs := &v1.ConfigMapList{}
+	if err := r.Client.List(ctx, catalogs, client.InNamespace(instance.Namespace),
+		client.MatchingLabels{catalogKfDefLabel: instance.Name}); err != nil {
+		return err
+	}
+	for i := range catalogs.Items {
+		if published[catalogs.Items[i].Name] {
+			continue
+		}
+		if err := r.Client.Delete(ctx, &catalogs.Items[i]); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
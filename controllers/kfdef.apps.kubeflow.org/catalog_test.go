@@ -0,0 +1,80 @@
+package kfdefappskubefloworg
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kfdefappskubefloworgv1 "github.com/opendatahub-io/opendatahub-operator/apis/kfdef.apps.kubeflow.org/v1"
+)
+
+func TestPublishCatalogs(t *testing.T) {
+	repoDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(repoDir)
+	if err := os.MkdirAll(filepath.Join(repoDir, "odh-dashboard", "base"), 0755); err != nil {
+		t.Fatalf("Failed to create the dashboard dir: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(repoDir, "odh-dashboard", "base", "kustomization.yaml"), []byte("resources: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to write kustomization.yaml: %v", err)
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = kfdefappskubefloworgv1.AddToScheme(scheme)
+	instance := &kfdefappskubefloworgv1.KfDef{
+		ObjectMeta: metav1.ObjectMeta{Name: "odh", Namespace: "opendatahub", UID: "uid"},
+		Status: kfdefappskubefloworgv1.KfDefStatus{
+			ReposCache: []kfdefappskubefloworgv1.RepoCache{
+				{Name: "manifests", LocalPath: repoDir},
+				{Name: "unsynced", LocalPath: filepath.Join(repoDir, "missing")},
+			},
+		},
+	}
+	stale := &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:      "odh-removed-catalog",
+		Namespace: "opendatahub",
+		Labels:    map[string]string{catalogKfDefLabel: "odh", catalogRepoLabel: "removed"},
+	}}
+	kept := &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:      "odh-unsynced-catalog",
+		Namespace: "opendatahub",
+		Labels:    map[string]string{catalogKfDefLabel: "odh", catalogRepoLabel: "unsynced"},
+	}}
+	r := &KfDefReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(instance, stale, kept).Build(),
+		Scheme: scheme,
+	}
+	if err := r.publishCatalogs(context.TODO(), instance); err != nil {
+		t.Fatalf("Failed to publish the catalogs: %v", err)
+	}
+
+	catalog := &v1.ConfigMap{}
+	if err := r.Client.Get(context.TODO(), types.NamespacedName{Namespace: "opendatahub", Name: "odh-manifests-catalog"}, catalog); err != nil {
+		t.Fatalf("Failed to get the catalog: %v", err)
+	}
+	if !strings.Contains(catalog.Data[catalogKey], "name: odh-dashboard") || !strings.Contains(catalog.Data[catalogKey], "repo: manifests") {
+		t.Errorf("Expected the catalog to list odh-dashboard; got %v", catalog.Data[catalogKey])
+	}
+	if len(catalog.OwnerReferences) != 1 || catalog.OwnerReferences[0].Name != "odh" {
+		t.Errorf("Expected the catalog to be owned by the KfDef; got %v", catalog.OwnerReferences)
+	}
+	if err := r.Client.Get(context.TODO(), types.NamespacedName{Namespace: "opendatahub", Name: kept.Name}, &v1.ConfigMap{}); err != nil {
+		t.Errorf("Expected the catalog of the unsynced repo to be kept; got %v", err)
+	}
+	if err := r.Client.Get(context.TODO(), types.NamespacedName{Namespace: "opendatahub", Name: stale.Name}, &v1.ConfigMap{}); err == nil {
+		t.Errorf("Expected the catalog of the removed repo to be deleted")
+	}
+}
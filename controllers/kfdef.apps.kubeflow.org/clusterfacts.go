@@ -0,0 +1,142 @@
+package kfdefappskubefloworg
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kfdefappskubefloworgv1 "github.com/opendatahub-io/opendatahub-operator/apis/kfdef.apps.kubeflow.org/v1"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+)
+
+// DefaultClusterFactsTTL is how long a ClusterFactsCollector reuses the facts it collected.
+const DefaultClusterFactsTTL = 10 * time.Minute
+
+var (
+	clusterVersionGVK = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "ClusterVersion"}
+	ingressGVK        = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "Ingress"}
+	proxyGVK          = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "Proxy"}
+)
+
+// defaultStorageClassAnnotations mark the default StorageClass of a cluster.
+var defaultStorageClassAnnotations = []string{
+	"storageclass.kubernetes.io/is-default-class",
+	"storageclass.beta.kubernetes.io/is-default-class",
+}
+
+// ClusterFactsCollector discovers facts about the cluster, e.g. its platform and the domain of
+// its routes, which the applications are rendered with. The facts are collected once per ttl.
+type ClusterFactsCollector struct {
+	reader    client.Reader
+	discovery discovery.DiscoveryInterface
+	ttl       time.Duration
+
+	mu        sync.Mutex
+	facts     *kfdefappskubefloworgv1.ClusterFacts
+	collected time.Time
+}
+
+// NewClusterFactsCollector returns a ClusterFactsCollector reading the cluster objects with
+// reader, which shouldn't be cached, and collecting the facts again once they're older than ttl.
+func NewClusterFactsCollector(reader client.Reader, discovery discovery.DiscoveryInterface, ttl time.Duration) *ClusterFactsCollector {
+	return &ClusterFactsCollector{reader: reader, discovery: discovery, ttl: ttl}
+}
+
+// Get returns the facts about the cluster, or nil if c is nil.
+func (c *ClusterFactsCollector) Get(ctx context.Context) (*kfdefappskubefloworgv1.ClusterFacts, error) {
+	if c == nil {
+		return nil, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.facts == nil || time.Since(c.collected) >= c.ttl {
+		facts, err := c.collect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.facts = facts
+		c.collected = time.Now()
+	}
+	return c.facts.DeepCopy(), nil
+}
+
+// collect discovers the facts about the cluster. The facts only available on OpenShift are left
+// empty on other platforms, or if the objects holding them can't be read.
+func (c *ClusterFactsCollector) collect(ctx context.Context) (*kfdefappskubefloworgv1.ClusterFacts, error) {
+	apis, err := kfconfig.DiscoverAPIs(c.discovery)
+	if err != nil {
+		return nil, err
+	}
+	serverVersion, err := c.discovery.ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+	facts := &kfdefappskubefloworgv1.ClusterFacts{
+		Platform:          apis.Platform,
+		Version:           serverVersion.GitVersion,
+		KubernetesVersion: serverVersion.GitVersion,
+		APIGroups:         apis.APIGroups,
+		APIVersions:       apis.APIVersions,
+	}
+
+	if facts.Platform == kfconfig.PlatformOpenShift {
+		if clusterVersion := c.get(ctx, clusterVersionGVK, "version"); clusterVersion != nil {
+			if version, _, _ := unstructured.NestedString(clusterVersion.Object, "status", "desired", "version"); version != "" {
+				facts.Version = version
+			}
+		}
+		if ingress := c.get(ctx, ingressGVK, "cluster"); ingress != nil {
+			facts.IngressDomain, _, _ = unstructured.NestedString(ingress.Object, "spec", "domain")
+		}
+		if proxy := c.get(ctx, proxyGVK, "cluster"); proxy != nil {
+			p := &kfdefappskubefloworgv1.ClusterProxy{}
+			p.HTTPProxy, _, _ = unstructured.NestedString(proxy.Object, "status", "httpProxy")
+			p.HTTPSProxy, _, _ = unstructured.NestedString(proxy.Object, "status", "httpsProxy")
+			p.NoProxy, _, _ = unstructured.NestedString(proxy.Object, "status", "noProxy")
+			if *p != (kfdefappskubefloworgv1.ClusterProxy{}) {
+				facts.Proxy = p
+			}
+		}
+	}
+
+	storageClasses := &storagev1.StorageClassList{}
+	if err := c.reader.List(ctx, storageClasses); err != nil {
+		kfdefLog.Error(err, "failed to list the storage classes")
+	}
+	names := []string{}
+	for _, sc := range storageClasses.Items {
+		for _, annotation := range defaultStorageClassAnnotations {
+			if sc.Annotations[annotation] == "true" {
+				names = append(names, sc.Name)
+				break
+			}
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		facts.DefaultStorageClass = names[0]
+	}
+	return facts, nil
+}
+
+// get returns the cluster scoped object name of kind gvk, or nil if it can't be read.
+func (c *ClusterFactsCollector) get(ctx context.Context, gvk schema.GroupVersionKind, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	if err := c.reader.Get(ctx, types.NamespacedName{Name: name}, obj); err != nil {
+		if !errors.IsNotFound(err) {
+			kfdefLog.Error(err, "failed to get a cluster configuration", "kind", gvk.Kind, "name", name)
+		}
+		return nil
+	}
+	return obj
+}
@@ -0,0 +1,140 @@
+package kfdefappskubefloworg
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kfdefappskubefloworgv1 "github.com/opendatahub-io/opendatahub-operator/apis/kfdef.apps.kubeflow.org/v1"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+)
+
+func TestClusterFactsCollector(t *testing.T) {
+	defer func(l logr.Logger) { kfdefLog = l }(kfdefLog)
+	kfdefLog = logr.Discard()
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	config := func(gvk schema.GroupVersionKind, name string, fields map[string]interface{}) client.Object {
+		scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		obj := &unstructured.Unstructured{Object: fields}
+		obj.SetGroupVersionKind(gvk)
+		obj.SetName(name)
+		return obj
+	}
+	storageClass := func(name string, isDefault bool) client.Object {
+		sc := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: name}, Provisioner: "kubernetes.io/no-provisioner"}
+		if isDefault {
+			sc.Annotations = map[string]string{"storageclass.kubernetes.io/is-default-class": "true"}
+		}
+		return sc
+	}
+	openShiftObjects := []client.Object{
+		config(clusterVersionGVK, "version", map[string]interface{}{"status": map[string]interface{}{"desired": map[string]interface{}{"version": "4.10.3"}}}),
+		config(ingressGVK, "cluster", map[string]interface{}{"spec": map[string]interface{}{"domain": "apps.example.com"}}),
+		config(proxyGVK, "cluster", map[string]interface{}{"status": map[string]interface{}{"httpProxy": "http://proxy:3128", "noProxy": ".svc"}}),
+		storageClass("standard", false),
+		storageClass("gp2", true),
+	}
+	discovery := func(groupVersions ...string) *fakediscovery.FakeDiscovery {
+		d := &fakediscovery.FakeDiscovery{
+			Fake:               &clienttesting.Fake{},
+			FakedServerVersion: &version.Info{GitVersion: "v1.23.3"},
+		}
+		for _, gv := range groupVersions {
+			d.Resources = append(d.Resources, &metav1.APIResourceList{GroupVersion: gv})
+		}
+		return d
+	}
+
+	type testCase struct {
+		Name      string
+		Discovery *fakediscovery.FakeDiscovery
+		Objects   []client.Object
+		Expected  *kfdefappskubefloworgv1.ClusterFacts
+	}
+	testCases := []testCase{
+		{
+			Name:      "openshift",
+			Discovery: discovery("v1", "route.openshift.io/v1", "config.openshift.io/v1", "apps/v1"),
+			Objects:   openShiftObjects,
+			Expected: &kfdefappskubefloworgv1.ClusterFacts{
+				Platform:            kfconfig.PlatformOpenShift,
+				Version:             "4.10.3",
+				KubernetesVersion:   "v1.23.3",
+				IngressDomain:       "apps.example.com",
+				APIGroups:           []string{"", "apps", "config.openshift.io", "route.openshift.io"},
+				APIVersions:         []string{"apps/v1", "config.openshift.io/v1", "route.openshift.io/v1", "v1"},
+				DefaultStorageClass: "gp2",
+				Proxy:               &kfdefappskubefloworgv1.ClusterProxy{HTTPProxy: "http://proxy:3128", NoProxy: ".svc"},
+			},
+		},
+		{
+			Name:      "openshift-without-config",
+			Discovery: discovery("route.openshift.io/v1"),
+			Expected: &kfdefappskubefloworgv1.ClusterFacts{
+				Platform:          kfconfig.PlatformOpenShift,
+				Version:           "v1.23.3",
+				KubernetesVersion: "v1.23.3",
+				APIGroups:         []string{"route.openshift.io"},
+				APIVersions:       []string{"route.openshift.io/v1"},
+			},
+		},
+		{
+			Name:      "kubernetes",
+			Discovery: discovery("v1", "apps/v1"),
+			Objects:   openShiftObjects,
+			Expected: &kfdefappskubefloworgv1.ClusterFacts{
+				Platform:            kfconfig.PlatformKubernetes,
+				Version:             "v1.23.3",
+				KubernetesVersion:   "v1.23.3",
+				APIGroups:           []string{"", "apps"},
+				APIVersions:         []string{"apps/v1", "v1"},
+				DefaultStorageClass: "gp2",
+			},
+		},
+	}
+	for _, c := range testCases {
+		reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(c.Objects...).Build()
+		collector := NewClusterFactsCollector(reader, c.Discovery, time.Hour)
+		facts, err := collector.Get(context.TODO())
+		if err != nil {
+			t.Errorf("Case %v: failed to collect the facts: %v", c.Name, err)
+		} else if !reflect.DeepEqual(facts, c.Expected) {
+			t.Errorf("Case %v: expected facts %+v; got %+v", c.Name, c.Expected, facts)
+		}
+	}
+
+	// The facts are collected again once they expired.
+	d := discovery("v1")
+	collector := NewClusterFactsCollector(fake.NewClientBuilder().WithScheme(scheme).Build(), d, time.Hour)
+	if _, err := collector.Get(context.TODO()); err != nil {
+		t.Fatalf("Failed to collect the facts: %v", err)
+	}
+	d.FakedServerVersion = &version.Info{GitVersion: "v1.24.0"}
+	if facts, _ := collector.Get(context.TODO()); facts.Version != "v1.23.3" {
+		t.Errorf("Expected the facts to be cached; got version %v", facts.Version)
+	}
+	collector.collected = time.Now().Add(-time.Hour)
+	if facts, _ := collector.Get(context.TODO()); facts.Version != "v1.24.0" {
+		t.Errorf("Expected the facts to be collected again; got version %v", facts.Version)
+	}
+	var none *ClusterFactsCollector
+	if facts, err := none.Get(context.TODO()); facts != nil || err != nil {
+		t.Errorf("Expected no facts without a collector; got %v, %v", facts, err)
+	}
+}
@@ -48,6 +48,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 	"strings"
+	"time"
 
 	ofapi "github.com/operator-framework/api/pkg/operators/v1alpha1"
 	olmclientset "github.com/operator-framework/operator-lifecycle-manager/pkg/api/client/clientset/versioned/typed/operators/v1alpha1"
@@ -59,6 +60,7 @@ import (
 	kftypesv3 "github.com/opendatahub-io/opendatahub-operator/apis/apps"
 	kfdefappskubefloworgv1 "github.com/opendatahub-io/opendatahub-operator/apis/kfdef.apps.kubeflow.org/v1"
 	"github.com/opendatahub-io/opendatahub-operator/pkg/kfapp/coordinator"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
 	kfloaders "github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig/loaders"
 	kfutils "github.com/opendatahub-io/opendatahub-operator/pkg/utils"
 )
@@ -74,6 +76,10 @@ const (
 	odhGeneratedNamespaceLabel = "opendatahub.io/generated-namespace"
 )
 
+// deploymentConfigMigrationRequeueDelay is how long to wait before reconciling a KfDef again
+// while the Deployments replacing its DeploymentConfigs aren't available.
+const deploymentConfigMigrationRequeueDelay = 30 * time.Second
+
 // kfdefInstances keep all KfDef CRs watched by the operator
 var kfdefInstances = make(map[string]struct{})
 
@@ -91,6 +97,14 @@ type KfDefReconciler struct {
 	Log        logr.Logger
 	// Recorder to generate events
 	Recorder record.EventRecorder
+	// RepoWatcher triggers reconciles when the local directory repos change, if not nil.
+	RepoWatcher *RepoWatcher
+	// RepoUpdates reports new versions of the repos with an update policy, if not nil.
+	RepoUpdates *RepoUpdateChecker
+	// ClusterFacts discovers the facts about the cluster the applications are rendered with, if not nil.
+	ClusterFacts *ClusterFactsCollector
+	// Capabilities are the optional capabilities the cluster supports, all of them if nil.
+	Capabilities *Capabilities
 }
 
 //+kubebuilder:rbac:groups=*,resources=*,verbs=*
@@ -161,6 +175,9 @@ func (r *KfDefReconciler) Reconcile(ctx context.Context, request ctrl.Request) (
 			return ctrl.Result{}, err
 		}
 		r.Log.Info("kfAppDir deleted.")
+		kfconfig.ReleaseSharedCache(instance.GetNamespace(), instance.GetName())
+		r.RepoWatcher.Unwatch(request.NamespacedName)
+		r.RepoUpdates.Untrack(request.NamespacedName)
 
 		// Remove this KfDef instance
 		delete(kfdefInstances, strings.Join([]string{instance.GetName(), instance.GetNamespace()}, "."))
@@ -201,7 +218,13 @@ func (r *KfDefReconciler) Reconcile(ctx context.Context, request ctrl.Request) (
 	// If this is a kfdef change, for now, remove the kfapp config path
 	if request.Name == instance.GetName() && request.Namespace == instance.GetNamespace() {
 		kfAppDir := path.Join("/tmp", instance.GetNamespace(), instance.GetName())
-		if err = os.RemoveAll(kfAppDir); err != nil {
+		if changes := r.RepoWatcher.TakeChanges(instance); changes != nil {
+			// Only local repos changed; keep the applications they don't affect.
+			if err = invalidateChangedRepos(kfAppDir, instance, changes); err != nil {
+				r.Log.Error(err, "failed to delete the changed repos from the app directory")
+				return ctrl.Result{}, err
+			}
+		} else if err = removeAppDir(kfAppDir, instance, r.RepoUpdates.KeptRepos(instance)); err != nil {
 			r.Log.Error(err, "failed to delete the app directory")
 			return ctrl.Result{}, err
 		}
@@ -233,7 +256,20 @@ func (r *KfDefReconciler) Reconcile(ctx context.Context, request ctrl.Request) (
 		return ctrl.Result{Requeue: true}, nil
 	}
 
+	if facts, err := r.ClusterFacts.Get(ctx); err != nil {
+		r.Log.Error(err, "failed to collect the cluster facts")
+	} else if facts != nil {
+		instance.Status.ClusterFacts = facts
+	}
+
 	err = getReconcileStatus(instance, kfApply(instance))
+	migrationPending := err == nil && setDeploymentConfigMigrationStatus(instance)
+	r.RepoWatcher.Watch(instance, err == nil)
+	r.RepoUpdates.Track(instance)
+	r.RepoUpdates.SetCondition(instance)
+	if catalogErr := r.publishCatalogs(ctx, instance); catalogErr != nil {
+		r.Log.Error(catalogErr, "failed to publish the application catalogs")
+	}
 	if err == nil {
 		r.Log.Info("KubeFlow Deployment Completed.")
 		r.Recorder.Eventf(instance, v1.EventTypeNormal, "KfDefCreationSuccessful",
@@ -251,6 +287,11 @@ func (r *KfDefReconciler) Reconcile(ctx context.Context, request ctrl.Request) (
 		return ctrl.Result{}, err
 	}
 
+	if migrationPending {
+		// Finish deleting the DeploymentConfigs once their Deployments are available.
+		return ctrl.Result{RequeueAfter: deploymentConfigMigrationRequeueDelay}, nil
+	}
+
 	// If deployment created successfully - don't requeue
 
 	return ctrl.Result{}, nil
@@ -263,7 +304,7 @@ func (r *KfDefReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	watchKfdefHandler := handler.EnqueueRequestsFromMapFunc(r.watchKfDef)
 	watchedHandler := handler.EnqueueRequestsFromMapFunc(r.watchKubeflowResources)
 
-	err := ctrl.NewControllerManagedBy(mgr).Named("kfdef-controller").
+	b := ctrl.NewControllerManagedBy(mgr).Named("kfdef-controller").
 		For(&kfdefappskubefloworgv1.KfDef{}).
 		Watches(&source.Kind{Type: &kfdefappskubefloworgv1.KfDef{}}, watchKfdefHandler, builder.WithPredicates(kfdefPredicates)).
 		Watches(&source.Kind{Type: &appsv1.Deployment{}}, watchedHandler, builder.WithPredicates(ownedResourcePredicates)).
@@ -272,9 +313,6 @@ func (r *KfDefReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Watches(&source.Kind{Type: &v1.Service{}}, watchedHandler, builder.WithPredicates(ownedResourcePredicates)).
 		Watches(&source.Kind{Type: &appsv1.DaemonSet{}}, watchedHandler, builder.WithPredicates(ownedResourcePredicates)).
 		Watches(&source.Kind{Type: &appsv1.StatefulSet{}}, watchedHandler, builder.WithPredicates(ownedResourcePredicates)).
-		Watches(&source.Kind{Type: &ocappsv1.DeploymentConfig{}}, watchedHandler, builder.WithPredicates(ownedResourcePredicates)).
-		Watches(&source.Kind{Type: &ocimgv1.ImageStream{}}, watchedHandler, builder.WithPredicates(ownedResourcePredicates)).
-		Watches(&source.Kind{Type: &ocbuildv1.BuildConfig{}}, watchedHandler, builder.WithPredicates(ownedResourcePredicates)).
 		Watches(&source.Kind{Type: &apiextensionsv1.CustomResourceDefinition{}}, watchedHandler, builder.WithPredicates(ownedResourcePredicates)).
 		Watches(&source.Kind{Type: &apiregistrationv1.APIService{}}, watchedHandler, builder.WithPredicates(ownedResourcePredicates)).
 		Watches(&source.Kind{Type: &netv1.Ingress{}}, watchedHandler, builder.WithPredicates(ownedResourcePredicates)).
@@ -286,9 +324,35 @@ func (r *KfDefReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Watches(&source.Kind{Type: &rbacv1.Role{}}, watchedHandler, builder.WithPredicates(ownedResourcePredicates)).
 		Watches(&source.Kind{Type: &rbacv1.RoleBinding{}}, watchedHandler, builder.WithPredicates(ownedResourcePredicates)).
 		Watches(&source.Kind{Type: &rbacv1.ClusterRole{}}, watchedHandler, builder.WithPredicates(ownedResourcePredicates)).
-		Watches(&source.Kind{Type: &rbacv1.ClusterRoleBinding{}}, watchedHandler, builder.WithPredicates(ownedResourcePredicates)).
-		Complete(r)
+		Watches(&source.Kind{Type: &rbacv1.ClusterRoleBinding{}}, watchedHandler, builder.WithPredicates(ownedResourcePredicates))
+	// The OpenShift resources are only watched if the cluster serves their APIs.
+	openShiftResources := []struct {
+		capability string
+		obj        client.Object
+	}{
+		{CapabilityDeploymentConfigs, &ocappsv1.DeploymentConfig{}},
+		{CapabilityImageStreams, &ocimgv1.ImageStream{}},
+		{CapabilityBuildConfigs, &ocbuildv1.BuildConfig{}},
+	}
+	for _, res := range openShiftResources {
+		if r.Capabilities.Has(res.capability) {
+			b = b.Watches(&source.Kind{Type: res.obj}, watchedHandler, builder.WithPredicates(ownedResourcePredicates))
+		}
+	}
+	if r.RepoWatcher != nil {
+		if err := mgr.Add(r.RepoWatcher); err != nil {
+			return err
+		}
+		b = b.Watches(&source.Channel{Source: r.RepoWatcher.Events()}, &handler.EnqueueRequestForObject{})
+	}
+	if r.RepoUpdates != nil {
+		if err := mgr.Add(r.RepoUpdates); err != nil {
+			return err
+		}
+		b = b.Watches(&source.Channel{Source: r.RepoUpdates.Events()}, &handler.EnqueueRequestForObject{})
+	}
 
+	err := b.Complete(r)
 	if err != nil {
 		return err
 	}
@@ -428,6 +492,7 @@ func kfApply(instance *kfdefappskubefloworgv1.KfDef) error {
 	}
 	// Apply kfApp.
 	err = kfApp.Apply(kftypesv3.K8S)
+	setReposCacheStatus(instance)
 	return err
 }
 
@@ -0,0 +1,305 @@
+package kfdefappskubefloworg
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	kfdefappskubefloworgv1 "github.com/opendatahub-io/opendatahub-operator/apis/kfdef.apps.kubeflow.org/v1"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+	kfloaders "github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig/loaders"
+)
+
+const (
+	// DefaultRepoUpdateCheckPeriod is how often a RepoUpdateChecker looks for repos due for a check.
+	DefaultRepoUpdateCheckPeriod = time.Minute
+	// RepoUpdateAvailable is the reason of the UpdateAvailable condition.
+	RepoUpdateAvailable = "RepoUpdateAvailable"
+)
+
+// checkedRepo is a repo with an update policy, as it was last applied.
+type checkedRepo struct {
+	spec kfconfig.Repo
+	// revision is the cached revision of the repo.
+	revision string
+	// available is the newer revision the ref of the repo points to upstream, if any.
+	available string
+	nextCheck time.Time
+}
+
+// RepoUpdateChecker periodically resolves the mutable refs of the repos with an update policy
+// and triggers a reconcile of their KfDef when they point to a new revision. The reconcile
+// reports the new revisions with the UpdateAvailable condition and fetches them only for the
+// repos updated automatically; the cache of the other repos is kept.
+type RepoUpdateChecker struct {
+	period time.Duration
+	events chan event.GenericEvent
+
+	mu     sync.Mutex
+	kfDefs map[types.NamespacedName]map[string]*checkedRepo
+}
+
+// NewRepoUpdateChecker returns a RepoUpdateChecker looking for repos due for a check every period.
+func NewRepoUpdateChecker(period time.Duration) *RepoUpdateChecker {
+	return &RepoUpdateChecker{
+		period: period,
+		events: make(chan event.GenericEvent, 16),
+		kfDefs: map[types.NamespacedName]map[string]*checkedRepo{},
+	}
+}
+
+// Events returns the channel the reconcile requests are sent to.
+func (u *RepoUpdateChecker) Events() <-chan event.GenericEvent {
+	return u.events
+}
+
+// Start checks the repos due for a check every period until ctx is done.
+func (u *RepoUpdateChecker) Start(ctx context.Context) error {
+	ticker := time.NewTicker(u.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			u.check()
+		}
+	}
+}
+
+// Track records the repos of instance with an update policy and the revisions they were
+// applied at. A pending update is forgotten once applied or when its repo changed.
+func (u *RepoUpdateChecker) Track(instance *kfdefappskubefloworgv1.KfDef) {
+	if u == nil {
+		return
+	}
+	config, err := kfloaders.V1{}.LoadKfConfig(instance)
+	if err != nil {
+		kfdefLog.Error(err, "failed to load the repos to check for updates", "instance", instance.Name)
+		return
+	}
+	revisions := map[string]string{}
+	for _, cache := range instance.Status.ReposCache {
+		revisions[cache.Name] = cache.Revision
+	}
+
+	key := types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	previous := u.kfDefs[key]
+	repos := map[string]*checkedRepo{}
+	for _, r := range config.Spec.Repos {
+		if r.Update == nil || !kfconfig.IsMutableRepo(r) || revisions[r.Name] == "" {
+			continue
+		}
+		checked := &checkedRepo{
+			spec:      r,
+			revision:  revisions[r.Name],
+			nextCheck: time.Now().Add(r.Update.UpdateInterval()),
+		}
+		if p, ok := previous[r.Name]; ok && reflect.DeepEqual(p.spec, r) {
+			checked.nextCheck = p.nextCheck
+			if p.revision == checked.revision && p.available != checked.revision {
+				checked.available = p.available
+			}
+		}
+		repos[r.Name] = checked
+	}
+	if len(repos) == 0 {
+		delete(u.kfDefs, key)
+		return
+	}
+	u.kfDefs[key] = repos
+}
+
+// Untrack stops checking the repos of the KfDef key.
+func (u *RepoUpdateChecker) Untrack(key types.NamespacedName) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.kfDefs, key)
+}
+
+// KeptRepos returns the repos of instance whose cache is kept by the next reconcile: those
+// with an update policy, unchanged since they were applied, unless an update is to be
+// applied automatically.
+func (u *RepoUpdateChecker) KeptRepos(instance *kfdefappskubefloworgv1.KfDef) map[string]bool {
+	if u == nil {
+		return nil
+	}
+	config, err := kfloaders.V1{}.LoadKfConfig(instance)
+	if err != nil {
+		return nil
+	}
+	key := types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	keep := map[string]bool{}
+	for _, r := range config.Spec.Repos {
+		checked, ok := u.kfDefs[key][r.Name]
+		if !ok || !reflect.DeepEqual(checked.spec, r) {
+			continue
+		}
+		if checked.available != "" && r.Update.Auto {
+			kfdefLog.Info("Updating repo", "repo", r.Name, "revision", checked.available, "instance", instance.Name)
+			continue
+		}
+		keep[r.Name] = true
+	}
+	return keep
+}
+
+// SetCondition adds the UpdateAvailable condition to the status of instance if any of its
+// repos has a new revision upstream.
+func (u *RepoUpdateChecker) SetCondition(instance *kfdefappskubefloworgv1.KfDef) {
+	if u == nil {
+		return
+	}
+	key := types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}
+	u.mu.Lock()
+	var updates []string
+	for name, checked := range u.kfDefs[key] {
+		if checked.available != "" {
+			updates = append(updates, fmt.Sprintf("repo %v: %v -> %v", name, checked.revision, checked.available))
+		}
+	}
+	u.mu.Unlock()
+	if len(updates) == 0 {
+		return
+	}
+	sort.Strings(updates)
+	instance.Status.Conditions = append(instance.Status.Conditions, kfdefappskubefloworgv1.KfDefCondition{
+		// The status must not change until the updates do, which would trigger another reconcile.
+		LastUpdateTime: instance.CreationTimestamp,
+		Status:         corev1.ConditionTrue,
+		Reason:         RepoUpdateAvailable,
+		Message:        strings.Join(updates, "; "),
+		Type:           kfdefappskubefloworgv1.KfUpdateAvailable,
+	})
+}
+
+// check resolves the refs of the repos due for a check and triggers a reconcile of the KfDefs
+// whose repos have a new revision, or no longer have one.
+func (u *RepoUpdateChecker) check() {
+	type dueRepo struct {
+		key      types.NamespacedName
+		repo     kfconfig.Repo
+		revision string
+	}
+	var due []dueRepo
+	now := time.Now()
+	u.mu.Lock()
+	for key, repos := range u.kfDefs {
+		for _, checked := range repos {
+			if now.Before(checked.nextCheck) {
+				continue
+			}
+			checked.nextCheck = now.Add(checked.spec.Update.UpdateInterval())
+			due = append(due, dueRepo{key: key, repo: checked.spec, revision: checked.revision})
+		}
+	}
+	u.mu.Unlock()
+
+	changed := map[types.NamespacedName]bool{}
+	for _, d := range due {
+		kfDef := &kfconfig.KfConfig{ObjectMeta: metav1.ObjectMeta{Name: d.key.Name, Namespace: d.key.Namespace}}
+		latest, err := kfDef.LatestRevision(d.repo)
+		if err != nil {
+			kfdefLog.Error(err, "failed to check the repo for updates", "repo", d.repo.Name, "instance", d.key.Name)
+			continue
+		}
+		u.mu.Lock()
+		if checked, ok := u.kfDefs[d.key][d.repo.Name]; ok && checked.revision == d.revision {
+			available := ""
+			if latest != checked.revision {
+				available = latest
+			}
+			if available != checked.available {
+				checked.available = available
+				changed[d.key] = true
+			}
+		}
+		u.mu.Unlock()
+	}
+
+	for key := range changed {
+		kfdefLog.Info("Repo updates changed; reconciling", "instance", key.Name, "namespace", key.Namespace)
+		instance := &kfdefappskubefloworgv1.KfDef{}
+		instance.SetName(key.Name)
+		instance.SetNamespace(key.Namespace)
+		u.events <- event.GenericEvent{Object: instance}
+	}
+}
+
+// removeAppDir removes kfAppDir, except the caches of the repos in keep, and forgets the other
+// caches in the status of instance so that their repos are fetched again. The archives of the
+// repos of instance are kept with their metadata too, so that they are only downloaded again
+// if they changed.
+func removeAppDir(kfAppDir string, instance *kfdefappskubefloworgv1.KfDef, keep map[string]bool) error {
+	var reposCache []kfdefappskubefloworgv1.RepoCache
+	for _, cache := range instance.Status.ReposCache {
+		if keep[cache.Name] {
+			reposCache = append(reposCache, cache)
+		}
+	}
+	instance.Status.ReposCache = reposCache
+
+	cacheDir := path.Join(kfAppDir, kfconfig.DefaultCacheDir)
+	kept := map[string]bool{}
+	for name := range keep {
+		kept[name] = true
+	}
+	for _, r := range instance.Spec.Repos {
+		// Archives are cached with their metadata in .<repo>.json.
+		if _, err := os.Stat(path.Join(cacheDir, "."+r.Name+".json")); err == nil {
+			kept[r.Name] = true
+		}
+	}
+	if len(kept) == 0 {
+		return os.RemoveAll(kfAppDir)
+	}
+
+	files, err := ioutil.ReadDir(kfAppDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, f := range files {
+		if f.Name() != kfconfig.DefaultCacheDir {
+			if err := os.RemoveAll(path.Join(kfAppDir, f.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	if files, err = ioutil.ReadDir(cacheDir); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, f := range files {
+		name := strings.TrimSuffix(strings.TrimPrefix(f.Name(), "."), ".json")
+		if !kept[name] {
+			if err := os.RemoveAll(path.Join(cacheDir, f.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
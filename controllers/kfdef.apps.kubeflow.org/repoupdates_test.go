@@ -0,0 +1,262 @@
+package kfdefappskubefloworg
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kfdefappskubefloworgv1 "github.com/opendatahub-io/opendatahub-operator/apis/kfdef.apps.kubeflow.org/v1"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+	kfloaders "github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig/loaders"
+)
+
+func TestRepoUpdateChecker(t *testing.T) {
+	defer func(l logr.Logger) { kfdefLog = l }(kfdefLog)
+	kfdefLog = logr.Discard()
+
+	var mu sync.Mutex
+	etag := `"v1"`
+	setETag := func(e string) {
+		mu.Lock()
+		defer mu.Unlock()
+		etag = e
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("ETag", etag)
+	}))
+	defer server.Close()
+
+	u := NewRepoUpdateChecker(10 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	// The checker is stopped before the logger is restored and the server closed.
+	stopped := make(chan struct{})
+	go func() {
+		_ = u.Start(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	newKfDef := func(auto bool, revision string) *kfdefappskubefloworgv1.KfDef {
+		return &kfdefappskubefloworgv1.KfDef{
+			ObjectMeta: metav1.ObjectMeta{Name: "odh", Namespace: "opendatahub"},
+			Spec: kfdefappskubefloworgv1.KfDefSpec{
+				Repos: []kfdefappskubefloworgv1.Repo{
+					{
+						Name: "manifests",
+						URI:  server.URL + "/master.tar.gz",
+						Update: &kfdefappskubefloworgv1.RepoUpdatePolicy{
+							Interval: &metav1.Duration{Duration: 20 * time.Millisecond},
+							Auto:     auto,
+						},
+					},
+					{Name: "unchecked", URI: server.URL + "/stable.tar.gz"},
+				},
+			},
+			Status: kfdefappskubefloworgv1.KfDefStatus{
+				ReposCache: []kfdefappskubefloworgv1.RepoCache{
+					{Name: "manifests", Revision: revision},
+					{Name: "unchecked", Revision: `"v1"`},
+				},
+			},
+		}
+	}
+	expectReconcile := func(expected bool) {
+		select {
+		case e := <-u.Events():
+			if !expected {
+				t.Errorf("Expected no reconcile; got %v", e.Object.GetName())
+			} else if e.Object.GetName() != "odh" || e.Object.GetNamespace() != "opendatahub" {
+				t.Errorf("Expected a reconcile of opendatahub/odh; got %v/%v", e.Object.GetNamespace(), e.Object.GetName())
+			}
+		case <-time.After(500 * time.Millisecond):
+			if expected {
+				t.Errorf("Expected a reconcile")
+			}
+		}
+	}
+	expectCondition := func(instance *kfdefappskubefloworgv1.KfDef, message string) {
+		instance.Status.Conditions = nil
+		u.SetCondition(instance)
+		if message == "" {
+			if len(instance.Status.Conditions) != 0 {
+				t.Errorf("Expected no condition; got %v", instance.Status.Conditions)
+			}
+			return
+		}
+		if len(instance.Status.Conditions) != 1 || instance.Status.Conditions[0].Type != kfdefappskubefloworgv1.KfUpdateAvailable ||
+			instance.Status.Conditions[0].Message != message {
+			t.Errorf("Expected an UpdateAvailable condition with message %v; got %v", message, instance.Status.Conditions)
+		}
+	}
+	expectKept := func(instance *kfdefappskubefloworgv1.KfDef, expected map[string]bool) {
+		if kept := u.KeptRepos(instance); !reflect.DeepEqual(kept, expected) {
+			t.Errorf("Expected the kept repos to be %v; got %v", expected, kept)
+		}
+	}
+
+	// Without updates, the repos with an update policy are kept.
+	instance := newKfDef(false, `"v1"`)
+	u.Track(instance)
+	expectReconcile(false)
+	expectCondition(instance, "")
+	expectKept(instance, map[string]bool{"manifests": true})
+
+	// A new version is reported, and the repo is kept at its cached version.
+	setETag(`"v2"`)
+	expectReconcile(true)
+	expectReconcile(false)
+	expectCondition(instance, `repo manifests: "v1" -> "v2"`)
+	expectKept(instance, map[string]bool{"manifests": true})
+	u.Track(instance)
+	expectCondition(instance, `repo manifests: "v1" -> "v2"`)
+
+	// A change to the repo isn't kept and forgets the update.
+	instance = newKfDef(true, `"v1"`)
+	expectKept(instance, map[string]bool{})
+	u.Track(instance)
+	expectCondition(instance, "")
+
+	// With an auto-update policy, the new version is fetched by the next reconcile.
+	expectReconcile(true)
+	expectCondition(instance, `repo manifests: "v1" -> "v2"`)
+	expectKept(instance, map[string]bool{})
+	instance = newKfDef(true, `"v2"`)
+	u.Track(instance)
+	expectCondition(instance, "")
+	expectReconcile(false)
+	expectKept(instance, map[string]bool{"manifests": true})
+}
+
+func TestRemoveAppDir(t *testing.T) {
+	kfAppDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(kfAppDir)
+	files := []string{
+		path.Join(kfconfig.DefaultCacheDir, "manifests", "kustomization.yaml"),
+		path.Join(kfconfig.DefaultCacheDir, ".manifests.json"),
+		path.Join(kfconfig.DefaultCacheDir, "remote", "kustomization.yaml"),
+		path.Join(kfconfig.DefaultCacheDir, ".remote.json"),
+		path.Join(kfconfig.KustomizeDir, "dashboard", "kustomization.yaml"),
+		"config.yaml",
+	}
+	for _, f := range files {
+		if err := os.MkdirAll(path.Join(kfAppDir, path.Dir(f)), 0755); err != nil {
+			t.Fatalf("Failed to create %v: %v", path.Dir(f), err)
+		}
+		if err := ioutil.WriteFile(path.Join(kfAppDir, f), []byte(f), 0644); err != nil {
+			t.Fatalf("Failed to write %v: %v", f, err)
+		}
+	}
+
+	instance := &kfdefappskubefloworgv1.KfDef{
+		Status: kfdefappskubefloworgv1.KfDefStatus{
+			ReposCache: []kfdefappskubefloworgv1.RepoCache{
+				{Name: "manifests", LocalPath: path.Join(kfAppDir, files[0])},
+				{Name: "remote", LocalPath: path.Join(kfAppDir, files[2])},
+			},
+		},
+	}
+	if err := removeAppDir(kfAppDir, instance, map[string]bool{"manifests": true}); err != nil {
+		t.Fatalf("Failed to remove the app directory: %v", err)
+	}
+	for i, f := range files {
+		_, err := os.Stat(path.Join(kfAppDir, f))
+		if removed := i >= 2; removed != os.IsNotExist(err) {
+			t.Errorf("Expected %v to be removed: %v; got %v", f, removed, err)
+		}
+	}
+	if len(instance.Status.ReposCache) != 1 || instance.Status.ReposCache[0].Name != "manifests" {
+		t.Errorf("Expected only the manifests cache to be kept in the status; got %v", instance.Status.ReposCache)
+	}
+
+	if err := removeAppDir(kfAppDir, instance, nil); err != nil {
+		t.Fatalf("Failed to remove the app directory: %v", err)
+	}
+	if _, err := os.Stat(kfAppDir); !os.IsNotExist(err) || len(instance.Status.ReposCache) != 0 {
+		t.Errorf("Expected the app directory and the caches in the status to be removed; got %v, %v", err, instance.Status.ReposCache)
+	}
+}
+
+func TestRemoveAppDirKeepsArchives(t *testing.T) {
+	kfAppDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(kfAppDir)
+
+	archive := &bytes.Buffer{}
+	gz := gzip.NewWriter(archive)
+	tw := tar.NewWriter(gz)
+	contents := []byte("resources: []\n")
+	if err := tw.WriteHeader(&tar.Header{Name: "manifests/kustomization.yaml", Mode: 0644, Size: int64(len(contents))}); err != nil {
+		t.Fatalf("Failed to write the archive: %v", err)
+	}
+	_, _ = tw.Write(contents)
+	_ = tw.Close()
+	_ = gz.Close()
+
+	var statuses []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			statuses = append(statuses, http.StatusNotModified)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		statuses = append(statuses, http.StatusOK)
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write(archive.Bytes())
+	}))
+	defer server.Close()
+
+	instance := &kfdefappskubefloworgv1.KfDef{
+		ObjectMeta: metav1.ObjectMeta{Name: "kfdef", Namespace: "opendatahub"},
+		Spec: kfdefappskubefloworgv1.KfDefSpec{
+			Repos: []kfdefappskubefloworgv1.Repo{{Name: "manifests", URI: server.URL + "/manifests.tar.gz"}},
+		},
+	}
+	// Each reconcile removes the app directory and syncs the repos again.
+	for i := 0; i < 2; i++ {
+		if err := removeAppDir(kfAppDir, instance, nil); err != nil {
+			t.Fatalf("Reconcile %v: failed to remove the app directory: %v", i, err)
+		}
+		config, err := kfloaders.V1{}.LoadKfConfig(instance)
+		if err != nil {
+			t.Fatalf("Reconcile %v: failed to load the config: %v", i, err)
+		}
+		config.Spec.AppDir = kfAppDir
+		if err := config.SyncCache(); err != nil {
+			t.Fatalf("Reconcile %v: failed to sync the repos: %v", i, err)
+		}
+		instance.Status.ReposCache = nil
+		for _, cache := range config.Status.Caches {
+			instance.Status.ReposCache = append(instance.Status.ReposCache,
+				kfdefappskubefloworgv1.RepoCache{Name: cache.Name, LocalPath: cache.LocalPath})
+		}
+		if _, err := os.Stat(path.Join(kfAppDir, kfconfig.DefaultCacheDir, "manifests", "manifests", "kustomization.yaml")); err != nil {
+			t.Errorf("Reconcile %v: expected the archive to be unpacked: %v", i, err)
+		}
+	}
+	if !reflect.DeepEqual(statuses, []int{http.StatusOK, http.StatusNotModified}) {
+		t.Errorf("Expected the second reconcile to get a %v; got %v", http.StatusNotModified, statuses)
+	}
+}
@@ -0,0 +1,313 @@
+package kfdefappskubefloworg
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	kfdefappskubefloworgv1 "github.com/opendatahub-io/opendatahub-operator/apis/kfdef.apps.kubeflow.org/v1"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+)
+
+// DefaultRepoWatchDebounce is how long a RepoWatcher waits for the files of a repo to stop
+// changing before it triggers a reconcile.
+const DefaultRepoWatchDebounce = 500 * time.Millisecond
+
+// watchedKfDef is a KfDef whose local directory repos are watched.
+type watchedKfDef struct {
+	// repos maps the name of each local directory repo to its directory.
+	repos map[string]string
+	// generation is the generation of the KfDef rendered from the repos, or 0 if rendering
+	// failed and the next reconcile has to render every application.
+	generation int64
+	// changes maps the name of each changed repo to the paths changed in it, relative to its
+	// directory, since the last reconcile.
+	changes map[string][]string
+	timer   *time.Timer
+}
+
+// RepoWatcher watches the local directory repos of the KfDefs with fsnotify and triggers a
+// reconcile of a KfDef once the files of its repos stop changing. It's meant for manifest
+// authors iterating against a development cluster.
+type RepoWatcher struct {
+	debounce time.Duration
+	watcher  *fsnotify.Watcher
+	events   chan event.GenericEvent
+
+	mu      sync.Mutex
+	kfDefs  map[types.NamespacedName]*watchedKfDef
+	watched map[string]bool
+}
+
+// NewRepoWatcher returns a RepoWatcher triggering reconciles debounce after the last change.
+func NewRepoWatcher(debounce time.Duration) (*RepoWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &RepoWatcher{
+		debounce: debounce,
+		watcher:  watcher,
+		events:   make(chan event.GenericEvent, 16),
+		kfDefs:   map[types.NamespacedName]*watchedKfDef{},
+		watched:  map[string]bool{},
+	}, nil
+}
+
+// Events returns the channel the reconcile requests are sent to.
+func (w *RepoWatcher) Events() <-chan event.GenericEvent {
+	return w.events
+}
+
+// Start processes the file events until ctx is done.
+func (w *RepoWatcher) Start(ctx context.Context) error {
+	defer w.watcher.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			w.mu.Lock()
+			for _, kfDef := range w.kfDefs {
+				if kfDef.timer != nil {
+					kfDef.timer.Stop()
+				}
+			}
+			w.mu.Unlock()
+			return nil
+		case e, ok := <-w.watcher.Events:
+			if !ok {
+				return nil
+			}
+			w.handle(e)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			kfdefLog.Error(err, "error watching local repos")
+		}
+	}
+}
+
+// Watch watches the local directory repos of instance. rendered is false if the applications
+// of instance couldn't be rendered from the current content of the repos.
+func (w *RepoWatcher) Watch(instance *kfdefappskubefloworgv1.KfDef, rendered bool) {
+	if w == nil {
+		return
+	}
+	repos := map[string]string{}
+	for _, r := range instance.Spec.Repos {
+		if dir, ok := kfconfig.LocalRepoDir(r.URI); ok {
+			repos[r.Name] = dir
+		}
+	}
+
+	key := types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	kfDef, ok := w.kfDefs[key]
+	if !ok {
+		if len(repos) == 0 {
+			return
+		}
+		kfDef = &watchedKfDef{changes: map[string][]string{}}
+		w.kfDefs[key] = kfDef
+	}
+	kfDef.repos = repos
+	kfDef.generation = 0
+	if rendered {
+		kfDef.generation = instance.Generation
+	}
+	w.updateWatches()
+}
+
+// Unwatch stops watching the repos of the KfDef key.
+func (w *RepoWatcher) Unwatch(key types.NamespacedName) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if kfDef, ok := w.kfDefs[key]; ok {
+		if kfDef.timer != nil {
+			kfDef.timer.Stop()
+		}
+		delete(w.kfDefs, key)
+		w.updateWatches()
+	}
+}
+
+// TakeChanges returns the paths changed in each repo of instance since its last reconcile and
+// forgets them. It returns nil unless the changes are all that needs to be rendered again,
+// i.e. instance wasn't modified since its applications were last rendered.
+func (w *RepoWatcher) TakeChanges(instance *kfdefappskubefloworgv1.KfDef) map[string][]string {
+	if w == nil {
+		return nil
+	}
+	key := types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	kfDef, ok := w.kfDefs[key]
+	if !ok || len(kfDef.changes) == 0 {
+		return nil
+	}
+	changes := kfDef.changes
+	kfDef.changes = map[string][]string{}
+	if kfDef.generation == 0 || kfDef.generation != instance.Generation {
+		return nil
+	}
+	return changes
+}
+
+// updateWatches watches every directory of the watched repos and no other. w.mu must be held.
+func (w *RepoWatcher) updateWatches() {
+	dirs := map[string]bool{}
+	for _, kfDef := range w.kfDefs {
+		for _, root := range kfDef.repos {
+			for _, dir := range repoDirs(root) {
+				dirs[dir] = true
+			}
+		}
+	}
+	for dir := range w.watched {
+		if !dirs[dir] {
+			// The directory may have been removed, which removes its watch.
+			_ = w.watcher.Remove(dir)
+			delete(w.watched, dir)
+		}
+	}
+	for dir := range dirs {
+		w.addWatch(dir)
+	}
+}
+
+// addWatch watches dir unless it's already watched. w.mu must be held.
+func (w *RepoWatcher) addWatch(dir string) {
+	if w.watched[dir] {
+		return
+	}
+	if err := w.watcher.Add(dir); err != nil {
+		kfdefLog.Error(err, "failed to watch local repo directory", "dir", dir)
+		return
+	}
+	w.watched[dir] = true
+}
+
+// handle records a file event against the KfDefs whose repos contain it and (re)starts their
+// debounce timers.
+func (w *RepoWatcher) handle(e fsnotify.Event) {
+	if e.Op == fsnotify.Chmod {
+		return
+	}
+	name := filepath.Clean(e.Name)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if e.Has(fsnotify.Create) {
+		if fi, err := os.Stat(name); err == nil && fi.IsDir() && !isVCSDir(name) {
+			// fsnotify isn't recursive; new directories have to be watched too.
+			for _, dir := range repoDirs(name) {
+				w.addWatch(dir)
+			}
+		}
+	}
+	if e.Has(fsnotify.Remove) || e.Has(fsnotify.Rename) {
+		delete(w.watched, name)
+	}
+
+	for key, kfDef := range w.kfDefs {
+		for repo, root := range kfDef.repos {
+			rel, err := filepath.Rel(root, name)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || isVCSDir(rel) {
+				continue
+			}
+			kfDef.changes[repo] = append(kfDef.changes[repo], filepath.ToSlash(rel))
+			w.schedule(key, kfDef)
+		}
+	}
+}
+
+// schedule triggers a reconcile of the KfDef key once its repos stopped changing for
+// w.debounce. w.mu must be held.
+func (w *RepoWatcher) schedule(key types.NamespacedName, kfDef *watchedKfDef) {
+	if kfDef.timer != nil {
+		kfDef.timer.Stop()
+	}
+	instance := &kfdefappskubefloworgv1.KfDef{}
+	instance.SetName(key.Name)
+	instance.SetNamespace(key.Namespace)
+	kfDef.timer = time.AfterFunc(w.debounce, func() {
+		kfdefLog.Info("Local repos changed; reconciling", "instance", key.Name, "namespace", key.Namespace)
+		w.events <- event.GenericEvent{Object: instance}
+	})
+}
+
+// repoDirs returns root and the directories below it, except those of version control systems.
+func repoDirs(root string) []string {
+	var dirs []string
+	_ = filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() {
+			return nil
+		}
+		if p != root && isVCSDir(p) {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, p)
+		return nil
+	})
+	return dirs
+}
+
+// isVCSDir returns true if p is in a .git directory, whose content doesn't affect the manifests.
+func isVCSDir(p string) bool {
+	for _, elem := range strings.Split(filepath.ToSlash(p), "/") {
+		if elem == ".git" {
+			return true
+		}
+	}
+	return false
+}
+
+// affectedApplications returns the kustomize applications of instance whose files are among
+// the changes of a RepoWatcher.
+func affectedApplications(instance *kfdefappskubefloworgv1.KfDef, changes map[string][]string) []string {
+	var apps []string
+	for _, app := range instance.Spec.Applications {
+		if app.KustomizeConfig == nil || app.KustomizeConfig.RepoRef == nil {
+			continue
+		}
+		appPath := path.Clean(app.KustomizeConfig.RepoRef.Path)
+		for _, changed := range changes[app.KustomizeConfig.RepoRef.Name] {
+			if appPath == "." || changed == appPath || strings.HasPrefix(changed, appPath+"/") ||
+				strings.HasPrefix(appPath, changed+"/") {
+				apps = append(apps, app.Name)
+				break
+			}
+		}
+	}
+	return apps
+}
+
+// invalidateChangedRepos removes the caches of the changed repos of instance and the rendered
+// applications affected by the changes from kfAppDir, so that the next apply copies the repos
+// again and only renders these applications again.
+func invalidateChangedRepos(kfAppDir string, instance *kfdefappskubefloworgv1.KfDef, changes map[string][]string) error {
+	for repo := range changes {
+		if err := os.RemoveAll(path.Join(kfAppDir, kfconfig.DefaultCacheDir, repo)); err != nil {
+			return err
+		}
+	}
+	for _, app := range affectedApplications(instance, changes) {
+		kfdefLog.Info("Rendering application again", "application", app, "instance", instance.Name)
+		if err := os.RemoveAll(path.Join(kfAppDir, kfconfig.KustomizeDir, app)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package kfdefappskubefloworg
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	kfdefappskubefloworgv1 "github.com/opendatahub-io/opendatahub-operator/apis/kfdef.apps.kubeflow.org/v1"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+)
+
+func newWatchedKfDef(repoDir string) *kfdefappskubefloworgv1.KfDef {
+	app := func(name, appPath string) kfdefappskubefloworgv1.Application {
+		return kfdefappskubefloworgv1.Application{
+			Name: name,
+			KustomizeConfig: &kfdefappskubefloworgv1.KustomizeConfig{
+				RepoRef: &kfdefappskubefloworgv1.RepoRef{Name: "manifests", Path: appPath},
+			},
+		}
+	}
+	return &kfdefappskubefloworgv1.KfDef{
+		ObjectMeta: metav1.ObjectMeta{Name: "odh", Namespace: "opendatahub", Generation: 1},
+		Spec: kfdefappskubefloworgv1.KfDefSpec{
+			Applications: []kfdefappskubefloworgv1.Application{
+				app("dashboard", "odh-dashboard"),
+				app("notebooks", "jupyterhub/notebooks"),
+				app("jupyterhub", "jupyterhub"),
+			},
+			Repos: []kfdefappskubefloworgv1.Repo{
+				{Name: "manifests", URI: repoDir},
+				{Name: "remote", URI: "https://github.com/opendatahub-io/odh-manifests/tarball/master"},
+			},
+		},
+	}
+}
+
+func TestRepoWatcher(t *testing.T) {
+	defer func(l logr.Logger) { kfdefLog = l }(kfdefLog)
+	kfdefLog = logr.Discard()
+
+	repoDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(repoDir)
+	for _, dir := range []string{"odh-dashboard/base", "jupyterhub/notebooks", ".git"} {
+		if err := os.MkdirAll(path.Join(repoDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %v: %v", dir, err)
+		}
+	}
+
+	w, err := NewRepoWatcher(100 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to create the watcher: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	// The watcher is stopped before the logger is restored and the repo removed.
+	stopped := make(chan struct{})
+	go func() {
+		_ = w.Start(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	instance := newWatchedKfDef(repoDir)
+	w.Watch(instance, true)
+	write := func(file string) {
+		if err := ioutil.WriteFile(path.Join(repoDir, file), []byte(file), 0644); err != nil {
+			t.Fatalf("Failed to write %v: %v", file, err)
+		}
+	}
+	expectReconcile := func(expected bool) {
+		select {
+		case e := <-w.Events():
+			if !expected {
+				t.Errorf("Expected no reconcile; got %v", e.Object.GetName())
+			} else if e.Object.GetName() != "odh" || e.Object.GetNamespace() != "opendatahub" {
+				t.Errorf("Expected a reconcile of opendatahub/odh; got %v/%v", e.Object.GetNamespace(), e.Object.GetName())
+			}
+		case <-time.After(time.Second):
+			if expected {
+				t.Errorf("Expected a reconcile")
+			}
+		}
+	}
+
+	// Changes in quick succession trigger a single reconcile.
+	write("odh-dashboard/base/kustomization.yaml")
+	write("odh-dashboard/base/params.env")
+	write(".git/index")
+	expectReconcile(true)
+	expectReconcile(false)
+	changes := w.TakeChanges(instance)
+	if apps := affectedApplications(instance, changes); !reflect.DeepEqual(apps, []string{"dashboard"}) {
+		t.Errorf("Expected dashboard to be affected by %v; got %v", changes, apps)
+	}
+	if changes := w.TakeChanges(instance); changes != nil {
+		t.Errorf("Expected the changes to be taken once; got %v", changes)
+	}
+
+	// Files in new directories are watched too.
+	if err := os.MkdirAll(path.Join(repoDir, "jupyterhub/notebooks/overlays"), 0755); err != nil {
+		t.Fatalf("Failed to create overlays: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	write("jupyterhub/notebooks/overlays/params.env")
+	expectReconcile(true)
+	apps := affectedApplications(instance, w.TakeChanges(instance))
+	sort.Strings(apps)
+	if !reflect.DeepEqual(apps, []string{"jupyterhub", "notebooks"}) {
+		t.Errorf("Expected jupyterhub and notebooks to be affected; got %v", apps)
+	}
+
+	// Changes to a modified KfDef, or one which failed to render, are rendered from scratch.
+	write("odh-dashboard/base/params.env")
+	expectReconcile(true)
+	instance.Generation = 2
+	if changes := w.TakeChanges(instance); changes != nil {
+		t.Errorf("Expected no changes for a modified KfDef; got %v", changes)
+	}
+	w.Watch(instance, false)
+	write("odh-dashboard/base/params.env")
+	expectReconcile(true)
+	if changes := w.TakeChanges(instance); changes != nil {
+		t.Errorf("Expected no changes for a KfDef which failed to render; got %v", changes)
+	}
+
+	w.Unwatch(types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace})
+	write("odh-dashboard/base/params.env")
+	expectReconcile(false)
+}
+
+func TestInvalidateChangedRepos(t *testing.T) {
+	defer func(l logr.Logger) { kfdefLog = l }(kfdefLog)
+	kfdefLog = logr.Discard()
+
+	kfAppDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(kfAppDir)
+	dirs := []string{
+		path.Join(kfconfig.DefaultCacheDir, "manifests"),
+		path.Join(kfconfig.DefaultCacheDir, "remote"),
+		path.Join(kfconfig.KustomizeDir, "dashboard"),
+		path.Join(kfconfig.KustomizeDir, "notebooks"),
+		path.Join(kfconfig.KustomizeDir, "jupyterhub"),
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(path.Join(kfAppDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %v: %v", dir, err)
+		}
+	}
+
+	instance := newWatchedKfDef(kfAppDir)
+	if err := invalidateChangedRepos(kfAppDir, instance, map[string][]string{"manifests": {"jupyterhub/notebooks/params.env"}}); err != nil {
+		t.Fatalf("Failed to invalidate the changed repos: %v", err)
+	}
+	for i, dir := range dirs {
+		_, err := os.Stat(path.Join(kfAppDir, dir))
+		if removed := i == 0 || i >= 3; removed != os.IsNotExist(err) {
+			t.Errorf("Expected %v to be removed: %v; got %v", dir, removed, err)
+		}
+	}
+}
@@ -2,9 +2,12 @@ package kfdefappskubefloworg
 
 import (
 	"context"
+	"path"
 	"reflect"
 
 	kfdefv1 "github.com/opendatahub-io/opendatahub-operator/apis/kfdef.apps.kubeflow.org/v1"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+	kfloaders "github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig/loaders"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 )
@@ -47,6 +50,22 @@ func getReconcileStatus(cr *kfdefv1.KfDef, err error) error {
 			Reason:         err.Error(),
 			Type:           kfdefv1.KfDegraded,
 		})
+		if kfconfig.IsRepoVerificationError(err) {
+			conditions = append(conditions, kfdefv1.KfDefCondition{
+				LastUpdateTime: cr.CreationTimestamp,
+				Status:         corev1.ConditionTrue,
+				Reason:         err.Error(),
+				Type:           kfdefv1.KfRepoVerificationFailed,
+			})
+		}
+		if kfconfig.IsInvalidParamsError(err) {
+			conditions = append(conditions, kfdefv1.KfDefCondition{
+				LastUpdateTime: cr.CreationTimestamp,
+				Status:         corev1.ConditionTrue,
+				Reason:         err.Error(),
+				Type:           kfdefv1.KfInvalidParameters,
+			})
+		}
 	}
 
 	conditions = append(conditions, kfdefv1.KfDefCondition{
@@ -60,3 +79,62 @@ func getReconcileStatus(cr *kfdefv1.KfDef, err error) error {
 
 	return err
 }
+
+// setReposCacheStatus copies the repo caches recorded by SyncCache in the config file of the
+// kfApp, including the commit each git repo resolved to, the overlays selected by Generate and
+// the outputs read by Apply into the status of cr.
+func setReposCacheStatus(cr *kfdefv1.KfDef) {
+	configFilePath := path.Join("/tmp", cr.GetNamespace(), cr.GetName(), "config.yaml")
+	config, err := kfloaders.LoadConfigFromURI(configFilePath)
+	if err != nil {
+		kfdefLog.Error(err, "failed to load the repo caches", "uri", configFilePath)
+		return
+	}
+	var reposCache []kfdefv1.RepoCache
+	for _, cache := range config.Status.Caches {
+		reposCache = append(reposCache, kfdefv1.RepoCache{
+			Name:      cache.Name,
+			LocalPath: cache.LocalPath,
+			Revision:  cache.Revision,
+		})
+	}
+	cr.Status.ReposCache = reposCache
+	var overlays []kfdefv1.ApplicationOverlays
+	for _, o := range config.Status.Overlays {
+		overlays = append(overlays, kfdefv1.ApplicationOverlays{Name: o.Name, Overlays: o.Overlays})
+	}
+	cr.Status.Overlays = overlays
+	var outputs []kfdefv1.ApplicationOutputs
+	for _, o := range config.Status.Outputs {
+		var values []kfdefv1.NameValue
+		for _, nv := range o.Values {
+			values = append(values, kfdefv1.NameValue{Name: nv.Name, Value: nv.Value})
+		}
+		outputs = append(outputs, kfdefv1.ApplicationOutputs{Name: o.Name, Values: values})
+	}
+	cr.Status.Outputs = outputs
+}
+
+// setDeploymentConfigMigrationStatus copies the DeploymentConfigMigrationPending condition recorded
+// by Apply in the config file of the kfApp into the status of cr. It returns true while the
+// migration is pending, so that the KfDef is reconciled again to finish it.
+func setDeploymentConfigMigrationStatus(cr *kfdefv1.KfDef) bool {
+	configFilePath := path.Join("/tmp", cr.GetNamespace(), cr.GetName(), "config.yaml")
+	config, err := kfloaders.LoadConfigFromURI(configFilePath)
+	if err != nil {
+		kfdefLog.Error(err, "failed to load the DeploymentConfig migration status", "uri", configFilePath)
+		return false
+	}
+	cond, err := config.GetCondition(kfconfig.DeploymentConfigMigrationPending)
+	if err != nil || cond.Status != corev1.ConditionTrue {
+		return false
+	}
+	cr.Status.Conditions = append(cr.Status.Conditions, kfdefv1.KfDefCondition{
+		LastUpdateTime: cr.CreationTimestamp,
+		Status:         corev1.ConditionTrue,
+		Reason:         cond.Reason,
+		Message:        cond.Message,
+		Type:           kfdefv1.KfDeploymentConfigMigrationPending,
+	})
+	return true
+}
@@ -0,0 +1,68 @@
+package kfdefappskubefloworg
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	kfdefv1 "github.com/opendatahub-io/opendatahub-operator/apis/kfdef.apps.kubeflow.org/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetDeploymentConfigMigrationStatus(t *testing.T) {
+	// The config file of a kfApp is /tmp/<namespace>/<name>/config.yaml.
+	namespaceDir, err := ioutil.TempDir("/tmp", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(namespaceDir)
+	if err := os.MkdirAll(path.Join(namespaceDir, "odh"), 0755); err != nil {
+		t.Fatalf("Failed to create the app directory: %v", err)
+	}
+
+	type testCase struct {
+		Name     string
+		Status   corev1.ConditionStatus
+		Expected bool
+	}
+	testCases := []testCase{
+		{Name: "pending", Status: corev1.ConditionTrue, Expected: true},
+		{Name: "migrated", Status: corev1.ConditionFalse},
+	}
+	for _, c := range testCases {
+		config := &kfdefv1.KfDef{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "kfdef.apps.kubeflow.org/v1", Kind: "KfDef"},
+			ObjectMeta: metav1.ObjectMeta{Name: "odh", Namespace: path.Base(namespaceDir)},
+			Status: kfdefv1.KfDefStatus{
+				Conditions: []kfdefv1.KfDefCondition{{
+					Type:    kfdefv1.KfDeploymentConfigMigrationPending,
+					Status:  c.Status,
+					Reason:  "DeploymentsNotAvailable",
+					Message: "waiting for the Deployments replacing DeploymentConfigs opendatahub/mariadb to be available",
+				}},
+			},
+		}
+		data, err := yaml.Marshal(config)
+		if err != nil {
+			t.Fatalf("Case %v: failed to marshal the config: %v", c.Name, err)
+		}
+		if err := ioutil.WriteFile(path.Join(namespaceDir, "odh", "config.yaml"), data, 0644); err != nil {
+			t.Fatalf("Case %v: failed to write the config: %v", c.Name, err)
+		}
+
+		instance := &kfdefv1.KfDef{ObjectMeta: config.ObjectMeta}
+		if pending := setDeploymentConfigMigrationStatus(instance); pending != c.Expected {
+			t.Errorf("Case %v: expected pending %v; got %v", c.Name, c.Expected, pending)
+		}
+		if c.Expected {
+			if len(instance.Status.Conditions) != 1 || instance.Status.Conditions[0].Message != config.Status.Conditions[0].Message {
+				t.Errorf("Case %v: expected the pending condition in the status; got %v", c.Name, instance.Status.Conditions)
+			}
+		} else if len(instance.Status.Conditions) != 0 {
+			t.Errorf("Case %v: expected no condition in the status; got %v", c.Name, instance.Status.Conditions)
+		}
+	}
+}
@@ -35,6 +35,9 @@ var secGenLog = log.Log.WithName("secret-generator")
 type SecretGeneratorReconciler struct {
 	Client client.Client
 	Scheme *runtime.Scheme
+	// DisableOAuthClients skips the OAuthClients of the secrets, on clusters without the
+	// OpenShift Route or OAuthClient APIs.
+	DisableOAuthClients bool
 }
 
 func (r *SecretGeneratorReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -82,9 +85,11 @@ func (r *SecretGeneratorReconciler) Reconcile(ctx context.Context, request ctrl.
 	foundSecret := &v1.Secret{}
 	err := r.Client.Get(context.TODO(), request.NamespacedName, foundSecret)
 	if err != nil {
-		if k8serrors.IsNotFound(err) {
+		if k8serrors.IsNotFound(err) && !r.DisableOAuthClients {
 			// If Secret is deleted, delete OAuthClient if exists
 			err = r.deleteOAuthClient(request.Name)
+		} else if k8serrors.IsNotFound(err) {
+			err = nil
 		}
 		return ctrl.Result{}, err
 	}
@@ -125,7 +130,10 @@ func (r *SecretGeneratorReconciler) Reconcile(ctx context.Context, request ctrl.
 			if err != nil {
 				return ctrl.Result{}, err
 			}
-			if secret.OAuthClientRoute != "" {
+			if secret.OAuthClientRoute != "" && r.DisableOAuthClients {
+				secGenLog.Info("OAuth clients are disabled on this cluster; not generating one for route",
+					"route-name", secret.OAuthClientRoute)
+			} else if secret.OAuthClientRoute != "" {
 				// Get OauthClient Route
 				oauthClientRoute, err := r.getRoute(secret.OAuthClientRoute, request.Namespace)
 				if err != nil {
@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"github.com/opendatahub-io/opendatahub-operator/controllers/secretgenerator"
 	ocv1 "github.com/openshift/api/oauth/v1"
@@ -39,12 +40,16 @@ import (
 	netv1 "k8s.io/api/networking/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	awspluginskubefloworgv1alpha1 "github.com/opendatahub-io/opendatahub-operator/apis/aws.plugins.kubeflow.org/v1alpha1"
 	gcppluginskubefloworgv1alpha1 "github.com/opendatahub-io/opendatahub-operator/apis/gcp.plugins.kubeflow.org/v1alpha1"
@@ -52,6 +57,7 @@ import (
 	kfdefappskubefloworgv1 "github.com/opendatahub-io/opendatahub-operator/apis/kfdef.apps.kubeflow.org/v1"
 	kfupdateappskubefloworgv1alpha1 "github.com/opendatahub-io/opendatahub-operator/apis/kfupdate.apps.kubeflow.org/v1alpha1"
 	kfdefappskubefloworg "github.com/opendatahub-io/opendatahub-operator/controllers/kfdef.apps.kubeflow.org"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -90,11 +96,22 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var repoCacheDir string
+	var repoCacheMaxSize string
+	var watchLocalRepos bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&repoCacheDir, "repo-cache-dir", "",
+		"The directory, e.g. the mount path of a PersistentVolumeClaim, of a repo cache shared by all KfDefs. "+
+			"Each KfDef caches its repos in its own directory when empty.")
+	flag.StringVar(&repoCacheMaxSize, "repo-cache-max-size", "2Gi",
+		"The size above which repos no KfDef uses are removed from the shared repo cache.")
+	flag.BoolVar(&watchLocalRepos, "watch-local-repos", false,
+		"Development mode: watch the repos which are local directories and reconcile a KfDef when their files change, "+
+			"rendering only the applications affected by the changes.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -103,6 +120,19 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if repoCacheDir != "" {
+		maxSize, err := resource.ParseQuantity(repoCacheMaxSize)
+		if err != nil {
+			setupLog.Error(err, "invalid repo cache max size")
+			os.Exit(1)
+		}
+		if err := kfconfig.EnableSharedCache(repoCacheDir, maxSize.Value()); err != nil {
+			setupLog.Error(err, "unable to set up the shared repo cache")
+			os.Exit(1)
+		}
+		metrics.Registry.MustRegister(kfconfig.SharedCacheMetrics()...)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -127,12 +157,51 @@ func main() {
 		os.Exit(1)
 	}
 
+	var repoWatcher *kfdefappskubefloworg.RepoWatcher
+	if watchLocalRepos {
+		if repoWatcher, err = kfdefappskubefloworg.NewRepoWatcher(kfdefappskubefloworg.DefaultRepoWatchDebounce); err != nil {
+			setupLog.Error(err, "unable to watch local repos")
+			os.Exit(1)
+		}
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create the discovery client")
+		os.Exit(1)
+	}
+
+	capabilities, err := kfdefappskubefloworg.DetectCapabilities(discoveryClient, setupLog)
+	if err != nil {
+		setupLog.Error(err, "unable to detect the capabilities of the cluster")
+		os.Exit(1)
+	}
+	if disabled := capabilities.Disabled(); len(disabled) > 0 {
+		setupLog.Info("OpenShift APIs not found; capabilities disabled", "capabilities", disabled)
+	}
+	if namespace := os.Getenv("OPERATOR_NAMESPACE"); namespace != "" {
+		if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			if err := capabilities.Publish(ctx, mgr.GetClient(), namespace); err != nil {
+				setupLog.Error(err, "unable to publish the capabilities of the cluster")
+			}
+			return nil
+		})); err != nil {
+			setupLog.Error(err, "unable to publish the capabilities of the cluster")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&kfdefappskubefloworg.KfDefReconciler{
-		Client:     mgr.GetClient(),
-		Scheme:     mgr.GetScheme(),
-		RestConfig: mgr.GetConfig(),
-		Recorder:   mgr.GetEventRecorderFor("kfdef-controller"),
-		Log:        ctrl.Log.WithName("controllers").WithName("KfDef"),
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		RestConfig:  mgr.GetConfig(),
+		Recorder:    mgr.GetEventRecorderFor("kfdef-controller"),
+		Log:         ctrl.Log.WithName("controllers").WithName("KfDef"),
+		RepoWatcher: repoWatcher,
+		RepoUpdates: kfdefappskubefloworg.NewRepoUpdateChecker(kfdefappskubefloworg.DefaultRepoUpdateCheckPeriod),
+		ClusterFacts: kfdefappskubefloworg.NewClusterFactsCollector(mgr.GetAPIReader(), discoveryClient,
+			kfdefappskubefloworg.DefaultClusterFactsTTL),
+		Capabilities: capabilities,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KfDef")
 		os.Exit(1)
@@ -141,6 +210,8 @@ func main() {
 	if err = (&secretgenerator.SecretGeneratorReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
+		DisableOAuthClients: !capabilities.Has(kfdefappskubefloworg.CapabilityRoutes) ||
+			!capabilities.Has(kfdefappskubefloworg.CapabilityOAuthClients),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SecretGenerator")
 		os.Exit(1)
@@ -21,6 +21,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	kfapis "github.com/opendatahub-io/opendatahub-operator/apis"
@@ -28,6 +29,7 @@ import (
 	"github.com/opendatahub-io/opendatahub-operator/pkg/kfapp/aws"
 	"github.com/opendatahub-io/opendatahub-operator/pkg/kfapp/existing_arrikto"
 	"github.com/opendatahub-io/opendatahub-operator/pkg/kfapp/gcp"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfapp/helm"
 	"github.com/opendatahub-io/opendatahub-operator/pkg/kfapp/kustomize"
 	"github.com/opendatahub-io/opendatahub-operator/pkg/kfapp/minikube"
 	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
@@ -78,6 +80,9 @@ func (coord *coordinator) getPackageManagers(kfdef *kfconfig.KfConfig) *map[stri
 	if _packagemanager != nil {
 		packagemanagers[kftypesv3.KUSTOMIZE] = _packagemanager
 	}
+	if helm.UsesHelm(kfdef) {
+		packagemanagers[kftypesv3.HELM] = helm.GetKfApp(kfdef)
+	}
 	return &packagemanagers
 }
 
@@ -226,6 +231,9 @@ func NewLoadKfAppFromURI(configFile string) (kftypesv3.KfApp, error) {
 	if pkg != nil {
 		c.PackageManagers[kftypesv3.KUSTOMIZE] = pkg
 	}
+	if helm.UsesHelm(c.KfDef) {
+		c.PackageManagers[kftypesv3.HELM] = helm.GetKfApp(c.KfDef)
+	}
 
 	initErr := c.Init(kftypesv3.ALL)
 	if initErr != nil {
@@ -323,8 +331,35 @@ func (kfapp *coordinator) GetPlugin(name string) (kftypesv3.KfApp, bool) {
 	return r, ok
 }
 
+// packageManagerOrder is the order in which the package managers run. Kustomize goes first
+// since its applications usually install the namespaces and operators that charts rely on.
+var packageManagerOrder = []string{kftypesv3.KUSTOMIZE, kftypesv3.HELM}
+
+// packageManagerNames returns the names of the package managers in packageManagerOrder followed
+// by any others sorted by name, so that applications are applied in the same order on every
+// reconcile rather than in the random order of iterating over PackageManagers.
+func (kfapp *coordinator) packageManagerNames() []string {
+	names := []string{}
+	ordered := map[string]bool{}
+	for _, name := range packageManagerOrder {
+		ordered[name] = true
+		if _, ok := kfapp.PackageManagers[name]; ok {
+			names = append(names, name)
+		}
+	}
+	others := []string{}
+	for name := range kfapp.PackageManagers {
+		if !ordered[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	return append(names, others...)
+}
+
 func (kfapp *coordinator) Dump(resources kftypesv3.ResourceEnum) error {
-	for packageManagerName, packageManager := range kfapp.PackageManagers {
+	for _, packageManagerName := range kfapp.packageManagerNames() {
+		packageManager := kfapp.PackageManagers[packageManagerName]
 		err := packageManager.Dump(kftypesv3.K8S)
 		if err != nil {
 			return &kfapis.KfError{
@@ -362,7 +397,8 @@ func (kfapp *coordinator) Apply(resources kftypesv3.ResourceEnum) error {
 	}
 
 	k8s := func() error {
-		for packageManagerName, packageManager := range kfapp.PackageManagers {
+		for _, packageManagerName := range kfapp.packageManagerNames() {
+			packageManager := kfapp.PackageManagers[packageManagerName]
 			packageManagerErr := packageManager.Apply(kftypesv3.K8S)
 			if packageManagerErr != nil {
 				return &kfapis.KfError{
@@ -407,6 +443,7 @@ func (kfapp *coordinator) Apply(resources kftypesv3.ResourceEnum) error {
 		return &kfapis.KfError{
 			Code:    int(kfapis.INTERNAL_ERROR),
 			Message: fmt.Sprintf("could not sync cache. Error: %v", err),
+			Err:     err,
 		}
 	}
 
@@ -457,7 +494,11 @@ func (kfapp *coordinator) Delete(resources kftypesv3.ResourceEnum) error {
 	}
 
 	k8s := func() error {
-		for packageManagerName, packageManager := range kfapp.PackageManagers {
+		// Package managers are deleted in the reverse order they were applied in.
+		names := kfapp.packageManagerNames()
+		for i := len(names) - 1; i >= 0; i-- {
+			packageManagerName := names[i]
+			packageManager := kfapp.PackageManagers[packageManagerName]
 			packageManagerErr := packageManager.Delete(kftypesv3.K8S)
 			if packageManagerErr != nil {
 				return &kfapis.KfError{
@@ -474,6 +515,7 @@ func (kfapp *coordinator) Delete(resources kftypesv3.ResourceEnum) error {
 		return &kfapis.KfError{
 			Code:    int(kfapis.INTERNAL_ERROR),
 			Message: fmt.Sprintf("could not sync cache. Error: %v", err),
+			Err:     err,
 		}
 	}
 
@@ -535,7 +577,8 @@ func (kfapp *coordinator) Generate(resources kftypesv3.ResourceEnum) error {
 	}
 
 	k8s := func() error {
-		for packageManagerName, packageManager := range kfapp.PackageManagers {
+		for _, packageManagerName := range kfapp.packageManagerNames() {
+			packageManager := kfapp.PackageManagers[packageManagerName]
 			packageManagerErr := packageManager.Generate(kftypesv3.K8S)
 			if packageManagerErr != nil {
 				return &kfapis.KfError{
@@ -555,6 +598,7 @@ func (kfapp *coordinator) Generate(resources kftypesv3.ResourceEnum) error {
 		return &kfapis.KfError{
 			Code:    int(kfapis.INTERNAL_ERROR),
 			Message: fmt.Sprintf("could not sync cache. Error: %v", err),
+			Err:     err,
 		}
 	}
 
@@ -605,7 +649,8 @@ func (kfapp *coordinator) Init(resources kftypesv3.ResourceEnum) error {
 	}
 
 	k8s := func() error {
-		for packageManagerName, packageManager := range kfapp.PackageManagers {
+		for _, packageManagerName := range kfapp.packageManagerNames() {
+			packageManager := kfapp.PackageManagers[packageManagerName]
 			packageManagerErr := packageManager.Init(kftypesv3.K8S)
 			if packageManagerErr != nil {
 				return &kfapis.KfError{
@@ -665,7 +710,8 @@ func (kfapp *coordinator) Show(resources kftypesv3.ResourceEnum) error {
 					kfapp.KfDef.Spec.Platform),
 			}
 		}
-		for packageManagerName, packageManager := range kfapp.PackageManagers {
+		for _, packageManagerName := range kfapp.packageManagerNames() {
+			packageManager := kfapp.PackageManagers[packageManagerName]
 			show, ok := packageManager.(kftypesv3.KfShow)
 			if ok && show != nil {
 				showErr := show.Show(kftypesv3.K8S)
@@ -170,6 +170,24 @@ func Test_nameFromAppFile(t *testing.T) {
 	}
 }
 
+func Test_packageManagerNames(t *testing.T) {
+	kfapp := &coordinator{
+		PackageManagers: map[string]kftypesv3.KfApp{
+			"zeta":              nil,
+			kftypesv3.HELM:      nil,
+			"alpha":             nil,
+			kftypesv3.KUSTOMIZE: nil,
+		},
+	}
+	expected := []string{kftypesv3.KUSTOMIZE, kftypesv3.HELM, "alpha", "zeta"}
+	// Map iteration is random so check the order a few times.
+	for i := 0; i < 10; i++ {
+		if actual := kfapp.packageManagerNames(); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("Expected package managers %v; got %v", expected, actual)
+		}
+	}
+}
+
 // Pformat returns a pretty format output of any value.
 func Pformat(value interface{}) (string, error) {
 	if s, ok := value.(string); ok {
@@ -0,0 +1,472 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	kfapisv3 "github.com/opendatahub-io/opendatahub-operator/apis"
+	kftypesv3 "github.com/opendatahub-io/opendatahub-operator/apis/apps"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfapp/kustomize"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	errutil "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/kunstruct"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/transformer"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/kustomize/v3/pkg/resource"
+)
+
+const (
+	// defaultValuesKey is the ConfigMap or Secret key read by a ValuesReference without a key.
+	defaultValuesKey = "values.yaml"
+	notesFileSuffix  = "NOTES.txt"
+)
+
+// helm implements the KfApp interface for applications with a HelmConfig.
+// Charts are rendered in-process; neither tiller nor the helm binary are needed.
+type helm struct {
+	kfDef      *kfconfig.KfConfig
+	restConfig *rest.Config
+	// when set to true, Apply will skip local kube config, directly build config from restConfig
+	configOverwrite bool
+	// kubeClient reads the ConfigMaps and Secrets referenced by valuesFrom.
+	kubeClient kubernetes.Interface
+}
+
+// GetKfApp is the common entry point for all implementations of the KfApp interface
+func GetKfApp(kfdef *kfconfig.KfConfig) kftypesv3.KfApp {
+	return &helm{
+		kfDef: kfdef,
+	}
+}
+
+// UsesHelm returns true if any application of kfdef is rendered from a Helm chart.
+func UsesHelm(kfdef *kfconfig.KfConfig) bool {
+	for _, app := range kfdef.Spec.Applications {
+		if app.HelmConfig != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *helm) SetK8sRestConfig(r *rest.Config) {
+	h.restConfig = r
+	h.configOverwrite = true
+}
+
+// initK8sClients initializes the K8s clients if they haven't already been initialized.
+func (h *helm) initK8sClients() error {
+	if h.restConfig == nil {
+		log.Infof("Initializing a default restConfig for Kubernetes")
+		h.restConfig = kftypesv3.GetConfig()
+	}
+	if h.kubeClient == nil {
+		kubeClient, err := kubernetes.NewForConfig(h.restConfig)
+		if err != nil {
+			return err
+		}
+		h.kubeClient = kubeClient
+	}
+	return nil
+}
+
+func (h *helm) Init(resources kftypesv3.ResourceEnum) error {
+	return nil
+}
+
+// Generate checks that the chart of every helm application can be loaded.
+func (h *helm) Generate(resources kftypesv3.ResourceEnum) error {
+	switch resources {
+	case kftypesv3.PLATFORM:
+		return nil
+	}
+	for _, app := range h.kfDef.Spec.Applications {
+		if app.HelmConfig == nil {
+			continue
+		}
+		log.Infof("Processing helm application: %v", app.Name)
+		if _, err := h.loadChart(app); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dump prints the resources rendered from the helm charts to stdout
+func (h *helm) Dump(resources kftypesv3.ResourceEnum) error {
+	for _, app := range h.kfDef.Spec.Applications {
+		if app.HelmConfig == nil {
+			continue
+		}
+		data, err := h.render(app)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		fmt.Println("---")
+	}
+	return nil
+}
+
+// Apply deploys the resources rendered from the helm charts to the kubernetes api server
+func (h *helm) Apply(resources kftypesv3.ResourceEnum) error {
+	var restConfig *rest.Config = nil
+	if h.configOverwrite && h.restConfig != nil {
+		restConfig = h.restConfig
+	}
+	for _, app := range h.kfDef.Spec.Applications {
+		if app.HelmConfig == nil {
+			continue
+		}
+		apply, err := utils.NewApply(h.namespace(app), restConfig)
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Deploying helm application %v", app.Name)
+		data, err := h.render(app)
+		if err != nil {
+			return err
+		}
+		if err := kustomize.ApplyApplication(apply, app.Name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete deletes the resources rendered from the helm charts in reverse application order.
+func (h *helm) Delete(resources kftypesv3.ResourceEnum) error {
+	annotations := h.kfDef.GetAnnotations()
+	byOperator := false
+	if byOperatorAnn, ok := annotations[strings.Join([]string{utils.KfDefAnnotation, utils.InstallByOperator}, "/")]; ok {
+		if byOperatorAnnBol, err := strconv.ParseBool(byOperatorAnn); err == nil {
+			byOperator = byOperatorAnnBol
+		}
+	}
+
+	if err := h.initK8sClients(); err != nil {
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("helm plugin couldn't initialize a K8s client: %v", err),
+		}
+	}
+	kubeclient, err := client.New(h.restConfig, client.Options{})
+	if err != nil {
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("error initializing k8s client: %v", err),
+		}
+	}
+
+	errList := []error{}
+	for idx := range h.kfDef.Spec.Applications {
+		app := h.kfDef.Spec.Applications[len(h.kfDef.Spec.Applications)-1-idx]
+		if app.HelmConfig == nil {
+			continue
+		}
+		log.Infof("Deleting helm application %v", app.Name)
+		resMap, err := h.renderResMap(app)
+		if err != nil {
+			return err
+		}
+		// Sort resources by kind to make sure we don't experience namespace terminating hanging.
+		for _, r := range utils.SortByKind(resMap.Resources(), utils.UninstallOrder) {
+			data, err := r.AsYAML()
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if err := utils.DeleteResource(data, kubeclient, 5*time.Minute, byOperator); err != nil {
+				msg := fmt.Sprintf("error deleting helm resources for %v: %v", app.Name, err)
+				errList = append(errList, errors.New(msg))
+				log.Warn(msg)
+			}
+		}
+	}
+
+	aggrError := errutil.NewAggregate(errList)
+	if aggrError != nil {
+		return &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("error deleting helm manifests: %v", aggrError),
+		}
+	}
+	return nil
+}
+
+// render renders the chart of app and passes the result through the same transform, sort
+// and annotation pipeline as the kustomize applications.
+func (h *helm) render(app kfconfig.Application) ([]byte, error) {
+	resMap, err := h.renderResMap(app)
+	if err != nil {
+		return nil, err
+	}
+	return kustomize.GenerateYaml(h.kfDef, app, resMap)
+}
+
+// renderResMap renders the chart of app into a resmap. NOTES.txt and the hooks are dropped:
+// the applications are applied as a whole on every reconcile, without the install, upgrade and
+// delete phases hooks are ordered by, so a hook rendered as a regular resource would run at the
+// wrong time, e.g. a pre-upgrade Job after the upgrade, and never be deleted. Charts relying on
+// hooks, other than tests, aren't supported. Namespaced resources without a namespace are put in
+// the namespace of the release.
+func (h *helm) renderResMap(app kfconfig.Application) (resmap.ResMap, error) {
+	chrt, err := h.loadChart(app)
+	if err != nil {
+		return nil, err
+	}
+	values, err := h.values(app)
+	if err != nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't read values for helm application %v: %v", app.Name, err),
+		}
+	}
+
+	releaseName := app.HelmConfig.ReleaseName
+	if releaseName == "" {
+		releaseName = app.Name
+	}
+	namespace := h.namespace(app)
+	options := chartutil.ReleaseOptions{
+		Name:      releaseName,
+		Namespace: namespace,
+		Revision:  1,
+		IsInstall: true,
+	}
+	caps, err := h.capabilities()
+	if err != nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("invalid cluster facts for helm application %v: %v", app.Name, err),
+		}
+	}
+	renderValues, err := chartutil.ToRenderValues(chrt, values, options, caps)
+	if err != nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("invalid values for helm application %v: %v", app.Name, err),
+		}
+	}
+	files, err := engine.Render(chrt, renderValues)
+	if err != nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("error rendering chart for helm application %v: %v", app.Name, err),
+		}
+	}
+	for name := range files {
+		if strings.HasSuffix(name, notesFileSuffix) {
+			delete(files, name)
+		}
+	}
+	hooks, manifests, err := releaseutil.SortManifests(files, caps.APIVersions, releaseutil.InstallOrder)
+	if err != nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("error parsing rendered chart for helm application %v: %v", app.Name, err),
+		}
+	}
+
+	var docs []string
+	for _, crd := range chrt.CRDObjects() {
+		docs = append(docs, string(crd.File.Data))
+	}
+	for _, hook := range hooks {
+		if !isTestHook(hook) {
+			log.Warnf("Dropping %v hook %v of helm application %v; chart hooks aren't run", hook.Kind, hook.Name, app.Name)
+		}
+	}
+	for _, m := range manifests {
+		docs = append(docs, m.Content)
+	}
+
+	rf := resmap.NewFactory(resource.NewFactory(kunstruct.NewKunstructuredFactoryImpl()), transformer.NewFactoryImpl())
+	resMap, err := rf.NewResMapFromBytes([]byte(strings.Join(docs, "\n---\n")))
+	if err != nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("error parsing rendered chart for helm application %v: %v", app.Name, err),
+		}
+	}
+	for _, r := range resMap.Resources() {
+		if r.GetNamespace() == "" && r.OrgId().IsNamespaceableKind() {
+			r.SetNamespace(namespace)
+		}
+	}
+	return resMap, nil
+}
+
+// capabilities returns the .Capabilities the charts are rendered with: the Kubernetes version and
+// the group versions of the cluster facts collected by the operator. The defaults of helm are used
+// for the facts that weren't collected, e.g. when run by kfctl.
+func (h *helm) capabilities() (*chartutil.Capabilities, error) {
+	caps := chartutil.DefaultCapabilities.Copy()
+	facts := h.kfDef.Status.ClusterFacts
+	if facts == nil {
+		return caps, nil
+	}
+	if facts.KubernetesVersion != "" {
+		kubeVersion, err := chartutil.ParseKubeVersion(facts.KubernetesVersion)
+		if err != nil {
+			return nil, err
+		}
+		caps.KubeVersion = *kubeVersion
+	}
+	if len(facts.APIVersions) > 0 {
+		caps.APIVersions = chartutil.VersionSet(facts.APIVersions)
+	}
+	return caps, nil
+}
+
+// loadChart loads the chart directory or packaged chart referenced by app from the repo cache.
+func (h *helm) loadChart(app kfconfig.Application) (*chart.Chart, error) {
+	if app.HelmConfig.RepoRef == nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("helm application %v is missing repoRef", app.Name),
+		}
+	}
+	repoName := app.HelmConfig.RepoRef.Name
+	repoCache, ok := h.kfDef.GetRepoCache(repoName)
+	if !ok {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("application %v refers to repo %v which wasn't found in KfDef.Status.ReposCache", app.Name, repoName),
+		}
+	}
+	chartPath := path.Join(repoCache.LocalPath, app.HelmConfig.RepoRef.Path)
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't load chart %v for helm application %v: %v", chartPath, app.Name, err),
+		}
+	}
+	return chrt, nil
+}
+
+// values merges the values files referenced by valuesFrom, in order, and the inline values of app.
+// The defaults of the chart are coalesced in by the helm engine.
+func (h *helm) values(app kfconfig.Application) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, ref := range app.HelmConfig.ValuesFrom {
+		data, err := h.valuesFrom(ref)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		v := map[string]interface{}{}
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("could not parse %v %v: %v", ref.Kind, ref.Name, err)
+		}
+		values = mergeValues(values, v)
+	}
+	if app.HelmConfig.Values != nil && len(app.HelmConfig.Values.Raw) > 0 {
+		v := map[string]interface{}{}
+		if err := yaml.Unmarshal(app.HelmConfig.Values.Raw, &v); err != nil {
+			return nil, fmt.Errorf("could not parse values: %v", err)
+		}
+		values = mergeValues(values, v)
+	}
+	return values, nil
+}
+
+// valuesFrom returns the values file referenced by ref. It returns nil if an optional reference is missing.
+func (h *helm) valuesFrom(ref kfconfig.ValuesReference) ([]byte, error) {
+	if err := h.initK8sClients(); err != nil {
+		return nil, err
+	}
+	key := ref.Key
+	if key == "" {
+		key = defaultValuesKey
+	}
+	namespace := h.kfDef.Namespace
+	var data []byte
+	var found bool
+	switch ref.Kind {
+	case "ConfigMap":
+		cm, err := h.kubeClient.CoreV1().ConfigMaps(namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) && ref.Optional {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if s, ok := cm.Data[key]; ok {
+			data, found = []byte(s), true
+		} else {
+			data, found = cm.BinaryData[key]
+		}
+	case "Secret":
+		secret, err := h.kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) && ref.Optional {
+				return nil, nil
+			}
+			return nil, err
+		}
+		data, found = secret.Data[key]
+	default:
+		return nil, fmt.Errorf("unsupported valuesFrom kind %v; must be ConfigMap or Secret", ref.Kind)
+	}
+	if !found {
+		if ref.Optional {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("key %v not found in %v %v/%v", key, ref.Kind, namespace, ref.Name)
+	}
+	return data, nil
+}
+
+// namespace returns the namespace the chart of app is rendered into.
+func (h *helm) namespace(app kfconfig.Application) string {
+	if app.HelmConfig.Namespace != "" {
+		return app.HelmConfig.Namespace
+	}
+	return h.kfDef.Namespace
+}
+
+func isTestHook(hook *release.Hook) bool {
+	for _, e := range hook.Events {
+		if e == release.HookTest {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeValues merges src into dst recursively; values in src take precedence.
+func mergeValues(dst, src map[string]interface{}) map[string]interface{} {
+	for k, v := range src {
+		if srcMap, ok := v.(map[string]interface{}); ok {
+			if dstMap, ok := dst[k].(map[string]interface{}); ok {
+				dst[k] = mergeValues(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+	return dst
+}
@@ -0,0 +1,230 @@
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	kftypesv3 "github.com/opendatahub-io/opendatahub-operator/apis/apps"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const expectedExample = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: partner-example
+rules: []
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    example.com/kube-version: v1.20.0
+  name: partner-example
+  namespace: opendatahub
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - args:
+        - --log-level=debug
+        image: quay.io/example/app:2.0
+        name: app
+`
+
+const expectedExampleOpenShift = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: partner-example
+rules: []
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    example.com/kube-version: v1.23.3
+  name: partner-example
+  namespace: opendatahub
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - args:
+        - --log-level=debug
+        image: quay.io/example/app:2.0
+        name: app
+---
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata:
+  name: partner-example
+  namespace: opendatahub
+spec:
+  to:
+    kind: Service
+    name: partner-example
+`
+
+func TestRender(t *testing.T) {
+	type testCase struct {
+		Name     string
+		RepoRef  *kfconfig.RepoRef
+		Facts    *kfconfig.ClusterFacts
+		Expected string
+	}
+
+	// Package the example chart to test rendering a tarball.
+	cacheDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+	chrt, err := loader.Load("testdata/example")
+	if err != nil {
+		t.Fatalf("Failed to load chart: %v", err)
+	}
+	tarball, err := chartutil.Save(chrt, cacheDir)
+	if err != nil {
+		t.Fatalf("Failed to package chart: %v", err)
+	}
+
+	testCases := []testCase{
+		{
+			Name:     "directory",
+			RepoRef:  &kfconfig.RepoRef{Name: "charts", Path: "example"},
+			Expected: expectedExample,
+		},
+		{
+			Name:     "tarball",
+			RepoRef:  &kfconfig.RepoRef{Name: "packages", Path: path.Base(tarball)},
+			Expected: expectedExample,
+		},
+		{
+			Name:    "cluster-facts",
+			RepoRef: &kfconfig.RepoRef{Name: "charts", Path: "example"},
+			Facts: &kfconfig.ClusterFacts{
+				Platform:          kfconfig.PlatformOpenShift,
+				KubernetesVersion: "v1.23.3",
+				APIGroups:         []string{"", "apps", "route.openshift.io"},
+				APIVersions:       []string{"apps/v1", "route.openshift.io/v1", "v1"},
+			},
+			Expected: expectedExampleOpenShift,
+		},
+	}
+
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "example-values", Namespace: "opendatahub"},
+			Data: map[string]string{
+				"values.yaml": "replicas: 2\nimage:\n  tag: \"2.0\"\n",
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "example-secret-values", Namespace: "opendatahub"},
+			Data: map[string][]byte{
+				"overrides.yaml": []byte("replicas: 3\n"),
+			},
+		},
+	)
+
+	for _, c := range testCases {
+		kfDef := &kfconfig.KfConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "opendatahub",
+				Namespace: "opendatahub",
+			},
+			Status: kfconfig.Status{
+				Caches: []kfconfig.Cache{
+					{Name: "charts", LocalPath: "testdata"},
+					{Name: "packages", LocalPath: cacheDir},
+				},
+				ClusterFacts: c.Facts,
+			},
+		}
+		app := kfconfig.Application{
+			Name: "partner",
+			HelmConfig: &kfconfig.HelmConfig{
+				RepoRef: c.RepoRef,
+				Values:  &runtime.RawExtension{Raw: []byte(`{"logLevel": "debug"}`)},
+				ValuesFrom: []kfconfig.ValuesReference{
+					{Kind: "ConfigMap", Name: "example-values"},
+					{Kind: "Secret", Name: "example-secret-values", Key: "overrides.yaml"},
+					{Kind: "ConfigMap", Name: "missing", Optional: true},
+				},
+			},
+		}
+		kfDef.Spec.Applications = []kfconfig.Application{app}
+		h := &helm{
+			kfDef:      kfDef,
+			kubeClient: kubeClient,
+		}
+		if err := h.Generate(kftypesv3.K8S); err != nil {
+			t.Fatalf("Case %v: failed to generate: %v", c.Name, err)
+		}
+		data, err := h.render(app)
+		if err != nil {
+			t.Fatalf("Case %v: failed to render: %v", c.Name, err)
+		}
+		if diff := cmp.Diff(c.Expected, string(data)); diff != "" {
+			t.Errorf("Case %v: unexpected resources (-want, +got):\n%s", c.Name, diff)
+		}
+	}
+}
+
+func TestValuesFromMissing(t *testing.T) {
+	h := &helm{
+		kfDef: &kfconfig.KfConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "opendatahub"},
+		},
+		kubeClient: fake.NewSimpleClientset(),
+	}
+	app := kfconfig.Application{
+		Name: "partner",
+		HelmConfig: &kfconfig.HelmConfig{
+			ValuesFrom: []kfconfig.ValuesReference{{Kind: "Secret", Name: "missing"}},
+		},
+	}
+	if _, err := h.values(app); err == nil {
+		t.Errorf("Expected an error for a missing values Secret")
+	}
+}
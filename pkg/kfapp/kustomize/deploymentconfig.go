@@ -0,0 +1,367 @@
+package kustomize
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	kfapisv3 "github.com/opendatahub-io/opendatahub-operator/apis"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/kunstruct"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/kustomize/v3/pkg/resource"
+)
+
+const (
+	// convertedFromAnnotation is set on the Deployments converted from DeploymentConfigs, to
+	// migrate the DeploymentConfigs already deployed.
+	convertedFromAnnotation = "opendatahub.io/converted-from"
+	// imageTriggersAnnotation holds the image change triggers of a Deployment on OpenShift.
+	imageTriggersAnnotation = "image.openshift.io/triggers"
+)
+
+var deploymentConfigGVK = schema.GroupVersionKind{Group: "apps.openshift.io", Version: "v1", Kind: "DeploymentConfig"}
+
+// convertDeploymentConfigs returns true if the KfDef opts in to the conversion of DeploymentConfigs
+// with the kfctl.kubeflow.io/convert-deploymentconfigs annotation.
+func convertDeploymentConfigs(kfDef *kfconfig.KfConfig) bool {
+	convert, _ := strconv.ParseBool(kfDef.GetAnnotations()[strings.Join([]string{utils.KfDefAnnotation, utils.ConvertDeploymentConfigs}, "/")])
+	return convert
+}
+
+// DeploymentConfigTransformer converts the DeploymentConfigs of the resmap to Deployments with the
+// same pod template, selector, replicas and strategy. Image change triggers become the trigger
+// annotation OpenShift sets the images of Deployments from. Lifecycle hooks have no equivalent
+// and are dropped.
+type DeploymentConfigTransformer struct {
+	Enabled bool
+}
+
+func (p *DeploymentConfigTransformer) Transform(m resmap.ResMap) error {
+	if !p.Enabled {
+		return nil
+	}
+	rf := resource.NewFactory(kunstruct.NewKunstructuredFactoryImpl())
+	for _, r := range m.Resources() {
+		if r.GetKind() != "DeploymentConfig" {
+			continue
+		}
+		deployment, err := deploymentConfigToDeployment(r.Map())
+		if err != nil {
+			return fmt.Errorf("could not convert DeploymentConfig %v: %v", r.GetName(), err)
+		}
+		if err := m.Remove(r.CurId()); err != nil {
+			return err
+		}
+		if err := m.Append(rf.FromMap(deployment)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// imageTrigger is an image change trigger in the trigger annotation of a Deployment.
+type imageTrigger struct {
+	From      imageTriggerFrom `json:"from"`
+	FieldPath string           `json:"fieldPath"`
+	Paused    bool             `json:"paused,omitempty"`
+}
+
+type imageTriggerFrom struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// deploymentConfigToDeployment returns the Deployment replacing dc.
+func deploymentConfigToDeployment(dc map[string]interface{}) (map[string]interface{}, error) {
+	name, _, _ := unstructured.NestedString(dc, "metadata", "name")
+	metadata := copyMetadata(dc)
+	annotations, _, _ := unstructured.NestedStringMap(metadata, "annotations")
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[convertedFromAnnotation] = "DeploymentConfig"
+
+	template, _, _ := unstructured.NestedMap(dc, "spec", "template")
+	if template == nil {
+		return nil, fmt.Errorf("it has no pod template")
+	}
+	// The selector of a DeploymentConfig defaults to the labels of its pods, and the pods get the
+	// labels of the selector: the Deployment selects the same pods.
+	templateLabels, _, _ := unstructured.NestedStringMap(template, "metadata", "labels")
+	selector, _, _ := unstructured.NestedStringMap(dc, "spec", "selector")
+	if len(selector) == 0 {
+		selector = templateLabels
+	}
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("it has no selector and its pods have no labels")
+	}
+	if templateLabels == nil {
+		templateLabels = map[string]string{}
+	}
+	for k, v := range selector {
+		templateLabels[k] = v
+	}
+	if err := unstructured.SetNestedStringMap(template, templateLabels, "metadata", "labels"); err != nil {
+		return nil, err
+	}
+
+	triggers, err := deploymentConfigImageTriggers(dc, template)
+	if err != nil {
+		return nil, err
+	}
+	if len(triggers) > 0 {
+		data, err := json.Marshal(triggers)
+		if err != nil {
+			return nil, err
+		}
+		annotations[imageTriggersAnnotation] = string(data)
+	}
+	if err := unstructured.SetNestedStringMap(metadata, annotations, "annotations"); err != nil {
+		return nil, err
+	}
+
+	strategy, err := deploymentConfigStrategy(name, dc)
+	if err != nil {
+		return nil, err
+	}
+	spec := map[string]interface{}{
+		"selector": map[string]interface{}{"matchLabels": stringMapToInterface(selector)},
+		"template": template,
+		"strategy": strategy,
+	}
+	for _, field := range []string{"replicas", "minReadySeconds", "revisionHistoryLimit", "paused"} {
+		if v, ok, _ := unstructured.NestedFieldCopy(dc, "spec", field); ok {
+			spec[field] = v
+		}
+	}
+	return map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   metadata,
+		"spec":       spec,
+	}, nil
+}
+
+// deploymentConfigStrategy returns the Deployment strategy of the strategy of dc.
+func deploymentConfigStrategy(name string, dc map[string]interface{}) (map[string]interface{}, error) {
+	strategyType, _, _ := unstructured.NestedString(dc, "spec", "strategy", "type")
+	switch strategyType {
+	case "", "Rolling":
+		strategy := map[string]interface{}{"type": "RollingUpdate"}
+		rollingUpdate := map[string]interface{}{}
+		for _, field := range []string{"maxSurge", "maxUnavailable"} {
+			if v, ok, _ := unstructured.NestedFieldCopy(dc, "spec", "strategy", "rollingParams", field); ok {
+				rollingUpdate[field] = v
+			}
+		}
+		if len(rollingUpdate) > 0 {
+			strategy["rollingUpdate"] = rollingUpdate
+		}
+		warnDroppedHooks(name, dc, "rollingParams", "pre", "post")
+		return strategy, nil
+	case "Recreate":
+		warnDroppedHooks(name, dc, "recreateParams", "pre", "mid", "post")
+		return map[string]interface{}{"type": "Recreate"}, nil
+	default:
+		return nil, fmt.Errorf("%v strategies can't be converted", strategyType)
+	}
+}
+
+func warnDroppedHooks(name string, dc map[string]interface{}, params string, hooks ...string) {
+	for _, hook := range hooks {
+		if _, ok, _ := unstructured.NestedFieldNoCopy(dc, "spec", "strategy", params, hook); ok {
+			log.Warnf("DeploymentConfig %v has a %v lifecycle hook, which Deployments don't support; dropping it", name, hook)
+		}
+	}
+}
+
+// deploymentConfigImageTriggers returns the triggers of the image change triggers of dc. The
+// containers of template without an image get the image stream tag of their trigger, which OpenShift
+// replaces with the image it resolves to.
+func deploymentConfigImageTriggers(dc map[string]interface{}, template map[string]interface{}) ([]imageTrigger, error) {
+	dcTriggers, _, _ := unstructured.NestedSlice(dc, "spec", "triggers")
+	containers, _, _ := unstructured.NestedSlice(template, "spec", "containers")
+	initContainers, _, _ := unstructured.NestedSlice(template, "spec", "initContainers")
+	var triggers []imageTrigger
+	for _, t := range dcTriggers {
+		trigger, _ := t.(map[string]interface{})
+		if triggerType, _, _ := unstructured.NestedString(trigger, "type"); triggerType != "ImageChange" {
+			// Deployments roll out on changes of their pod template without a trigger.
+			continue
+		}
+		from := imageTriggerFrom{}
+		from.Kind, _, _ = unstructured.NestedString(trigger, "imageChangeParams", "from", "kind")
+		from.Name, _, _ = unstructured.NestedString(trigger, "imageChangeParams", "from", "name")
+		from.Namespace, _, _ = unstructured.NestedString(trigger, "imageChangeParams", "from", "namespace")
+		if from.Name == "" {
+			return nil, fmt.Errorf("an image change trigger has no image")
+		}
+		if from.Kind == "" {
+			from.Kind = "ImageStreamTag"
+		}
+		automatic, found, _ := unstructured.NestedBool(trigger, "imageChangeParams", "automatic")
+		names, _, _ := unstructured.NestedStringSlice(trigger, "imageChangeParams", "containerNames")
+		for _, containerName := range names {
+			field := "containers"
+			if !setContainerImage(containers, containerName, from.Name) {
+				field = "initContainers"
+				if !setContainerImage(initContainers, containerName, from.Name) {
+					return nil, fmt.Errorf("an image change trigger has an unknown container %v", containerName)
+				}
+			}
+			triggers = append(triggers, imageTrigger{
+				From:      from,
+				FieldPath: fmt.Sprintf(`spec.template.spec.%v[?(@.name=="%v")].image`, field, containerName),
+				Paused:    found && !automatic,
+			})
+		}
+	}
+	if err := unstructured.SetNestedSlice(template, containers, "spec", "containers"); err != nil {
+		return nil, err
+	}
+	if len(initContainers) > 0 {
+		if err := unstructured.SetNestedSlice(template, initContainers, "spec", "initContainers"); err != nil {
+			return nil, err
+		}
+	}
+	return triggers, nil
+}
+
+// setContainerImage sets the image of the container name of containers to image if it has none,
+// and returns false if there's no such container.
+func setContainerImage(containers []interface{}, name string, image string) bool {
+	for _, c := range containers {
+		container, _ := c.(map[string]interface{})
+		if n, _, _ := unstructured.NestedString(container, "name"); n != name {
+			continue
+		}
+		if current, _, _ := unstructured.NestedString(container, "image"); strings.TrimSpace(current) == "" {
+			container["image"] = image
+		}
+		return true
+	}
+	return false
+}
+
+func stringMapToInterface(m map[string]string) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// migrateDeploymentConfigs deletes the DeploymentConfigs replaced by the Deployments of app in
+// data which are available. The Deployments have the same pod labels as the DeploymentConfigs,
+// so their services keep endpoints during the switch. It returns the DeploymentConfigs kept
+// because their Deployments aren't available yet; they are migrated by a later reconcile rather
+// than by waiting here, which would hold up the other applications.
+func (kustomize *kustomize) migrateDeploymentConfigs(app kfconfig.Application, data []byte) ([]string, error) {
+	if !convertDeploymentConfigs(kustomize.kfDef) {
+		return nil, nil
+	}
+	docs, err := utils.SplitYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	var deployments []*unstructured.Unstructured
+	for _, doc := range docs {
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(doc, &obj.Object); err != nil {
+			return nil, err
+		}
+		if obj.GetKind() == "Deployment" && obj.GetAnnotations()[convertedFromAnnotation] == "DeploymentConfig" {
+			if obj.GetNamespace() == "" {
+				obj.SetNamespace(kustomize.kfDef.Namespace)
+			}
+			deployments = append(deployments, obj)
+		}
+	}
+	if len(deployments) == 0 {
+		return nil, nil
+	}
+
+	c, err := newParamClient()
+	if err != nil {
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("couldn't create a client to migrate the DeploymentConfigs of application %v: %v", app.Name, err),
+		}
+	}
+	var pending []string
+	for _, deployment := range deployments {
+		key := k8stypes.NamespacedName{Namespace: deployment.GetNamespace(), Name: deployment.GetName()}
+		dc := &unstructured.Unstructured{}
+		dc.SetGroupVersionKind(deploymentConfigGVK)
+		if err := c.Get(context.TODO(), key, dc); errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			continue
+		} else if err != nil {
+			return nil, &kfapisv3.KfError{
+				Code:    int(kfapisv3.INTERNAL_ERROR),
+				Message: fmt.Sprintf("couldn't get DeploymentConfig %v of application %v: %v", key.Name, app.Name, err),
+			}
+		}
+
+		if err := deploymentAvailable(c, key, dc); err != nil {
+			log.Infof("Keeping DeploymentConfig %v of application %v until its Deployment is available: %v", key.Name, app.Name, err)
+			pending = append(pending, fmt.Sprintf("%v/%v", key.Namespace, key.Name))
+			continue
+		}
+		log.Infof("Deleting DeploymentConfig %v of application %v, replaced by a Deployment", key.Name, app.Name)
+		if err := c.Delete(context.TODO(), dc, client.PropagationPolicy("Background")); err != nil && !errors.IsNotFound(err) {
+			return nil, &kfapisv3.KfError{
+				Code:    int(kfapisv3.INTERNAL_ERROR),
+				Message: fmt.Sprintf("couldn't delete DeploymentConfig %v of application %v: %v", key.Name, app.Name, err),
+			}
+		}
+	}
+	return pending, nil
+}
+
+// setDeploymentConfigMigrationCondition records the DeploymentConfigs kept by
+// migrateDeploymentConfigs in the DeploymentConfigMigrationPending condition of the KfDef.
+func (kustomize *kustomize) setDeploymentConfigMigrationCondition(pending []string) {
+	if len(pending) > 0 {
+		kustomize.kfDef.SetCondition(kfconfig.DeploymentConfigMigrationPending, v1.ConditionTrue, "DeploymentsNotAvailable",
+			fmt.Sprintf("waiting for the Deployments replacing DeploymentConfigs %v to be available", strings.Join(pending, ", ")))
+	} else if _, err := kustomize.kfDef.GetCondition(kfconfig.DeploymentConfigMigrationPending); err == nil {
+		kustomize.kfDef.SetCondition(kfconfig.DeploymentConfigMigrationPending, v1.ConditionFalse, "DeploymentConfigsMigrated", "")
+	}
+}
+
+// deploymentAvailable returns an error unless the Deployment key has all its replicas available,
+// and at least as many as the DeploymentConfig dc it replaces, so that deleting dc doesn't drop
+// pods still serving, e.g. if the Deployment was scaled to 0.
+func deploymentAvailable(c client.Client, key k8stypes.NamespacedName, dc *unstructured.Unstructured) error {
+	deployment := &unstructured.Unstructured{}
+	deployment.SetGroupVersionKind(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+	if err := c.Get(context.TODO(), key, deployment); err != nil {
+		return err
+	}
+	replicas, found, _ := unstructured.NestedInt64(deployment.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+	if serving, _, _ := unstructured.NestedInt64(dc.Object, "status", "availableReplicas"); serving > replicas {
+		replicas = serving
+	}
+	available, _, _ := unstructured.NestedInt64(deployment.Object, "status", "availableReplicas")
+	if available < replicas {
+		return fmt.Errorf("deployment %v has %v of %v replicas available", key.Name, available, replicas)
+	}
+	return nil
+}
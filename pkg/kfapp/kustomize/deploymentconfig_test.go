@@ -0,0 +1,361 @@
+package kustomize
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDeploymentConfigTransformer(t *testing.T) {
+	type testCase struct {
+		Name     string
+		Enabled  bool
+		Input    string
+		Expected string
+		Error    string
+	}
+	dc := `
+apiVersion: apps.openshift.io/v1
+kind: DeploymentConfig
+metadata:
+  name: odh-dashboard
+  namespace: opendatahub
+  labels:
+    app: odh-dashboard
+spec:
+  replicas: 2
+  selector:
+    app: odh-dashboard
+    deploymentconfig: odh-dashboard
+  strategy:
+    type: Rolling
+    rollingParams:
+      maxSurge: 25%
+      maxUnavailable: 0
+      pre:
+        failurePolicy: Abort
+  triggers:
+  - type: ConfigChange
+  - type: ImageChange
+    imageChangeParams:
+      automatic: true
+      containerNames:
+      - dashboard
+      from:
+        kind: ImageStreamTag
+        name: odh-dashboard:latest
+  template:
+    metadata:
+      labels:
+        app: odh-dashboard
+    spec:
+      containers:
+      - name: dashboard
+        image: " "
+      - name: oauth-proxy
+        image: quay.io/openshift/origin-oauth-proxy:4.10
+`
+	testCases := []testCase{
+		{
+			Name:    "rolling-with-image-trigger",
+			Enabled: true,
+			Input:   dc,
+			Expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: odh-dashboard
+  namespace: opendatahub
+  labels:
+    app: odh-dashboard
+  annotations:
+    opendatahub.io/converted-from: DeploymentConfig
+    image.openshift.io/triggers: '[{"from":{"kind":"ImageStreamTag","name":"odh-dashboard:latest"},"fieldPath":"spec.template.spec.containers[?(@.name==\"dashboard\")].image"}]'
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: odh-dashboard
+      deploymentconfig: odh-dashboard
+  strategy:
+    type: RollingUpdate
+    rollingUpdate:
+      maxSurge: 25%
+      maxUnavailable: 0
+  template:
+    metadata:
+      labels:
+        app: odh-dashboard
+        deploymentconfig: odh-dashboard
+    spec:
+      containers:
+      - name: dashboard
+        image: odh-dashboard:latest
+      - name: oauth-proxy
+        image: quay.io/openshift/origin-oauth-proxy:4.10
+`,
+		},
+		{
+			Name:    "recreate-with-manual-trigger",
+			Enabled: true,
+			Input: `
+apiVersion: apps.openshift.io/v1
+kind: DeploymentConfig
+metadata:
+  name: mariadb
+spec:
+  strategy:
+    type: Recreate
+  triggers:
+  - type: ImageChange
+    imageChangeParams:
+      automatic: false
+      containerNames:
+      - mariadb
+      from:
+        kind: ImageStreamTag
+        name: mariadb:10.3
+        namespace: openshift
+  template:
+    metadata:
+      labels:
+        app: mariadb
+    spec:
+      containers:
+      - name: mariadb
+        image: registry.redhat.io/rhel8/mariadb-103
+`,
+			Expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: mariadb
+  annotations:
+    opendatahub.io/converted-from: DeploymentConfig
+    image.openshift.io/triggers: '[{"from":{"kind":"ImageStreamTag","name":"mariadb:10.3","namespace":"openshift"},"fieldPath":"spec.template.spec.containers[?(@.name==\"mariadb\")].image","paused":true}]'
+spec:
+  selector:
+    matchLabels:
+      app: mariadb
+  strategy:
+    type: Recreate
+  template:
+    metadata:
+      labels:
+        app: mariadb
+    spec:
+      containers:
+      - name: mariadb
+        image: registry.redhat.io/rhel8/mariadb-103
+`,
+		},
+		{
+			Name:     "disabled",
+			Input:    dc,
+			Expected: dc,
+		},
+		{
+			Name:    "custom-strategy",
+			Enabled: true,
+			Input: `
+apiVersion: apps.openshift.io/v1
+kind: DeploymentConfig
+metadata:
+  name: custom
+spec:
+  strategy:
+    type: Custom
+  template:
+    metadata:
+      labels:
+        app: custom
+`,
+			Error: "could not convert DeploymentConfig custom: Custom strategies can't be converted",
+		},
+		{
+			Name:    "trigger-for-unknown-container",
+			Enabled: true,
+			Input: `
+apiVersion: apps.openshift.io/v1
+kind: DeploymentConfig
+metadata:
+  name: notebooks
+spec:
+  triggers:
+  - type: ImageChange
+    imageChangeParams:
+      containerNames:
+      - jupyter
+      from:
+        name: jupyter:latest
+  template:
+    metadata:
+      labels:
+        app: notebooks
+    spec:
+      containers:
+      - name: notebook
+        image: quay.io/thoth-station/s2i-minimal-notebook
+`,
+			Error: "an image change trigger has an unknown container jupyter",
+		},
+	}
+
+	for _, c := range testCases {
+		m := newResMapFromYaml(t, c.Input)
+		p := &DeploymentConfigTransformer{Enabled: c.Enabled}
+		err := p.Transform(m)
+		if c.Error != "" {
+			if err == nil || !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("Case %v: expected error containing %v; got %v", c.Name, c.Error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Case %v: failed to transform: %v", c.Name, err)
+		}
+		assertResMapYaml(t, c.Name, m, c.Expected)
+	}
+}
+
+func TestMigrateDeploymentConfigs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	scheme.AddKnownTypeWithName(deploymentConfigGVK, &unstructured.Unstructured{})
+	deploymentConfig := func(name string, availableReplicas int64) *unstructured.Unstructured {
+		dc := &unstructured.Unstructured{}
+		dc.SetGroupVersionKind(deploymentConfigGVK)
+		dc.SetName(name)
+		dc.SetNamespace("opendatahub")
+		if availableReplicas > 0 {
+			_ = unstructured.SetNestedField(dc.Object, availableReplicas, "status", "availableReplicas")
+		}
+		return dc
+	}
+	deployment := func(name string, replicas *int32, availableReplicas int32) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "opendatahub"},
+			Spec:       appsv1.DeploymentSpec{Replicas: replicas},
+			Status:     appsv1.DeploymentStatus{AvailableReplicas: availableReplicas},
+		}
+	}
+	two, zero := int32(2), int32(0)
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		deploymentConfig("odh-dashboard", 2),
+		deployment("odh-dashboard", &two, 2),
+		deploymentConfig("mariadb", 1),
+		deployment("mariadb", nil, 0),
+		// Scaled to 0 while the DeploymentConfig still serves.
+		deploymentConfig("jupyterhub", 1),
+		deployment("jupyterhub", &zero, 0),
+		// Scaled to 0 along with the DeploymentConfig.
+		deploymentConfig("jupyterhub-db", 0),
+		deployment("jupyterhub-db", &zero, 0),
+	).Build()
+	defer func(f func() (client.Client, error)) { newParamClient = f }(newParamClient)
+	newParamClient = func() (client.Client, error) {
+		return kubeClient, nil
+	}
+
+	kfDef := &kfconfig.KfConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "odh",
+			Namespace:   "opendatahub",
+			Annotations: map[string]string{"kfctl.kubeflow.io/convert-deploymentconfigs": "true"},
+		},
+	}
+	kustomize := &kustomize{kfDef: kfDef}
+	converted := func(names ...string) []byte {
+		var docs []string
+		for _, name := range names {
+			docs = append(docs, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: `+name+`
+  annotations:
+    opendatahub.io/converted-from: DeploymentConfig
+`)
+		}
+		return []byte(strings.Join(docs, "---\n"))
+	}
+
+	type testCase struct {
+		Name    string
+		Data    []byte
+		Pending []string
+		Deleted []string
+		Kept    []string
+	}
+	testCases := []testCase{
+		{
+			Name:    "available",
+			Data:    converted("odh-dashboard"),
+			Deleted: []string{"odh-dashboard"},
+		},
+		{
+			Name:    "not-available",
+			Data:    converted("mariadb"),
+			Pending: []string{"opendatahub/mariadb"},
+			Kept:    []string{"mariadb"},
+		},
+		{
+			Name:    "scaled-to-zero",
+			Data:    converted("jupyterhub", "jupyterhub-db"),
+			Pending: []string{"opendatahub/jupyterhub"},
+			Deleted: []string{"jupyterhub-db"},
+			Kept:    []string{"jupyterhub"},
+		},
+	}
+	for _, c := range testCases {
+		pending, err := kustomize.migrateDeploymentConfigs(kfconfig.Application{Name: c.Name}, c.Data)
+		if err != nil {
+			t.Fatalf("Case %v: failed to migrate the DeploymentConfigs: %v", c.Name, err)
+		}
+		if !reflect.DeepEqual(pending, c.Pending) {
+			t.Errorf("Case %v: expected pending migrations %v; got %v", c.Name, c.Pending, pending)
+		}
+		for _, name := range c.Deleted {
+			key := k8stypes.NamespacedName{Namespace: "opendatahub", Name: name}
+			if err := kubeClient.Get(context.TODO(), key, deploymentConfig(name, 0)); !errors.IsNotFound(err) {
+				t.Errorf("Case %v: expected the DeploymentConfig %v to be deleted; got %v", c.Name, name, err)
+			}
+		}
+		for _, name := range c.Kept {
+			key := k8stypes.NamespacedName{Namespace: "opendatahub", Name: name}
+			if err := kubeClient.Get(context.TODO(), key, deploymentConfig(name, 0)); err != nil {
+				t.Errorf("Case %v: expected the DeploymentConfig %v to be kept; got %v", c.Name, name, err)
+			}
+		}
+	}
+
+	// The pending migrations are reported until they are done.
+	kustomize.setDeploymentConfigMigrationCondition([]string{"opendatahub/mariadb"})
+	cond, err := kfDef.GetCondition(kfconfig.DeploymentConfigMigrationPending)
+	if err != nil || cond.Status != v1.ConditionTrue || !strings.Contains(cond.Message, "opendatahub/mariadb") {
+		t.Errorf("Expected a pending migration condition; got %v, %v", cond, err)
+	}
+	kustomize.setDeploymentConfigMigrationCondition(nil)
+	if cond, err = kfDef.GetCondition(kfconfig.DeploymentConfigMigrationPending); err != nil || cond.Status != v1.ConditionFalse {
+		t.Errorf("Expected the migration condition to be cleared; got %v, %v", cond, err)
+	}
+
+	// Nothing is migrated without the annotation.
+	kfDef.Annotations = nil
+	if pending, err := kustomize.migrateDeploymentConfigs(kfconfig.Application{Name: "mariadb"}, converted("mariadb")); err != nil || pending != nil {
+		t.Errorf("Expected no migration without the annotation; got %v, %v", pending, err)
+	}
+}
@@ -0,0 +1,373 @@
+package kustomize
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/kunstruct"
+	"sigs.k8s.io/kustomize/v3/pkg/gvk"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/kustomize/v3/pkg/resource"
+)
+
+const (
+	// keepExposureAnnotation set to "true" on a Route or an Ingress prevents its conversion.
+	keepExposureAnnotation = "opendatahub.io/keep-exposure"
+
+	// The annotations of the NGINX ingress controller mapping the TLS settings of Routes.
+	sslRedirectAnnotation     = "nginx.ingress.kubernetes.io/ssl-redirect"
+	sslPassthroughAnnotation  = "nginx.ingress.kubernetes.io/ssl-passthrough"
+	backendProtocolAnnotation = "nginx.ingress.kubernetes.io/backend-protocol"
+
+	routeAPIVersion   = "route.openshift.io/v1"
+	ingressAPIVersion = "networking.k8s.io/v1"
+)
+
+// ExposureTransformer converts the Routes of the resmap to Ingresses on clusters other than
+// OpenShift, and the Ingresses to Routes on OpenShift, so that an application can ship a single
+// exposure definition. The TLS settings of Routes map to the annotations of the NGINX ingress
+// controller. Nothing is converted if the facts about the cluster weren't collected.
+type ExposureTransformer struct {
+	Facts *kfconfig.ClusterFacts
+}
+
+func (p *ExposureTransformer) Transform(m resmap.ResMap) error {
+	if p.Facts == nil {
+		return nil
+	}
+	// Only OpenShift Routes and networking.k8s.io/v1 Ingresses are converted: other kinds named
+	// Route, e.g. the Routes of Knative, and the Ingresses of older APIs pass through unchanged.
+	from, to := gvk.Gvk{Group: "route.openshift.io", Version: "v1", Kind: "Route"}, p.routeToIngress
+	if p.Facts.Platform == kfconfig.PlatformOpenShift {
+		from, to = gvk.Gvk{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"}, p.ingressToRoutes
+	}
+	services := map[string]map[string]interface{}{}
+	secrets := map[string]map[string]interface{}{}
+	var converted []*resource.Resource
+	for _, r := range m.Resources() {
+		switch id := r.GetGvk(); {
+		case id.Equals(gvk.Gvk{Version: "v1", Kind: "Service"}):
+			services[r.GetNamespace()+"/"+r.GetName()] = r.Map()
+		case id.Equals(gvk.Gvk{Version: "v1", Kind: "Secret"}):
+			secrets[r.GetNamespace()+"/"+r.GetName()] = r.Map()
+		case id.Equals(from):
+			if r.GetAnnotations()[keepExposureAnnotation] != "true" {
+				converted = append(converted, r)
+			}
+		}
+	}
+
+	rf := resource.NewFactory(kunstruct.NewKunstructuredFactoryImpl())
+	for _, r := range converted {
+		objs, err := to(r.Map(), services, secrets)
+		if err != nil {
+			return fmt.Errorf("could not convert %v %v: %v", r.GetKind(), r.GetName(), err)
+		}
+		if err := m.Remove(r.CurId()); err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			if err := m.Append(rf.FromMap(obj)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// routeToIngress returns the Ingress exposing the same service as route, and the Secret holding
+// the certificate of route if it has one.
+func (p *ExposureTransformer) routeToIngress(route map[string]interface{}, services map[string]map[string]interface{},
+	_ map[string]map[string]interface{}) ([]map[string]interface{}, error) {
+	name, _, _ := unstructured.NestedString(route, "metadata", "name")
+	namespace, _, _ := unstructured.NestedString(route, "metadata", "namespace")
+	metadata := copyMetadata(route)
+	annotations, _, _ := unstructured.NestedStringMap(metadata, "annotations")
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	kind, _, _ := unstructured.NestedString(route, "spec", "to", "kind")
+	if kind != "" && kind != "Service" {
+		return nil, fmt.Errorf("routes to a %v can't be converted", kind)
+	}
+	serviceName, _, _ := unstructured.NestedString(route, "spec", "to", "name")
+	targetPort, _, _ := unstructured.NestedFieldNoCopy(route, "spec", "port", "targetPort")
+	port, err := ingressBackendPort(services[namespace+"/"+serviceName], targetPort)
+	if err != nil {
+		return nil, fmt.Errorf("service %v: %v", serviceName, err)
+	}
+
+	host, _, _ := unstructured.NestedString(route, "spec", "host")
+	if host == "" && p.Facts.IngressDomain != "" {
+		// The host OpenShift would have generated.
+		host = fmt.Sprintf("%v-%v.%v", name, namespace, p.Facts.IngressDomain)
+	}
+	path, _, _ := unstructured.NestedString(route, "spec", "path")
+	if path == "" {
+		path = "/"
+	}
+	rule := map[string]interface{}{
+		"http": map[string]interface{}{
+			"paths": []interface{}{
+				map[string]interface{}{
+					"path":     path,
+					"pathType": "Prefix",
+					"backend": map[string]interface{}{
+						"service": map[string]interface{}{"name": serviceName, "port": port},
+					},
+				},
+			},
+		},
+	}
+	if host != "" {
+		rule["host"] = host
+	}
+	spec := map[string]interface{}{"rules": []interface{}{rule}}
+	objs := []map[string]interface{}{}
+
+	if tls, ok, _ := unstructured.NestedStringMap(route, "spec", "tls"); ok {
+		entry := map[string]interface{}{}
+		if host != "" {
+			entry["hosts"] = []interface{}{host}
+		}
+		switch tls["termination"] {
+		case "passthrough":
+			annotations[sslPassthroughAnnotation] = "true"
+		case "reencrypt":
+			annotations[backendProtocolAnnotation] = "HTTPS"
+		}
+		if tls["certificate"] != "" && tls["key"] != "" && tls["termination"] != "passthrough" {
+			secretName := name + "-tls"
+			entry["secretName"] = secretName
+			objs = append(objs, map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Secret",
+				"metadata":   map[string]interface{}{"name": secretName, "namespace": namespace},
+				"type":       "kubernetes.io/tls",
+				"stringData": map[string]interface{}{"tls.crt": tls["certificate"], "tls.key": tls["key"]},
+			})
+		}
+		switch tls["insecureEdgeTerminationPolicy"] {
+		case "Redirect":
+			annotations[sslRedirectAnnotation] = "true"
+		case "Allow":
+			annotations[sslRedirectAnnotation] = "false"
+		}
+		spec["tls"] = []interface{}{entry}
+	}
+	if len(annotations) > 0 {
+		_ = unstructured.SetNestedStringMap(metadata, annotations, "annotations")
+	}
+
+	ingress := map[string]interface{}{
+		"apiVersion": ingressAPIVersion,
+		"kind":       "Ingress",
+		"metadata":   metadata,
+		"spec":       spec,
+	}
+	return append([]map[string]interface{}{ingress}, objs...), nil
+}
+
+// ingressToRoutes returns a Route for each path of each rule of ingress, and for its default backend.
+func (p *ExposureTransformer) ingressToRoutes(ingress map[string]interface{}, services map[string]map[string]interface{},
+	secrets map[string]map[string]interface{}) ([]map[string]interface{}, error) {
+	name, _, _ := unstructured.NestedString(ingress, "metadata", "name")
+	namespace, _, _ := unstructured.NestedString(ingress, "metadata", "namespace")
+	annotations, _, _ := unstructured.NestedStringMap(ingress, "metadata", "annotations")
+
+	type backend struct {
+		host    string
+		path    string
+		backend map[string]interface{}
+	}
+	var backends []backend
+	if b, ok, _ := unstructured.NestedMap(ingress, "spec", "defaultBackend"); ok {
+		backends = append(backends, backend{backend: b})
+	}
+	rules, _, _ := unstructured.NestedSlice(ingress, "spec", "rules")
+	for _, r := range rules {
+		rule, _ := r.(map[string]interface{})
+		host, _, _ := unstructured.NestedString(rule, "host")
+		paths, _, _ := unstructured.NestedSlice(rule, "http", "paths")
+		for _, pth := range paths {
+			path, _ := pth.(map[string]interface{})
+			p, _, _ := unstructured.NestedString(path, "path")
+			b, _, _ := unstructured.NestedMap(path, "backend")
+			backends = append(backends, backend{host: host, path: p, backend: b})
+		}
+	}
+
+	tlsEntries, _, _ := unstructured.NestedSlice(ingress, "spec", "tls")
+	var routes []map[string]interface{}
+	for i, b := range backends {
+		serviceName, _, _ := unstructured.NestedString(b.backend, "service", "name")
+		if serviceName == "" {
+			return nil, fmt.Errorf("only service backends can be converted")
+		}
+		port, _, _ := unstructured.NestedMap(b.backend, "service", "port")
+		spec := map[string]interface{}{
+			"to": map[string]interface{}{"kind": "Service", "name": serviceName, "weight": int64(100)},
+		}
+		if targetPort := routeTargetPort(services[namespace+"/"+serviceName], port); targetPort != nil {
+			spec["port"] = map[string]interface{}{"targetPort": targetPort}
+		}
+		if b.host != "" {
+			spec["host"] = b.host
+		}
+		if b.path != "" && b.path != "/" {
+			spec["path"] = b.path
+		}
+		if tls, ok := tlsEntryFor(tlsEntries, b.host); ok {
+			spec["tls"] = routeTLS(tls, annotations, secrets, namespace)
+		}
+
+		metadata := copyMetadata(ingress)
+		if len(backends) > 1 {
+			metadata["name"] = fmt.Sprintf("%v-%v", name, i)
+		}
+		routes = append(routes, map[string]interface{}{
+			"apiVersion": routeAPIVersion,
+			"kind":       "Route",
+			"metadata":   metadata,
+			"spec":       spec,
+		})
+	}
+	return routes, nil
+}
+
+// copyMetadata returns the name, namespace, labels and annotations of obj.
+func copyMetadata(obj map[string]interface{}) map[string]interface{} {
+	metadata := map[string]interface{}{}
+	for _, field := range []string{"name", "namespace", "labels", "annotations"} {
+		if v, ok, _ := unstructured.NestedFieldCopy(obj, "metadata", field); ok {
+			metadata[field] = v
+		}
+	}
+	return metadata
+}
+
+// ingressBackendPort returns the port of service the Route targetPort of its endpoints maps to:
+// a named port has the same name in the service, a number is matched against the target ports
+// of the service. Routes without a port use the first port of the service.
+func ingressBackendPort(service map[string]interface{}, targetPort interface{}) (map[string]interface{}, error) {
+	if name, ok := targetPort.(string); ok {
+		return map[string]interface{}{"name": name}, nil
+	}
+	ports, _, _ := unstructured.NestedSlice(service, "spec", "ports")
+	if targetPort == nil {
+		if len(ports) == 0 {
+			return nil, fmt.Errorf("the route has no port and the service isn't rendered with a port")
+		}
+		port, _ := ports[0].(map[string]interface{})
+		n, _ := toInt64(port["port"])
+		return map[string]interface{}{"number": n}, nil
+	}
+	target, ok := toInt64(targetPort)
+	if !ok {
+		return nil, fmt.Errorf("invalid target port %v", targetPort)
+	}
+	for _, p := range ports {
+		port, _ := p.(map[string]interface{})
+		n, _ := toInt64(port["port"])
+		t, ok := toInt64(port["targetPort"])
+		if !ok {
+			t = n
+		}
+		if t == target {
+			return map[string]interface{}{"number": n}, nil
+		}
+	}
+	return map[string]interface{}{"number": target}, nil
+}
+
+// routeTargetPort returns the Route targetPort of the endpoints the Ingress backend port of
+// service maps to, or nil to route to the first port.
+func routeTargetPort(service map[string]interface{}, port map[string]interface{}) interface{} {
+	if name, ok := port["name"].(string); ok && name != "" {
+		return name
+	}
+	number, ok := toInt64(port["number"])
+	if !ok {
+		return nil
+	}
+	ports, _, _ := unstructured.NestedSlice(service, "spec", "ports")
+	for _, p := range ports {
+		sp, _ := p.(map[string]interface{})
+		if n, _ := toInt64(sp["port"]); n != number {
+			continue
+		}
+		if name, ok := sp["name"].(string); ok && name != "" {
+			return name
+		}
+		if sp["targetPort"] != nil {
+			return sp["targetPort"]
+		}
+	}
+	return number
+}
+
+// tlsEntryFor returns the tls entry of an Ingress covering host.
+func tlsEntryFor(entries []interface{}, host string) (map[string]interface{}, bool) {
+	for _, e := range entries {
+		entry, _ := e.(map[string]interface{})
+		hosts, _, _ := unstructured.NestedStringSlice(entry, "hosts")
+		if len(hosts) == 0 {
+			return entry, true
+		}
+		for _, h := range hosts {
+			if h == host {
+				return entry, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// routeTLS returns the tls of a Route for the tls entry of an Ingress, embedding the certificate
+// of its secret if the secret is rendered with the Ingress.
+func routeTLS(entry map[string]interface{}, annotations map[string]string, secrets map[string]map[string]interface{},
+	namespace string) map[string]interface{} {
+	tls := map[string]interface{}{
+		"termination":                   "edge",
+		"insecureEdgeTerminationPolicy": "Redirect",
+	}
+	switch {
+	case annotations[sslPassthroughAnnotation] == "true":
+		return map[string]interface{}{"termination": "passthrough"}
+	case annotations[backendProtocolAnnotation] == "HTTPS":
+		tls["termination"] = "reencrypt"
+	}
+	if annotations[sslRedirectAnnotation] == "false" {
+		tls["insecureEdgeTerminationPolicy"] = "Allow"
+	}
+	secretName, _, _ := unstructured.NestedString(entry, "secretName")
+	if secret, ok := secrets[namespace+"/"+secretName]; ok && secretName != "" {
+		for field, key := range map[string]string{"certificate": "tls.crt", "key": "tls.key"} {
+			if v, ok, _ := unstructured.NestedString(secret, "stringData", key); ok {
+				tls[field] = v
+			} else if v, ok, _ := unstructured.NestedString(secret, "data", key); ok {
+				if decoded, err := base64.StdEncoding.DecodeString(v); err == nil {
+					tls[field] = string(decoded)
+				}
+			}
+		}
+	}
+	return tls
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
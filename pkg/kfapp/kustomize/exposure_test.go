@@ -0,0 +1,374 @@
+package kustomize
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+)
+
+func TestExposureTransformer(t *testing.T) {
+	type testCase struct {
+		Name     string
+		Facts    *kfconfig.ClusterFacts
+		Input    string
+		Expected string
+		Error    string
+	}
+	kubernetes := &kfconfig.ClusterFacts{Platform: kfconfig.PlatformKubernetes}
+	openShift := &kfconfig.ClusterFacts{Platform: kfconfig.PlatformOpenShift, IngressDomain: "apps.example.com"}
+
+	service := `
+apiVersion: v1
+kind: Service
+metadata:
+  name: odh-dashboard
+  namespace: opendatahub
+spec:
+  ports:
+  - name: https
+    port: 443
+    targetPort: 8443
+  - port: 80
+    targetPort: 8080
+`
+	route := `
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata:
+  name: odh-dashboard
+  namespace: opendatahub
+  labels:
+    app: odh-dashboard
+spec:
+  host: dashboard.example.com
+  to:
+    kind: Service
+    name: odh-dashboard
+  port:
+    targetPort: 8080
+  tls:
+    termination: edge
+    certificate: CERT
+    key: KEY
+    insecureEdgeTerminationPolicy: Redirect
+`
+	testCases := []testCase{
+		{
+			Name:  "route-to-ingress",
+			Facts: kubernetes,
+			Input: service + "---" + route,
+			Expected: service + `
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: odh-dashboard
+  namespace: opendatahub
+  labels:
+    app: odh-dashboard
+  annotations:
+    nginx.ingress.kubernetes.io/ssl-redirect: "true"
+spec:
+  rules:
+  - host: dashboard.example.com
+    http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: odh-dashboard
+            port:
+              number: 80
+  tls:
+  - hosts:
+    - dashboard.example.com
+    secretName: odh-dashboard-tls
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: odh-dashboard-tls
+  namespace: opendatahub
+type: kubernetes.io/tls
+stringData:
+  tls.crt: CERT
+  tls.key: KEY
+`,
+		},
+		{
+			Name:  "passthrough-route-without-host",
+			Facts: &kfconfig.ClusterFacts{Platform: kfconfig.PlatformKubernetes, IngressDomain: "example.com"},
+			Input: service + `
+---
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata:
+  name: notebooks
+  namespace: opendatahub
+spec:
+  to:
+    kind: Service
+    name: odh-dashboard
+  port:
+    targetPort: https
+  tls:
+    termination: passthrough
+`,
+			Expected: service + `
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: notebooks
+  namespace: opendatahub
+  annotations:
+    nginx.ingress.kubernetes.io/ssl-passthrough: "true"
+spec:
+  rules:
+  - host: notebooks-opendatahub.example.com
+    http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: odh-dashboard
+            port:
+              name: https
+  tls:
+  - hosts:
+    - notebooks-opendatahub.example.com
+`,
+		},
+		{
+			Name:  "ingress-to-routes",
+			Facts: openShift,
+			Input: service + `
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: dashboard-cert
+  namespace: opendatahub
+type: kubernetes.io/tls
+data:
+  tls.crt: Q0VSVA==
+  tls.key: S0VZ
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: odh-dashboard
+  namespace: opendatahub
+spec:
+  rules:
+  - host: dashboard.example.com
+    http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: odh-dashboard
+            port:
+              number: 443
+      - path: /api
+        pathType: Prefix
+        backend:
+          service:
+            name: odh-dashboard
+            port:
+              number: 80
+  tls:
+  - hosts:
+    - dashboard.example.com
+    secretName: dashboard-cert
+`,
+			Expected: service + `
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: dashboard-cert
+  namespace: opendatahub
+type: kubernetes.io/tls
+data:
+  tls.crt: Q0VSVA==
+  tls.key: S0VZ
+---
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata:
+  name: odh-dashboard-0
+  namespace: opendatahub
+spec:
+  host: dashboard.example.com
+  to:
+    kind: Service
+    name: odh-dashboard
+    weight: 100
+  port:
+    targetPort: https
+  tls:
+    termination: edge
+    insecureEdgeTerminationPolicy: Redirect
+    certificate: CERT
+    key: KEY
+---
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata:
+  name: odh-dashboard-1
+  namespace: opendatahub
+spec:
+  host: dashboard.example.com
+  path: /api
+  to:
+    kind: Service
+    name: odh-dashboard
+    weight: 100
+  port:
+    targetPort: 8080
+  tls:
+    termination: edge
+    insecureEdgeTerminationPolicy: Redirect
+    certificate: CERT
+    key: KEY
+`,
+		},
+		{
+			Name:     "routes-kept-on-openshift",
+			Facts:    openShift,
+			Input:    service + "---" + route,
+			Expected: service + "---" + route,
+		},
+		{
+			Name:  "keep-exposure",
+			Facts: kubernetes,
+			Input: service + `
+---
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata:
+  name: odh-dashboard
+  annotations:
+    opendatahub.io/keep-exposure: "true"
+spec:
+  to:
+    name: odh-dashboard
+`,
+			Expected: service + `
+---
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata:
+  name: odh-dashboard
+  annotations:
+    opendatahub.io/keep-exposure: "true"
+spec:
+  to:
+    name: odh-dashboard
+`,
+		},
+		{
+			Name:     "facts-not-collected",
+			Input:    service + "---" + route,
+			Expected: service + "---" + route,
+		},
+		{
+			Name:  "knative-route-kept",
+			Facts: kubernetes,
+			Input: `
+apiVersion: serving.knative.dev/v1
+kind: Route
+metadata:
+  name: model
+spec:
+  traffic:
+  - configurationName: model
+    percent: 100
+`,
+			Expected: `
+apiVersion: serving.knative.dev/v1
+kind: Route
+metadata:
+  name: model
+spec:
+  traffic:
+  - configurationName: model
+    percent: 100
+`,
+		},
+		{
+			Name:  "v1beta1-ingress-kept-on-openshift",
+			Facts: openShift,
+			Input: service + `
+---
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: odh-dashboard
+  namespace: opendatahub
+spec:
+  rules:
+  - host: dashboard.example.com
+    http:
+      paths:
+      - path: /
+        backend:
+          serviceName: odh-dashboard
+          servicePort: 80
+`,
+			Expected: service + `
+---
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: odh-dashboard
+  namespace: opendatahub
+spec:
+  rules:
+  - host: dashboard.example.com
+    http:
+      paths:
+      - path: /
+        backend:
+          serviceName: odh-dashboard
+          servicePort: 80
+`,
+		},
+		{
+			Name:  "route-without-port-to-unknown-service",
+			Facts: kubernetes,
+			Input: `
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata:
+  name: notebooks
+spec:
+  to:
+    kind: Service
+    name: notebooks
+`,
+			Error: "could not convert Route notebooks: service notebooks: the route has no port",
+		},
+	}
+
+	for _, c := range testCases {
+		m := newResMapFromYaml(t, c.Input)
+		p := &ExposureTransformer{Facts: c.Facts}
+		err := p.Transform(m)
+		if c.Error != "" {
+			if err == nil || !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("Case %v: expected error containing %v; got %v", c.Name, c.Error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Case %v: failed to transform: %v", c.Name, err)
+		}
+		assertResMapYaml(t, c.Name, m, c.Expected)
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"sigs.k8s.io/kustomize/v3/pkg/transformers/config"
 	"strconv"
 	"strings"
@@ -60,6 +61,7 @@ import (
 	"sigs.k8s.io/kustomize/v3/k8sdeps/kunstruct"
 	"sigs.k8s.io/kustomize/v3/k8sdeps/transformer"
 	"sigs.k8s.io/kustomize/v3/pkg/fs"
+	"sigs.k8s.io/kustomize/v3/pkg/gvk"
 	"sigs.k8s.io/kustomize/v3/pkg/ifc"
 	"sigs.k8s.io/kustomize/v3/pkg/image"
 	"sigs.k8s.io/kustomize/v3/pkg/loader"
@@ -170,10 +172,25 @@ func (kustomize *kustomize) render(app kfconfig.Application) ([]byte, error) {
 		}
 	}
 
+	return GenerateYaml(kustomize.kfDef, app, resMap)
+}
+
+// GenerateYaml runs the render-time transformers configured for app over resMap, sorts the
+// resources in install order and encodes them as yaml, setting the operator annotations when
+// the KfDef asks for them. Every package manager renders its applications through it.
+func GenerateYaml(kfDef *kfconfig.KfConfig, app kfconfig.Application, resMap resmap.ResMap) ([]byte, error) {
+	if err := transform(kfDef, app, resMap); err != nil {
+		log.Errorf("Error transforming resources for %v: %v", app.Name, err)
+		return nil, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("error transforming resources for %v: %v", app.Name, err),
+		}
+	}
+
 	sortResourceByKind(resMap, utils.InstallOrder)
 
 	// check to set owner references for resources if installed through kubeflow operator
-	annotations := kustomize.kfDef.GetAnnotations()
+	annotations := kfDef.GetAnnotations()
 	setOperatorAnnotation := false
 	if setOperator, ok := annotations[strings.Join([]string{utils.KfDefAnnotation, utils.SetAnnotation}, "/")]; ok {
 		if setOperatorBool, err := strconv.ParseBool(setOperator); err == nil {
@@ -194,7 +211,7 @@ func (kustomize *kustomize) render(app kfconfig.Application) ([]byte, error) {
 			}
 		}
 		kfDefRes := schema.GroupVersionResource{Group: "kfdef.apps.kubeflow.org", Version: "v1", Resource: "kfdefs"}
-		instance, err := dyn.Resource(kfDefRes).Namespace(kustomize.kfDef.GetNamespace()).Get(context.TODO(), kustomize.kfDef.GetName(), metav1.GetOptions{})
+		instance, err := dyn.Resource(kfDefRes).Namespace(kfDef.GetNamespace()).Get(context.TODO(), kfDef.GetName(), metav1.GetOptions{})
 		if err != nil {
 			return nil, &kfapisv3.KfError{
 				Code:    int(kfapisv3.INTERNAL_ERROR),
@@ -209,6 +226,7 @@ func (kustomize *kustomize) render(app kfconfig.Application) ([]byte, error) {
 			}
 		}
 	} else {
+		var err error
 		data, err = resMap.AsYaml()
 		if err != nil {
 			return nil, &kfapisv3.KfError{
@@ -220,11 +238,38 @@ func (kustomize *kustomize) render(app kfconfig.Application) ([]byte, error) {
 	return data, nil
 }
 
+// transform runs the render-time transformers configured for app over its resources.
+func transform(kfDef *kfconfig.KfConfig, app kfconfig.Application, resMap resmap.ResMap) error {
+	transformers := []resmap.Transformer{
+		&DeploymentConfigTransformer{
+			Enabled: convertDeploymentConfigs(kfDef),
+		},
+		&ExposureTransformer{
+			Facts: kfDef.Status.ClusterFacts,
+		},
+		&PlacementTransformer{
+			Placement: mergePlacement(kfDef.Spec.Placement, app.Placement),
+		},
+		&ResourcesTransformer{
+			Resources: app.Resources,
+		},
+	}
+	for _, t := range transformers {
+		if err := t.Transform(resMap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Dump prints the kustomize generated resources to stdout
 func (kustomize *kustomize) Dump(resources kftypesv3.ResourceEnum) error {
 
 	applications := make(map[string]bool)
 	for _, app := range kustomize.kfDef.Spec.Applications {
+		if app.HelmConfig != nil {
+			continue
+		}
 		if applications[app.Name] == true {
 			// if the application name already
 			continue
@@ -266,13 +311,26 @@ func (kustomize *kustomize) Apply(resources kftypesv3.ResourceEnum) error {
 		}
 	}
 
-	applications := make(map[string]bool)
-	for _, app := range kustomize.kfDef.Spec.Applications {
-		if applications[app.Name] == true {
-			// if the application name already
-			continue
+	// Applications using the outputs of others are applied after them.
+	applications, err := kustomize.applyOrder()
+	if err != nil {
+		return err
+	}
+	kustomizeDir := path.Join(kustomize.kfDef.Spec.AppDir, outputDir)
+	var pendingMigrations []string
+	for _, app := range applications {
+		if _, err := os.Stat(path.Join(kustomizeDir, app.Name)); os.IsNotExist(err) {
+			// Generate deferred the application until the outputs it uses were read.
+			if err := kustomize.Generate(kftypesv3.K8S); err != nil {
+				return err
+			}
+			if _, err := os.Stat(path.Join(kustomizeDir, app.Name)); os.IsNotExist(err) {
+				return &kfapisv3.KfError{
+					Code:    int(kfapisv3.INTERNAL_ERROR),
+					Message: fmt.Sprintf("couldn't generate application %v: the outputs it uses aren't available yet", app.Name),
+				}
+			}
 		}
-		applications[app.Name] = true
 
 		log.Infof("Deploying application %v", app.Name)
 		data, err := kustomize.render(app)
@@ -280,27 +338,27 @@ func (kustomize *kustomize) Apply(resources kftypesv3.ResourceEnum) error {
 			return err
 		}
 
-		// TODO(https://github.com/kubeflow/manifests/issues/806): Bump the timeout because cert-manager takes
-		// a long time to start. Any application that needs to create a certificate will fail because it won't
-		// be able to create certificates if cert-manager is unavailable. We should try to identify Permanent Errors
-		// and return a PermanentError to avoid retrying and taking 10 minutes to fail.
-		b := utils.NewDefaultBackoff()
-		b.MaxElapsedTime = 10 * time.Minute
-		err = backoff.RetryNotify(
-			func() error {
-				return apply.Apply(data)
-			},
-			b,
-			func(e error, duration time.Duration) {
-				log.Warnf("Encountered error applying application %v: %v", app.Name, e)
-				log.Warnf("Will retry in %.0f seconds.", duration.Seconds())
-			})
+		if err := ApplyApplication(apply, app.Name, data); err != nil {
+			return err
+		}
+		pending, err := kustomize.migrateDeploymentConfigs(app, data)
 		if err != nil {
-			log.Errorf("Permanently failed applying application %v: %v", app.Name, err)
 			return err
 		}
-		log.Infof("Successfully applied application %v", app.Name)
+		pendingMigrations = append(pendingMigrations, pending...)
+		// Applications using outputs are generated with their values from the status, which are
+		// those of the previous reconcile; they're generated again when a value changed.
+		changed, err := kustomize.readOutputs(app)
+		if err != nil {
+			return err
+		}
+		if changed {
+			if err := kustomize.removeStaleDependents(app, kustomizeDir); err != nil {
+				return err
+			}
+		}
 	}
+	kustomize.setDeploymentConfigMigrationCondition(pendingMigrations)
 
 	// Default user namespace when multi-tenancy enabled
 	defaultProfileNamespace := kftypesv3.EmailToDefaultName(kustomize.kfDef.Spec.Email)
@@ -324,6 +382,31 @@ func (kustomize *kustomize) Apply(resources kftypesv3.ResourceEnum) error {
 	return nil
 }
 
+// ApplyApplication applies the rendered resources of the application appName, retrying on failure.
+func ApplyApplication(apply *utils.Apply, appName string, data []byte) error {
+	// TODO(https://github.com/kubeflow/manifests/issues/806): Bump the timeout because cert-manager takes
+	// a long time to start. Any application that needs to create a certificate will fail because it won't
+	// be able to create certificates if cert-manager is unavailable. We should try to identify Permanent Errors
+	// and return a PermanentError to avoid retrying and taking 10 minutes to fail.
+	b := utils.NewDefaultBackoff()
+	b.MaxElapsedTime = 10 * time.Minute
+	err := backoff.RetryNotify(
+		func() error {
+			return apply.Apply(data)
+		},
+		b,
+		func(e error, duration time.Duration) {
+			log.Warnf("Encountered error applying application %v: %v", appName, e)
+			log.Warnf("Will retry in %.0f seconds.", duration.Seconds())
+		})
+	if err != nil {
+		log.Errorf("Permanently failed applying application %v: %v", appName, err)
+		return err
+	}
+	log.Infof("Successfully applied application %v", appName)
+	return nil
+}
+
 // deleteGlobalResources is called from Delete and deletes CRDs, ClusterRoles, ClusterRoleBindings
 func (kustomize *kustomize) deleteGlobalResources() error {
 	if err := kustomize.initK8sClients(); err != nil {
@@ -436,6 +519,9 @@ func (kustomize *kustomize) Delete(resources kftypesv3.ResourceEnum) error {
 	errList := []error{}
 	for idx := range kustomize.kfDef.Spec.Applications {
 		app := &kustomize.kfDef.Spec.Applications[len(kustomize.kfDef.Spec.Applications)-1-idx]
+		if app.HelmConfig != nil {
+			continue
+		}
 		log.Infof("Deleting application %v", app.Name)
 		resMap, err := EvaluateKustomizeManifest(path.Join(kustomizeDir, app.Name))
 		if err != nil {
@@ -541,11 +627,18 @@ func (kustomize *kustomize) Generate(resources kftypesv3.ResourceEnum) error {
 		if _, err := os.Stat(kustomizeDir); err == nil {
 			// When using the new stacks code the directory might already exist because it could have
 			// been created by calls to SetApplicationParameter. For the legacy code path (no stacks) we preserve
-			// the existing code path of not rerunning generate if the directory already exists.
+			// the existing code path of not rerunning generate for the applications whose directory already exists.
 			if !kustomize.kfDef.UsingStacks() {
-				// Noop if the directory already exists.
-				log.Infof("Folder %v exists, skip kustomize.Generate", kustomizeDir)
-				return nil
+				generated := kustomize.generatedApps(kustomizeDir)
+				missing := false
+				for _, app := range kustomize.kfDef.Spec.Applications {
+					missing = missing || !generated[app.Name]
+				}
+				if !missing {
+					// Noop if the directory of every application already exists.
+					log.Infof("Folder %v exists, skip kustomize.Generate", kustomizeDir)
+					return nil
+				}
 			}
 		} else if !os.IsNotExist(err) {
 			log.Errorf("Stat folder %v error: %v; try deleting it...", kustomizeDir, err)
@@ -577,7 +670,16 @@ func (kustomize *kustomize) Generate(resources kftypesv3.ResourceEnum) error {
 
 		// determine whether we are using the new pattern of using kustomize to build stacks.
 		// hasStack := kustomize.kfDef.UsingStacks()
+		generated := kustomize.generatedApps(kustomizeDir)
+		overlays, err := kustomize.selectOverlays()
+		if err != nil {
+			return err
+		}
 		for _, app := range kustomize.kfDef.Spec.Applications {
+			if app.HelmConfig != nil {
+				// Helm charts are rendered by the helm package manager.
+				continue
+			}
 			log.Infof("Processing application: %v", app.Name)
 
 			if app.KustomizeConfig == nil {
@@ -601,6 +703,8 @@ func (kustomize *kustomize) Generate(resources kftypesv3.ResourceEnum) error {
 			}
 
 			appPath := path.Join(repoCache.LocalPath, app.KustomizeConfig.RepoRef.Path)
+			// appSrcDir is the location of the application on disk; appPath may be made relative below.
+			appSrcDir := appPath
 
 			if kustomize.kfDef.UsingStacks() {
 
@@ -624,12 +728,46 @@ func (kustomize *kustomize) Generate(resources kftypesv3.ResourceEnum) error {
 
 				// Path to the stack inside the cache.
 				stacksCacheDir := filepath.Join("../..", appPath)
-				if _, err := createStackAppKustomization(stackAppDir, stacksCacheDir); err != nil {
-					return errors.WithStack(fmt.Errorf("There was a problem building the kustomize app for the Kubeflow application stack; %v ", err))
+				basePaths := []string{stacksCacheDir}
+				if !isPlainManifestDir(appSrcDir) {
+					// Stack applications are built from their base, without any overlay.
+					kustomizeConfig := *app.KustomizeConfig
+					kustomizeConfig.Overlays = nil
+					if err := validateParams(appSrcDir, kfconfig.Application{Name: app.Name, KustomizeConfig: &kustomizeConfig}); err != nil {
+						return err
+					}
+				} else {
+					manifests, err := plainManifests(appSrcDir, app.KustomizeConfig.Include)
+					if err != nil {
+						return errors.WithStack(fmt.Errorf("There was a problem reading the manifests of application %v; %v ", app.Name, err))
+					}
+					basePaths = []string{}
+					for _, m := range manifests {
+						basePaths = append(basePaths, filepath.Join(stacksCacheDir, m))
+					}
+				}
+				for _, basePath := range basePaths {
+					if _, err := createStackAppKustomization(stackAppDir, basePath); err != nil {
+						return errors.WithStack(fmt.Errorf("There was a problem building the kustomize app for the Kubeflow application stack; %v ", err))
+					}
+				}
+				if err := addInlinePatches(stackAppDir, app.KustomizeConfig); err != nil {
+					return &kfapisv3.KfError{
+						Code:    int(kfapisv3.INTERNAL_ERROR),
+						Message: fmt.Sprintf("couldn't add patches for application %s: %v", app.Name, err),
+					}
 				}
 			} else {
 				// TODO(jlewi): This code path should eventually go away once we are fully migrated to the use
 				// of stacks.
+				if generated[app.Name] {
+					log.Infof("Folder %v exists, skip generating application %v", path.Join(kustomizeDir, app.Name), app.Name)
+					continue
+				}
+				// Apply the overlays selected for the cluster.
+				kustomizeConfig := *app.KustomizeConfig
+				kustomizeConfig.Overlays = overlays[app.Name]
+				app.KustomizeConfig = &kustomizeConfig
 				// Copy the component to kustomizeDir
 				if err := copy.Copy(appPath, path.Join(kustomizeDir, app.Name)); err != nil {
 					return &kfapisv3.KfError{
@@ -637,13 +775,40 @@ func (kustomize *kustomize) Generate(resources kftypesv3.ResourceEnum) error {
 						Message: fmt.Sprintf("couldn't copy application %s: %v", app.Name, err),
 					}
 				}
-				if err := GenerateKustomizationFile(kustomize.kfDef, kustomizeDir, app.Name,
+				if isPlainManifestDir(path.Join(kustomizeDir, app.Name)) {
+					// A directory of raw manifests; list them in a generated kustomization.yaml.
+					if len(app.KustomizeConfig.Overlays) > 0 {
+						log.Warnf("Ignoring overlays of application %v: %v is not a kustomize package", app.Name, appSrcDir)
+					}
+					if err := generatePlainManifestKustomization(path.Join(kustomizeDir, app.Name),
+						kustomize.kfDef.Namespace, app.KustomizeConfig.Include); err != nil {
+						return &kfapisv3.KfError{
+							Code:    int(kfapisv3.INTERNAL_ERROR),
+							Message: fmt.Sprintf("couldn't generate kustomization file for component %s: %v", app.Name, err),
+						}
+					}
+				} else if err := validateParams(path.Join(kustomizeDir, app.Name), app); err != nil {
+					_ = os.RemoveAll(path.Join(kustomizeDir, app.Name))
+					return err
+				} else if err := GenerateKustomizationFile(kustomize.kfDef, kustomizeDir, app.Name,
 					app.KustomizeConfig.Overlays, app.KustomizeConfig.Parameters); err != nil {
+					if isOutputNotAvailableError(err) {
+						// Generated by Apply once the applications it depends on are applied.
+						log.Infof("Deferring application %v until the outputs it uses are available: %v", app.Name, err)
+						_ = os.RemoveAll(path.Join(kustomizeDir, app.Name))
+						continue
+					}
 					return &kfapisv3.KfError{
 						Code:    int(kfapisv3.INTERNAL_ERROR),
 						Message: fmt.Sprintf("couldn't generate kustomization file for component %s: %v", app.Name, err),
 					}
 				}
+				if err := addInlinePatches(path.Join(kustomizeDir, app.Name), app.KustomizeConfig); err != nil {
+					return &kfapisv3.KfError{
+						Code:    int(kfapisv3.INTERNAL_ERROR),
+						Message: fmt.Sprintf("couldn't add patches for application %s: %v", app.Name, err),
+					}
+				}
 			}
 		}
 		return nil
@@ -662,6 +827,66 @@ func (kustomize *kustomize) Generate(resources kftypesv3.ResourceEnum) error {
 	return nil
 }
 
+// generatedApps returns the applications already generated in kustomizeDir. Helm charts don't
+// need to be generated. The directory of an application is removed to generate it again, e.g.
+// when its repo changed.
+func (kustomize *kustomize) generatedApps(kustomizeDir string) map[string]bool {
+	apps := map[string]bool{}
+	for _, app := range kustomize.kfDef.Spec.Applications {
+		if app.HelmConfig != nil {
+			apps[app.Name] = true
+		} else if _, err := os.Stat(path.Join(kustomizeDir, app.Name)); err == nil {
+			apps[app.Name] = true
+		}
+	}
+	return apps
+}
+
+// selectOverlays returns the overlays of each kustomize application, including the conditional
+// overlays matching the cluster, and records them in the status of the KfDef. The facts about
+// the cluster are only needed by applications with conditional overlays. Stacks render no
+// overlays, so conditional overlays are rejected when using them.
+func (kustomize *kustomize) selectOverlays() (map[string][]string, error) {
+	overlays := map[string][]string{}
+	if kustomize.kfDef.UsingStacks() {
+		// Stack applications are built from their base, so no overlay is rendered.
+		for _, app := range kustomize.kfDef.Spec.Applications {
+			if app.KustomizeConfig != nil && len(app.KustomizeConfig.ConditionalOverlays) > 0 {
+				return nil, &kfapisv3.KfError{
+					Code:    int(kfapisv3.INVALID_ARGUMENT),
+					Message: fmt.Sprintf("application %v has conditionalOverlays, which aren't supported when using the %v stack", app.Name, kfconfig.KfAppsStackName),
+				}
+			}
+		}
+		kustomize.kfDef.Status.Overlays = nil
+		return overlays, nil
+	}
+	var status []kfconfig.ApplicationOverlays
+	for _, app := range kustomize.kfDef.Spec.Applications {
+		if app.KustomizeConfig == nil {
+			continue
+		}
+		overlays[app.Name] = app.KustomizeConfig.Overlays
+		if len(app.KustomizeConfig.ConditionalOverlays) > 0 {
+			facts, err := kustomize.kfDef.GetClusterFacts()
+			if err != nil {
+				return nil, &kfapisv3.KfError{
+					Code:    int(kfapisv3.INTERNAL_ERROR),
+					Message: fmt.Sprintf("couldn't get the facts about the cluster for the overlays of application %v: %v", app.Name, err),
+				}
+			}
+			if overlays[app.Name], err = app.KustomizeConfig.SelectOverlays(facts); err != nil {
+				return nil, err
+			}
+		}
+		if len(overlays[app.Name]) > 0 || len(app.KustomizeConfig.ConditionalOverlays) > 0 {
+			status = append(status, kfconfig.ApplicationOverlays{Name: app.Name, Overlays: overlays[app.Name]})
+		}
+	}
+	kustomize.kfDef.Status.Overlays = status
+	return overlays, nil
+}
+
 // createStackAppKustomization generates a kustomization.yaml file suitable for the kubeflow application stack.
 // stackAppDir is the directory to create for the kustomize package.
 // basePath is the path to the kustomize package to use as the base package.
@@ -736,6 +961,70 @@ func createStackAppKustomization(stackAppDir string, basePath string) (string, e
 	return kustomizationFile, nil
 }
 
+// addInlinePatches adds the inline patches of the application's KustomizeConfig to the
+// kustomization.yaml in appDir. Patches that are already listed are not added again.
+func addInlinePatches(appDir string, config *kfconfig.KustomizeConfig) error {
+	if len(config.PatchesStrategicMerge) == 0 && len(config.PatchesJson6902) == 0 {
+		return nil
+	}
+	kustomizationFile := filepath.Join(appDir, kftypesv3.KustomizationFile)
+	contents, err := ioutil.ReadFile(kustomizationFile)
+	if err != nil {
+		return errors.WithStack(errors.Wrapf(err, "Failed to read: %v", kustomizationFile))
+	}
+	kustomization := &types.Kustomization{}
+	if err := yaml.Unmarshal(contents, kustomization); err != nil {
+		return errors.WithStack(errors.Wrapf(err, "Failed to unmashal %v", kustomizationFile))
+	}
+
+	for _, patch := range config.PatchesStrategicMerge {
+		smp := types.PatchStrategicMerge(patch)
+		exists := false
+		for _, p := range kustomization.PatchesStrategicMerge {
+			if p == smp {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			kustomization.PatchesStrategicMerge = append(kustomization.PatchesStrategicMerge, smp)
+		}
+	}
+	for _, patch := range config.PatchesJson6902 {
+		if patch.Target == nil || patch.Target.Name == "" {
+			return fmt.Errorf("patchesJson6902 entry is missing a target name")
+		}
+		jsonPatch := types.PatchJson6902{
+			Target: &types.PatchTarget{
+				Gvk: gvk.Gvk{
+					Group:   patch.Target.Group,
+					Version: patch.Target.Version,
+					Kind:    patch.Target.Kind,
+				},
+				Name:      patch.Target.Name,
+				Namespace: patch.Target.Namespace,
+			},
+			Patch: patch.Patch,
+		}
+		exists := false
+		for _, p := range kustomization.PatchesJson6902 {
+			if reflect.DeepEqual(p, jsonPatch) {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			kustomization.PatchesJson6902 = append(kustomization.PatchesJson6902, jsonPatch)
+		}
+	}
+
+	buf, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return errors.WithStack(errors.Wrapf(err, "Error trying to marshal kustomization %v", kustomizationFile))
+	}
+	return ioutil.WriteFile(kustomizationFile, buf, 0644)
+}
+
 // Init is called from 'kfctl init ...' and creates a <deployment> directory with an app.yaml file that
 // holds deployment information like components, parameters
 func (kustomize *kustomize) Init(resources kftypesv3.ResourceEnum) error {
@@ -870,6 +1159,10 @@ func MergeKustomization(compDir string, targetDir string, kfDef *kfconfig.KfConf
 					Message: fmt.Sprintf("could not open %v: %v", paramFile, paramFileErr),
 				}
 			}
+			schema, schemaErr := kfconfig.LoadParamSchema(targetDir)
+			if schemaErr != nil {
+				return schemaErr
+			}
 			// in params.env look for name=value that we can substitute from componentParams[component]
 			// or if there is just namespace= or project= - fill in the values from KfDef
 			for i, param := range params {
@@ -895,7 +1188,30 @@ func MergeKustomization(compDir string, targetDir string, kfDef *kfconfig.KfConf
 					case "project":
 						params[i] = paramName + "=" + kfDef.Spec.Project
 					}
+					// fall back to the default declared in params.schema.yaml
+					if schema != nil && params[i] == paramName+"=" {
+						if d := schema.Declaration(paramName); d != nil && d.Default != "" {
+							params[i] = paramName + "=" + d.Default
+						}
+					}
+				}
+			}
+			// expand the expressions in the values, e.g. ${kfdef.namespace} or ${app:name.param}
+			resolver := newParamResolver(kfDef)
+			for i, param := range params {
+				arr := strings.SplitN(param, "=", 2)
+				if len(arr) != 2 || strings.HasPrefix(strings.TrimSpace(arr[0]), "#") {
+					continue
+				}
+				val, expandErr := resolver.expand(arr[1])
+				if expandErr != nil {
+					return &kfapisv3.KfError{
+						Code:    int(kfapisv3.INVALID_ARGUMENT),
+						Message: fmt.Sprintf("could not evaluate param %v in %v: %v", arr[0], paramFile, expandErr),
+						Err:     expandErr,
+					}
 				}
+				params[i] = arr[0] + "=" + val
 			}
 			paramFileErr = writeLines(params, paramFile)
 			if paramFileErr != nil {
@@ -1126,6 +1442,7 @@ func MergeKustomizations(kfDef *kfconfig.KfConfig, compDir string, overlayParams
 			return nil, &kfapisv3.KfError{
 				Code:    int(kfapisv3.INTERNAL_ERROR),
 				Message: fmt.Sprintf("error merging kustomization at %v: %v", baseDir, err),
+				Err:     err,
 			}
 		}
 	}
@@ -1147,6 +1464,7 @@ func MergeKustomizations(kfDef *kfconfig.KfConfig, compDir string, overlayParams
 				return nil, &kfapisv3.KfError{
 					Code:    int(kfapisv3.INTERNAL_ERROR),
 					Message: fmt.Sprintf("error merging kustomization at %v: %v", overlayDir, err),
+					Err:     err,
 				}
 			}
 		} else {
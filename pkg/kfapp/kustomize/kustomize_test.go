@@ -7,7 +7,16 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/kunstruct"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/transformer"
+	"sigs.k8s.io/kustomize/v3/pkg/fs"
+	"sigs.k8s.io/kustomize/v3/pkg/loader"
+	"sigs.k8s.io/kustomize/v3/pkg/plugins"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/kustomize/v3/pkg/resource"
+	"sigs.k8s.io/kustomize/v3/pkg/target"
 	"sigs.k8s.io/kustomize/v3/pkg/types"
+	"sigs.k8s.io/kustomize/v3/pkg/validators"
 	"strings"
 	"testing"
 
@@ -213,3 +222,179 @@ func TestCreateStackAppKustomization(t *testing.T) {
 		}
 	}
 }
+
+// TestAddInlinePatches tests that the inline patches of a KustomizeConfig are added to the
+// kustomization.yaml and applied when the package is evaluated.
+func TestAddInlinePatches(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	files := map[string]string{
+		"kustomization.yaml": `
+apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+- deployment.yaml
+`,
+		"deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dashboard
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: dashboard
+        image: dashboard
+`,
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(path.Join(testDir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write %v: %v", name, err)
+		}
+	}
+
+	config := &kfconfig.KustomizeConfig{
+		PatchesStrategicMerge: []string{`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dashboard
+spec:
+  template:
+    spec:
+      containers:
+      - name: dashboard
+        env:
+        - name: LOG_LEVEL
+          value: debug
+`},
+		PatchesJson6902: []kfconfig.PatchJson6902{
+			{
+				Target: &kfconfig.PatchTarget{
+					Group:   "apps",
+					Version: "v1",
+					Kind:    "Deployment",
+					Name:    "dashboard",
+				},
+				Patch: `[{"op": "replace", "path": "/spec/replicas", "value": 3}]`,
+			},
+		},
+	}
+	// Generate may run more than once for the same application.
+	for i := 0; i < 2; i++ {
+		if err := addInlinePatches(testDir, config); err != nil {
+			t.Fatalf("Failed to add inline patches: %v", err)
+		}
+	}
+
+	kustomization := GetKustomization(testDir)
+	if len(kustomization.PatchesStrategicMerge) != 1 || len(kustomization.PatchesJson6902) != 1 {
+		t.Fatalf("Expected one patch of each type; got %v and %v", kustomization.PatchesStrategicMerge, kustomization.PatchesJson6902)
+	}
+
+	resMap := buildKustomization(t, testDir)
+	actual, err := resMap.AsYaml()
+	if err != nil {
+		t.Fatalf("Failed to encode resources: %v", err)
+	}
+	expected := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dashboard
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - env:
+        - name: LOG_LEVEL
+          value: debug
+        image: dashboard
+        name: dashboard
+`
+	if diff := cmp.Diff(expected, string(actual)); diff != "" {
+		t.Errorf("Unexpected resources (-want, +got):\n%s", diff)
+	}
+}
+
+// buildKustomization builds the kustomize package in dir with kustomize alone;
+// EvaluateKustomizeManifest also needs a cluster.
+func buildKustomization(t *testing.T, dir string) resmap.ResMap {
+	ldr, err := loader.NewLoader(loader.RestrictionNone, validators.MakeFakeValidator(), dir, fs.MakeFsOnDisk())
+	if err != nil {
+		t.Fatalf("Failed to create loader: %v", err)
+	}
+	defer ldr.Cleanup()
+	rf := resmap.NewFactory(resource.NewFactory(kunstruct.NewKunstructuredFactoryImpl()), transformer.NewFactoryImpl())
+	kt, err := target.NewKustTarget(ldr, rf, transformer.NewFactoryImpl(), plugins.NewLoader(plugins.DefaultPluginConfig(), rf))
+	if err != nil {
+		t.Fatalf("Failed to create kustomize target: %v", err)
+	}
+	resMap, err := kt.MakeCustomizedResMap()
+	if err != nil {
+		t.Fatalf("Failed to build kustomization: %v", err)
+	}
+	return resMap
+}
+
+func TestSelectOverlays(t *testing.T) {
+	kfDef := &kfconfig.KfConfig{
+		Spec: kfconfig.KfConfigSpec{
+			Applications: []kfconfig.Application{
+				{
+					Name: "odh-dashboard",
+					KustomizeConfig: &kfconfig.KustomizeConfig{
+						Overlays: []string{"odh"},
+						ConditionalOverlays: []kfconfig.ConditionalOverlay{
+							{Name: "route", WhenAPIGroupPresent: "route.openshift.io"},
+							{Name: "ingress", WhenPlatform: kfconfig.PlatformKubernetes},
+						},
+					},
+				},
+				{
+					Name:            "odh-common",
+					KustomizeConfig: &kfconfig.KustomizeConfig{},
+				},
+			},
+		},
+		Status: kfconfig.Status{
+			ClusterFacts: &kfconfig.ClusterFacts{
+				Platform:  kfconfig.PlatformOpenShift,
+				Version:   "4.10.3",
+				APIGroups: []string{"route.openshift.io"},
+			},
+		},
+	}
+	overlays, err := (&kustomize{kfDef: kfDef}).selectOverlays()
+	if err != nil {
+		t.Fatalf("Failed to select the overlays: %v", err)
+	}
+	expected := map[string][]string{"odh-dashboard": {"odh", "route"}, "odh-common": nil}
+	if !cmp.Equal(overlays, expected) {
+		t.Errorf("Unexpected overlays: %v", cmp.Diff(expected, overlays))
+	}
+	status := []kfconfig.ApplicationOverlays{{Name: "odh-dashboard", Overlays: []string{"odh", "route"}}}
+	if !cmp.Equal(kfDef.Status.Overlays, status) {
+		t.Errorf("Unexpected overlays in the status: %v", cmp.Diff(status, kfDef.Status.Overlays))
+	}
+
+	// Stacks render no overlays, so conditional ones are rejected rather than misreported.
+	kfDef.Spec.Applications = append(kfDef.Spec.Applications, kfconfig.Application{Name: kfconfig.KfAppsStackName})
+	if _, err := (&kustomize{kfDef: kfDef}).selectOverlays(); err == nil ||
+		!strings.Contains(err.Error(), "application odh-dashboard has conditionalOverlays, which aren't supported when using the kubeflow-apps stack") {
+		t.Errorf("Expected conditional overlays to be rejected with stacks; got %v", err)
+	}
+	kfDef.Spec.Applications[0].KustomizeConfig.ConditionalOverlays = nil
+	if overlays, err = (&kustomize{kfDef: kfDef}).selectOverlays(); err != nil {
+		t.Fatalf("Failed to select the overlays with stacks: %v", err)
+	}
+	if len(overlays["odh-dashboard"]) != 0 || kfDef.Status.Overlays != nil {
+		t.Errorf("Expected no overlays with stacks; got %v and status %v", overlays, kfDef.Status.Overlays)
+	}
+}
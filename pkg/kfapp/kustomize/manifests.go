@@ -0,0 +1,146 @@
+package kustomize
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	kftypesv3 "github.com/opendatahub-io/opendatahub-operator/apis/apps"
+	log "github.com/sirupsen/logrus"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/kustomize/v3/pkg/types"
+)
+
+// manifestExtensions are the file extensions read from a plain manifest directory.
+var manifestExtensions = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+}
+
+// isPlainManifestDir returns true if dir holds raw manifests rather than a kustomize package,
+// i.e. neither dir nor dir/base contain a kustomization.yaml.
+func isPlainManifestDir(dir string) bool {
+	for _, d := range []string{dir, filepath.Join(dir, "base")} {
+		if _, err := os.Stat(filepath.Join(d, kftypesv3.KustomizationFile)); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// plainManifests returns the manifests found recursively in dir as sorted paths relative to dir.
+// When include is set only the files matching one of its glob patterns are returned; patterns
+// without a slash are matched against the file name, the others against the relative path.
+// Files without a Kubernetes object, e.g. a params.schema.yaml, are skipped.
+func plainManifests(dir string, include []string) ([]string, error) {
+	for _, pattern := range include {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid include pattern %v: %v", pattern, err)
+		}
+	}
+	var manifests []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && p != dir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || !manifestExtensions[filepath.Ext(p)] {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == kftypesv3.KustomizationFile || !matchesInclude(rel, include) {
+			return nil
+		}
+		if ok, err := isManifest(p); err != nil {
+			return err
+		} else if !ok {
+			log.Infof("Skipping %v: it holds no Kubernetes object", p)
+			return nil
+		}
+		manifests = append(manifests, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(manifests)
+	return manifests, nil
+}
+
+// isManifest returns true if the YAML or JSON file p holds a Kubernetes object, i.e. a document
+// with an apiVersion and a kind. The metadata files of the operator, e.g. params.schema.yaml,
+// stacks.yaml or the metadata.yaml of the catalog, don't.
+func isManifest(p string) (bool, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	decoder := k8syaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		doc := map[string]interface{}{}
+		if err := decoder.Decode(&doc); err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("couldn't parse %v: %v", p, err)
+		}
+		if doc["apiVersion"] != nil && doc["kind"] != nil {
+			return true, nil
+		}
+	}
+}
+
+func matchesInclude(rel string, include []string) bool {
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		name := filepath.ToSlash(rel)
+		if !strings.Contains(pattern, "/") {
+			name = filepath.Base(rel)
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// generatePlainManifestKustomization writes a kustomization.yaml listing the manifests of the
+// plain manifest directory dir so that it is rendered like any other kustomize package.
+func generatePlainManifestKustomization(dir string, namespace string, include []string) error {
+	manifests, err := plainManifests(dir, include)
+	if err != nil {
+		return err
+	}
+	if len(manifests) == 0 {
+		return fmt.Errorf("no manifests found in %v", dir)
+	}
+	kustomization := &types.Kustomization{
+		TypeMeta: types.TypeMeta{
+			APIVersion: types.KustomizationVersion,
+			Kind:       types.KustomizationKind,
+		},
+		Namespace: namespace,
+		Resources: manifests,
+	}
+	buf, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, kftypesv3.KustomizationFile), buf, 0644)
+}
@@ -0,0 +1,118 @@
+package kustomize
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlainManifests(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	files := map[string]string{
+		"service.yaml": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: addon
+spec:
+  ports:
+  - port: 80
+`,
+		"rbac/role.yml": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: addon
+rules: []
+`,
+		".git/config.yaml":   "not: a manifest",
+		"README.md":          "# addon",
+		"params.env":         "key=value",
+		"params.schema.yaml": "params:\n- name: key\n  type: string\n",
+		"metadata.yaml":      "description: An addon.\n",
+		"stacks.yaml":        "stacks:\n- name: addons\n  applications:\n  - addon\n",
+		"empty.yaml":         "---\n# no object\n",
+	}
+	for name, contents := range files {
+		p := filepath.Join(testDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatalf("Failed to create dir for %v: %v", name, err)
+		}
+		if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write %v: %v", name, err)
+		}
+	}
+
+	type testCase struct {
+		Include  []string
+		Expected []string
+	}
+	testCases := []testCase{
+		{
+			Expected: []string{"rbac/role.yml", "service.yaml"},
+		},
+		{
+			Include:  []string{"*.yaml"},
+			Expected: []string{"service.yaml"},
+		},
+		{
+			Include:  []string{"rbac/*"},
+			Expected: []string{"rbac/role.yml"},
+		},
+	}
+	for _, c := range testCases {
+		actual, err := plainManifests(testDir, c.Include)
+		if err != nil {
+			t.Fatalf("Failed to list manifests with include %v: %v", c.Include, err)
+		}
+		if diff := cmp.Diff(c.Expected, actual); diff != "" {
+			t.Errorf("Unexpected manifests for include %v (-want, +got):\n%s", c.Include, diff)
+		}
+	}
+
+	if !isPlainManifestDir(testDir) {
+		t.Fatalf("Expected %v to be a plain manifest directory", testDir)
+	}
+	if err := generatePlainManifestKustomization(testDir, "opendatahub", nil); err != nil {
+		t.Fatalf("Failed to generate kustomization: %v", err)
+	}
+	if isPlainManifestDir(testDir) {
+		t.Errorf("Expected %v to be a kustomize package once its kustomization.yaml is generated", testDir)
+	}
+
+	actual, err := buildKustomization(t, testDir).AsYaml()
+	if err != nil {
+		t.Fatalf("Failed to encode resources: %v", err)
+	}
+	expected := `apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: addon
+  namespace: opendatahub
+rules: []
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: addon
+  namespace: opendatahub
+spec:
+  ports:
+  - port: 80
+`
+	if diff := cmp.Diff(expected, string(actual)); diff != "" {
+		t.Errorf("Unexpected resources (-want, +got):\n%s", diff)
+	}
+
+	if _, err := plainManifests(testDir, []string{"["}); err == nil {
+		t.Errorf("Expected an error for an invalid include pattern")
+	}
+}
@@ -0,0 +1,280 @@
+package kustomize
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	kfapisv3 "github.com/opendatahub-io/opendatahub-operator/apis"
+	kftypesv3 "github.com/opendatahub-io/opendatahub-operator/apis/apps"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// outputReadTimeout is how long to wait for the objects of an application to have its outputs.
+var outputReadTimeout = 2 * time.Minute
+
+// outputNotAvailableError is the error of a param using an output of an application which
+// wasn't applied yet.
+type outputNotAvailableError struct {
+	App    string
+	Output string
+}
+
+func (e *outputNotAvailableError) Error() string {
+	return fmt.Sprintf("output %v of application %v isn't available yet", e.Output, e.App)
+}
+
+// isOutputNotAvailableError returns true if err was caused by a param using an output of an
+// application which wasn't applied yet.
+func isOutputNotAvailableError(err error) bool {
+	var notAvailable *outputNotAvailableError
+	return errors.As(err, &notAvailable)
+}
+
+// output returns the value of an output of an application referenced as application.output.
+func (r *paramResolver) output(ref string) (string, error) {
+	i := strings.LastIndex(ref, ".")
+	if i <= 0 || i == len(ref)-1 {
+		return "", fmt.Errorf("expected an application output reference <application>.<output>")
+	}
+	appName, name := ref[:i], ref[i+1:]
+	var app *kfconfig.Application
+	for i := range r.kfDef.Spec.Applications {
+		if r.kfDef.Spec.Applications[i].Name == appName {
+			app = &r.kfDef.Spec.Applications[i]
+			break
+		}
+	}
+	if app == nil {
+		return "", fmt.Errorf("the KfDef has no application %v", appName)
+	}
+	declared := false
+	for _, o := range app.Outputs {
+		declared = declared || o.Name == name
+	}
+	if !declared {
+		return "", fmt.Errorf("application %v has no output %v", appName, name)
+	}
+	value, ok := r.kfDef.GetOutput(appName, name)
+	if !ok {
+		return "", &outputNotAvailableError{App: appName, Output: name}
+	}
+	return value, nil
+}
+
+// outputDependencies returns the applications whose outputs app uses in its params, either in
+// the KfDef or in the params.env files of its repo.
+func (kustomize *kustomize) outputDependencies(app kfconfig.Application) []string {
+	var values []string
+	for _, nv := range app.KustomizeConfig.Parameters {
+		values = append(values, nv.Value)
+	}
+	if app.KustomizeConfig.RepoRef != nil {
+		if repoCache, ok := kustomize.kfDef.GetRepoCache(app.KustomizeConfig.RepoRef.Name); ok {
+			appDir := filepath.Join(repoCache.LocalPath, app.KustomizeConfig.RepoRef.Path)
+			_ = filepath.Walk(appDir, func(p string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() && info.Name() == kftypesv3.KustomizationParamFile {
+					lines, _ := readLines(p)
+					values = append(values, lines...)
+				}
+				return nil
+			})
+		}
+	}
+	var dependencies []string
+	seen := map[string]bool{}
+	for _, value := range values {
+		for _, m := range paramExpression.FindAllStringSubmatch(value, -1) {
+			expr := strings.TrimSpace(m[2])
+			if m[1] != "" || !strings.HasPrefix(expr, "output:") {
+				continue
+			}
+			ref := strings.TrimPrefix(expr, "output:")
+			if i := strings.LastIndex(ref, "."); i > 0 && !seen[ref[:i]] {
+				seen[ref[:i]] = true
+				dependencies = append(dependencies, ref[:i])
+			}
+		}
+	}
+	return dependencies
+}
+
+// applyOrder returns the kustomize applications in the order they are applied: the order of the
+// KfDef, except that an application comes after those whose outputs it uses.
+func (kustomize *kustomize) applyOrder() ([]kfconfig.Application, error) {
+	apps := map[string]kfconfig.Application{}
+	var names []string
+	for _, app := range kustomize.kfDef.Spec.Applications {
+		if app.HelmConfig != nil && len(app.Outputs) > 0 {
+			// Helm values aren't evaluated as params and charts are applied after kustomize.
+			return nil, &kfapisv3.KfError{
+				Code:    int(kfapisv3.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("application %v is a Helm chart; only kustomize applications can have outputs", app.Name),
+			}
+		}
+		if app.HelmConfig != nil || app.KustomizeConfig == nil {
+			continue
+		}
+		if _, ok := apps[app.Name]; ok {
+			continue
+		}
+		apps[app.Name] = app
+		names = append(names, app.Name)
+	}
+
+	var ordered []kfconfig.Application
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return &kfapisv3.KfError{
+				Code:    int(kfapisv3.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("applications use each other's outputs: %v", strings.Join(append(path, name), " -> ")),
+			}
+		}
+		state[name] = visiting
+		for _, dependency := range kustomize.outputDependencies(apps[name]) {
+			// Unknown applications are reported when the params are evaluated.
+			if _, ok := apps[dependency]; ok && dependency != name {
+				if err := visit(dependency, append(path, name)); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = visited
+		ordered = append(ordered, apps[name])
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// readOutputs reads the outputs of app from its applied objects into the status of the KfDef,
+// waiting for the objects to have the fields. It returns true if a value changed since the
+// outputs were last read, e.g. by the previous reconcile.
+func (kustomize *kustomize) readOutputs(app kfconfig.Application) (bool, error) {
+	if len(app.Outputs) == 0 {
+		return false, nil
+	}
+	c, err := newParamClient()
+	if err != nil {
+		return false, &kfapisv3.KfError{
+			Code:    int(kfapisv3.INTERNAL_ERROR),
+			Message: fmt.Sprintf("couldn't create a client to read the outputs of application %v: %v", app.Name, err),
+		}
+	}
+	var values []kfconfig.NameValue
+	changed := false
+	for _, output := range app.Outputs {
+		gv, err := schema.ParseGroupVersion(output.APIVersion)
+		if err != nil {
+			return false, &kfapisv3.KfError{
+				Code:    int(kfapisv3.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("output %v of application %v has an invalid apiVersion %v: %v", output.Name, app.Name, output.APIVersion, err),
+			}
+		}
+		fieldPath := output.FieldPath
+		if !strings.HasPrefix(fieldPath, "{") {
+			fieldPath = "{" + fieldPath + "}"
+		}
+		path := jsonpath.New(output.Name)
+		if err := path.Parse(fieldPath); err != nil {
+			return false, &kfapisv3.KfError{
+				Code:    int(kfapisv3.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("output %v of application %v has an invalid fieldPath %v: %v", output.Name, app.Name, output.FieldPath, err),
+			}
+		}
+		namespace := output.Namespace
+		if namespace == "" {
+			namespace = kustomize.kfDef.Namespace
+		}
+
+		var value string
+		b := utils.NewDefaultBackoff()
+		b.MaxElapsedTime = outputReadTimeout
+		err = backoff.RetryNotify(
+			func() error {
+				obj := &unstructured.Unstructured{}
+				obj.SetGroupVersionKind(gv.WithKind(output.Kind))
+				if err := c.Get(context.TODO(), k8stypes.NamespacedName{Namespace: namespace, Name: output.ObjectName}, obj); err != nil {
+					// Cluster scoped objects are looked up without a namespace.
+					clusterScoped := &unstructured.Unstructured{}
+					clusterScoped.SetGroupVersionKind(gv.WithKind(output.Kind))
+					if output.Namespace != "" || c.Get(context.TODO(), k8stypes.NamespacedName{Name: output.ObjectName}, clusterScoped) != nil {
+						return fmt.Errorf("couldn't get %v %v: %v", output.Kind, output.ObjectName, err)
+					}
+					obj = clusterScoped
+				}
+				buf := &bytes.Buffer{}
+				if err := path.Execute(buf, obj.Object); err != nil || buf.Len() == 0 {
+					return fmt.Errorf("%v %v has no %v yet", output.Kind, output.ObjectName, output.FieldPath)
+				}
+				value = buf.String()
+				return nil
+			},
+			b,
+			func(e error, duration time.Duration) {
+				log.Warnf("Output %v of application %v isn't ready: %v; will retry in %.0f seconds", output.Name, app.Name, e, duration.Seconds())
+			})
+		if err != nil {
+			return false, &kfapisv3.KfError{
+				Code:    int(kfapisv3.INTERNAL_ERROR),
+				Message: fmt.Sprintf("couldn't read output %v of application %v: %v", output.Name, app.Name, err),
+			}
+		}
+		if previous, ok := kustomize.kfDef.GetOutput(app.Name, output.Name); !ok || previous != value {
+			changed = true
+		}
+		values = append(values, kfconfig.NameValue{Name: output.Name, Value: value})
+	}
+	kustomize.kfDef.SetOutputs(app.Name, values)
+	log.Infof("Read the outputs of application %v", app.Name)
+	return changed, nil
+}
+
+// removeStaleDependents removes the generated directories of the applications using the outputs
+// of app, which were rendered with their previous values, so that Apply generates them again.
+func (kustomize *kustomize) removeStaleDependents(app kfconfig.Application, kustomizeDir string) error {
+	for _, dependent := range kustomize.kfDef.Spec.Applications {
+		if dependent.KustomizeConfig == nil || dependent.HelmConfig != nil || dependent.Name == app.Name {
+			continue
+		}
+		for _, dependency := range kustomize.outputDependencies(dependent) {
+			if dependency != app.Name {
+				continue
+			}
+			log.Infof("The outputs of application %v changed; generating application %v again", app.Name, dependent.Name)
+			if err := os.RemoveAll(filepath.Join(kustomizeDir, dependent.Name)); err != nil {
+				return &kfapisv3.KfError{
+					Code:    int(kfapisv3.INTERNAL_ERROR),
+					Message: fmt.Sprintf("couldn't remove the generated application %v: %v", dependent.Name, err),
+				}
+			}
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package kustomize
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	kfapisv3 "github.com/opendatahub-io/opendatahub-operator/apis"
+	kftypesv3 "github.com/opendatahub-io/opendatahub-operator/apis/apps"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestApplyOrder(t *testing.T) {
+	repoDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(repoDir)
+	if err := os.MkdirAll(path.Join(repoDir, "odh-dashboard", "base"), 0755); err != nil {
+		t.Fatalf("Failed to create the dashboard dir: %v", err)
+	}
+	params := "notebooksUrl=https://${output:notebook-controller.host}\n"
+	if err := ioutil.WriteFile(path.Join(repoDir, "odh-dashboard", "base", "params.env"), []byte(params), 0644); err != nil {
+		t.Fatalf("Failed to write params.env: %v", err)
+	}
+
+	app := func(name string, params ...kfconfig.NameValue) kfconfig.Application {
+		return kfconfig.Application{
+			Name: name,
+			KustomizeConfig: &kfconfig.KustomizeConfig{
+				RepoRef:    &kfconfig.RepoRef{Name: "manifests", Path: name},
+				Parameters: params,
+			},
+		}
+	}
+	type testCase struct {
+		Name         string
+		Applications []kfconfig.Application
+		Expected     []string
+		Error        string
+	}
+	testCases := []testCase{
+		{
+			Name:         "kfdef-order",
+			Applications: []kfconfig.Application{app("odh-common"), app("notebook-controller"), app("odh-dashboard")},
+			Expected:     []string{"odh-common", "notebook-controller", "odh-dashboard"},
+		},
+		{
+			Name: "dependencies-first",
+			Applications: []kfconfig.Application{
+				app("data-science-pipelines", kfconfig.NameValue{Name: "dbHost", Value: "${output:mariadb.host}"}),
+				app("odh-dashboard"),
+				app("mariadb"),
+				app("notebook-controller"),
+				{Name: "odh-dashboard-chart", HelmConfig: &kfconfig.HelmConfig{}},
+			},
+			Expected: []string{"mariadb", "data-science-pipelines", "notebook-controller", "odh-dashboard"},
+		},
+		{
+			Name: "cycle",
+			Applications: []kfconfig.Application{
+				app("a", kfconfig.NameValue{Name: "b", Value: "${output:b.url}"}),
+				app("b", kfconfig.NameValue{Name: "a", Value: "${ output:a.url }"}),
+			},
+			Error: "applications use each other's outputs: a -> b -> a",
+		},
+		{
+			Name: "helm-outputs",
+			Applications: []kfconfig.Application{
+				app("odh-dashboard", kfconfig.NameValue{Name: "url", Value: "${output:mariadb-chart.host}"}),
+				{
+					Name:       "mariadb-chart",
+					HelmConfig: &kfconfig.HelmConfig{},
+					Outputs:    []kfconfig.ApplicationOutput{{Name: "host", APIVersion: "v1", Kind: "Service", ObjectName: "mariadb"}},
+				},
+			},
+			Error: "application mariadb-chart is a Helm chart; only kustomize applications can have outputs",
+		},
+	}
+	for _, c := range testCases {
+		kfDef := &kfconfig.KfConfig{
+			Spec:   kfconfig.KfConfigSpec{Applications: c.Applications},
+			Status: kfconfig.Status{Caches: []kfconfig.Cache{{Name: "manifests", LocalPath: repoDir}}},
+		}
+		ordered, err := (&kustomize{kfDef: kfDef}).applyOrder()
+		if c.Error != "" {
+			if err == nil || !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("Case %v: expected an error containing %q; got %v", c.Name, c.Error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case %v: failed to order the applications: %v", c.Name, err)
+			continue
+		}
+		var names []string
+		for _, a := range ordered {
+			names = append(names, a.Name)
+		}
+		if !cmp.Equal(names, c.Expected) {
+			t.Errorf("Case %v: unexpected order: %v", c.Name, cmp.Diff(c.Expected, names))
+		}
+	}
+}
+
+func TestReadOutputs(t *testing.T) {
+	routeGVK := schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"}
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	scheme.AddKnownTypeWithName(routeGVK, &unstructured.Unstructured{})
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(routeGVK)
+	route.SetName("notebook-controller")
+	route.SetNamespace("opendatahub")
+	_ = unstructured.SetNestedField(route.Object, "notebooks.apps.example.com", "spec", "host")
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		route,
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "mariadb", Namespace: "db"},
+			Spec:       v1.ServiceSpec{ClusterIP: "10.0.0.12"},
+		},
+	).Build()
+	defer func(f func() (client.Client, error)) { newParamClient = f }(newParamClient)
+	newParamClient = func() (client.Client, error) {
+		return kubeClient, nil
+	}
+	defer func(d time.Duration) { outputReadTimeout = d }(outputReadTimeout)
+	outputReadTimeout = time.Second
+
+	notebooks := kfconfig.Application{
+		Name: "notebook-controller",
+		Outputs: []kfconfig.ApplicationOutput{
+			{Name: "host", APIVersion: "route.openshift.io/v1", Kind: "Route", ObjectName: "notebook-controller", FieldPath: "{.spec.host}"},
+		},
+	}
+	mariadb := kfconfig.Application{
+		Name: "mariadb",
+		Outputs: []kfconfig.ApplicationOutput{
+			{Name: "clusterIP", APIVersion: "v1", Kind: "Service", ObjectName: "mariadb", Namespace: "db", FieldPath: ".spec.clusterIP"},
+		},
+	}
+	dashboard := kfconfig.Application{
+		Name: "odh-dashboard",
+		Outputs: []kfconfig.ApplicationOutput{
+			{Name: "host", APIVersion: "route.openshift.io/v1", Kind: "Route", ObjectName: "odh-dashboard", FieldPath: "{.spec.host}"},
+		},
+	}
+	kfDef := &kfconfig.KfConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "odh", Namespace: "opendatahub"},
+		Spec:       kfconfig.KfConfigSpec{Applications: []kfconfig.Application{notebooks, mariadb, dashboard}},
+	}
+	kustomize := &kustomize{kfDef: kfDef}
+
+	resolver := newParamResolver(kfDef)
+	_, err := resolver.expand("${output:notebook-controller.host}")
+	if !isOutputNotAvailableError(err) {
+		t.Errorf("Expected the output to be unavailable before it's read; got %v", err)
+	}
+	if wrapped := (&kfapisv3.KfError{Message: err.Error(), Err: err}); !isOutputNotAvailableError(wrapped) {
+		t.Errorf("Expected the output to be unavailable through a KfError; got %v", wrapped)
+	}
+	for _, app := range []kfconfig.Application{notebooks, mariadb} {
+		if changed, err := kustomize.readOutputs(app); err != nil || !changed {
+			t.Fatalf("Failed to read the outputs of %v: %v, changed %v", app.Name, err, changed)
+		}
+	}
+	if _, err := kustomize.readOutputs(dashboard); err == nil || !strings.Contains(err.Error(), "couldn't read output host of application odh-dashboard") {
+		t.Errorf("Expected an error reading the output of a missing route; got %v", err)
+	}
+
+	expected := []kfconfig.ApplicationOutputs{
+		{Name: "notebook-controller", Values: []kfconfig.NameValue{{Name: "host", Value: "notebooks.apps.example.com"}}},
+		{Name: "mariadb", Values: []kfconfig.NameValue{{Name: "clusterIP", Value: "10.0.0.12"}}},
+	}
+	if !cmp.Equal(kfDef.Status.Outputs, expected) {
+		t.Errorf("Unexpected outputs in the status: %v", cmp.Diff(expected, kfDef.Status.Outputs))
+	}
+
+	type testCase struct {
+		Value    string
+		Expected string
+		Error    string
+	}
+	testCases := []testCase{
+		{Value: "https://${output:notebook-controller.host}/", Expected: "https://notebooks.apps.example.com/"},
+		{Value: "${output:mariadb.clusterIP}:3306", Expected: "10.0.0.12:3306"},
+		{Value: "${output:mariadb.host}", Error: "application mariadb has no output host"},
+		{Value: "${output:kserve.url}", Error: "the KfDef has no application kserve"},
+	}
+	for _, c := range testCases {
+		value, err := resolver.expand(c.Value)
+		if c.Error != "" {
+			if err == nil || !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("Case %v: expected an error containing %q; got %v", c.Value, c.Error, err)
+			}
+		} else if err != nil || value != c.Expected {
+			t.Errorf("Case %v: expected %v; got %v, %v", c.Value, c.Expected, value, err)
+		}
+	}
+}
+
+func TestOutputChangeRegeneratesDependents(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+	repoDir := path.Join(testDir, "manifests")
+	files := map[string]string{
+		"notebook-controller/base/kustomization.yaml": "resources: []\n",
+		"odh-dashboard/base/kustomization.yaml":       "configMapGenerator:\n- name: odh-dashboard-config\n  env: params.env\n",
+		"odh-dashboard/base/params.env":               "notebooksUrl=https://${output:notebook-controller.host}\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(path.Dir(path.Join(repoDir, name)), 0755); err != nil {
+			t.Fatalf("Failed to create the dir of %v: %v", name, err)
+		}
+		if err := ioutil.WriteFile(path.Join(repoDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %v: %v", name, err)
+		}
+	}
+
+	routeGVK := schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"}
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(routeGVK, &unstructured.Unstructured{})
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(routeGVK)
+	route.SetName("notebook-controller")
+	route.SetNamespace("opendatahub")
+	_ = unstructured.SetNestedField(route.Object, "notebooks.apps.example.com", "spec", "host")
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(route).Build()
+	defer func(f func() (client.Client, error)) { newParamClient = f }(newParamClient)
+	newParamClient = func() (client.Client, error) {
+		return kubeClient, nil
+	}
+	defer func(d time.Duration) { outputReadTimeout = d }(outputReadTimeout)
+	outputReadTimeout = time.Second
+
+	app := func(name string) kfconfig.Application {
+		return kfconfig.Application{
+			Name: name,
+			KustomizeConfig: &kfconfig.KustomizeConfig{
+				RepoRef: &kfconfig.RepoRef{Name: "manifests", Path: name},
+			},
+		}
+	}
+	notebooks := app("notebook-controller")
+	notebooks.Outputs = []kfconfig.ApplicationOutput{
+		{Name: "host", APIVersion: "route.openshift.io/v1", Kind: "Route", ObjectName: "notebook-controller", FieldPath: "{.spec.host}"},
+	}
+	kfDef := &kfconfig.KfConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "odh", Namespace: "opendatahub"},
+		Spec: kfconfig.KfConfigSpec{
+			AppDir:       testDir,
+			Applications: []kfconfig.Application{notebooks, app("odh-dashboard")},
+		},
+		Status: kfconfig.Status{Caches: []kfconfig.Cache{{Name: "manifests", LocalPath: repoDir}}},
+	}
+	kustomize := &kustomize{kfDef: kfDef}
+	kustomizeDir := path.Join(testDir, outputDir)
+
+	// apply mimics Apply: the applications are generated, the outputs of notebook-controller read
+	// once it's applied, and the dashboard generated again if it was deferred or is stale.
+	apply := func() string {
+		if err := kustomize.Generate(kftypesv3.K8S); err != nil {
+			t.Fatalf("Failed to generate: %v", err)
+		}
+		changed, err := kustomize.readOutputs(notebooks)
+		if err != nil {
+			t.Fatalf("Failed to read the outputs: %v", err)
+		}
+		if changed {
+			if err := kustomize.removeStaleDependents(notebooks, kustomizeDir); err != nil {
+				t.Fatalf("Failed to remove the stale dependents: %v", err)
+			}
+		}
+		if err := kustomize.Generate(kftypesv3.K8S); err != nil {
+			t.Fatalf("Failed to generate: %v", err)
+		}
+		data, err := ioutil.ReadFile(path.Join(kustomizeDir, "odh-dashboard", "base", "params.env"))
+		if err != nil {
+			t.Fatalf("Failed to read the generated params: %v", err)
+		}
+		return string(data)
+	}
+
+	if params := apply(); !strings.Contains(params, "https://notebooks.apps.example.com") {
+		t.Errorf("Expected the dashboard to use the notebooks host; got %v", params)
+	}
+	_ = unstructured.SetNestedField(route.Object, "jupyter.apps.example.com", "spec", "host")
+	if err := kubeClient.Update(context.TODO(), route); err != nil {
+		t.Fatalf("Failed to update the route: %v", err)
+	}
+	if params := apply(); !strings.Contains(params, "https://jupyter.apps.example.com") {
+		t.Errorf("Expected the dashboard to use the new notebooks host; got %v", params)
+	}
+}
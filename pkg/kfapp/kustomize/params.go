@@ -0,0 +1,238 @@
+package kustomize
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	kftypesv3 "github.com/opendatahub-io/opendatahub-operator/apis/apps"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// paramExpression matches the expressions in param values, e.g. ${kfdef.namespace}, and the
+// escaped expressions $${...}, which expand to a literal ${...}. Only the expressions with one of
+// paramExpressionPrefixes are evaluated.
+var paramExpression = regexp.MustCompile(`\$(\$?)\{([^}]*)\}`)
+
+// ingressConfig is the cluster wide ingress configuration of OpenShift, holding the domain of routes.
+var ingressConfig = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "Ingress"}
+
+// newParamClient returns the client used to read the cluster objects referenced by param expressions.
+// It is a variable so that tests can substitute a fake client.
+var newParamClient = func() (client.Client, error) {
+	config := kftypesv3.GetConfig()
+	if config == nil {
+		return nil, fmt.Errorf("could not load the kubernetes client config")
+	}
+	return client.New(config, client.Options{})
+}
+
+// paramResolver evaluates the expressions in the param values of the applications of a KfDef:
+//
+//	${kfdef.name}, ${kfdef.namespace}, ${kfdef.project}  fields of the KfDef
+//	${cluster.ingressDomain}, ${cluster.version}, ...   facts about the cluster, see ClusterFacts.Param
+//	${app:application.param}                            a param of another application
+//	${output:application.output}                        an output of another application, once applied
+//
+// $${...} is kept as a literal ${...}. Other ${...}, e.g. ${HOME}, are left as they are.
+type paramResolver struct {
+	kfDef  *kfconfig.KfConfig
+	client client.Client
+	// resolving holds the application params being resolved, to detect cycles.
+	resolving map[string]bool
+}
+
+func newParamResolver(kfDef *kfconfig.KfConfig) *paramResolver {
+	return &paramResolver{kfDef: kfDef, resolving: map[string]bool{}}
+}
+
+// paramExpressionPrefixes are the prefixes of the expressions evaluated in param values.
+var paramExpressionPrefixes = []string{"kfdef.", "cluster.", "secret:", "app:", "output:"}
+
+// isParamExpression returns true if expr, without its ${}, is evaluated. Anything else, e.g. the
+// ${VAR} of a shell snippet in a params.env, is literal text.
+func isParamExpression(expr string) bool {
+	for _, prefix := range paramExpressionPrefixes {
+		if strings.HasPrefix(expr, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// expand returns value with its expressions replaced by their values.
+func (r *paramResolver) expand(value string) (string, error) {
+	var err error
+	expanded := paramExpression.ReplaceAllStringFunc(value, func(expr string) string {
+		m := paramExpression.FindStringSubmatch(expr)
+		if err != nil || !isParamExpression(strings.TrimSpace(m[2])) {
+			return expr
+		}
+		if m[1] != "" {
+			return expr[1:]
+		}
+		var v string
+		v, err = r.resolve(strings.TrimSpace(m[2]))
+		if err != nil {
+			err = fmt.Errorf("unresolved reference %v: %w", expr, err)
+		}
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
+
+// resolve returns the value of the expression expr, without its ${}.
+func (r *paramResolver) resolve(expr string) (string, error) {
+	switch {
+	case strings.HasPrefix(expr, "kfdef."):
+		switch strings.TrimPrefix(expr, "kfdef.") {
+		case "name":
+			return r.kfDef.Name, nil
+		case "namespace":
+			return r.kfDef.Namespace, nil
+		case "project":
+			return r.kfDef.Spec.Project, nil
+		}
+		return "", fmt.Errorf("the KfDef has no field %v", strings.TrimPrefix(expr, "kfdef."))
+	case strings.HasPrefix(expr, "cluster."):
+		return r.clusterFact(strings.TrimPrefix(expr, "cluster."))
+	case strings.HasPrefix(expr, "secret:"):
+		// Params are rendered into ConfigMaps and literal fields of the manifests, readable by anyone
+		// who can read those objects; the manifests must reference the Secret, e.g. with secretKeyRef.
+		return "", fmt.Errorf("secrets can't be used in params; reference the Secret from the manifests instead")
+	case strings.HasPrefix(expr, "app:"):
+		return r.appParam(strings.TrimPrefix(expr, "app:"))
+	case strings.HasPrefix(expr, "output:"):
+		return r.output(strings.TrimPrefix(expr, "output:"))
+	}
+	return "", fmt.Errorf("unknown expression; expected kfdef.<field>, cluster.<fact>, app:<application>.<param> or output:<application>.<output>")
+}
+
+func (r *paramResolver) getClient() (client.Client, error) {
+	if r.client == nil {
+		c, err := newParamClient()
+		if err != nil {
+			return nil, err
+		}
+		r.client = c
+	}
+	return r.client, nil
+}
+
+// clusterFact returns the value of the fact name about the cluster.
+func (r *paramResolver) clusterFact(name string) (string, error) {
+	if facts := r.kfDef.Status.ClusterFacts; facts != nil {
+		return facts.Param(name)
+	}
+	// The facts are collected by the operator; look the ingress domain up otherwise.
+	if name != "ingressDomain" {
+		return "", fmt.Errorf("the facts about the cluster weren't collected")
+	}
+	c, err := r.getClient()
+	if err != nil {
+		return "", err
+	}
+	ingress := &unstructured.Unstructured{}
+	ingress.SetGroupVersionKind(ingressConfig)
+	if err := c.Get(context.TODO(), k8stypes.NamespacedName{Name: "cluster"}, ingress); err != nil {
+		return "", fmt.Errorf("couldn't get the ingress configuration of the cluster: %v", err)
+	}
+	domain, _, _ := unstructured.NestedString(ingress.Object, "spec", "domain")
+	if domain == "" {
+		return "", fmt.Errorf("the ingress configuration of the cluster has no domain")
+	}
+	return domain, nil
+}
+
+// appParam returns the value of a param of another application referenced as application.param:
+// the value set in the KfDef, else the value in the params.env of the application.
+func (r *paramResolver) appParam(ref string) (string, error) {
+	i := strings.LastIndex(ref, ".")
+	if i <= 0 || i == len(ref)-1 {
+		return "", fmt.Errorf("expected an application param reference <application>.<param>")
+	}
+	appName, param := ref[:i], ref[i+1:]
+	if r.resolving[ref] {
+		return "", fmt.Errorf("param %v of application %v refers to itself", param, appName)
+	}
+	r.resolving[ref] = true
+	defer delete(r.resolving, ref)
+
+	var app *kfconfig.Application
+	for i := range r.kfDef.Spec.Applications {
+		if r.kfDef.Spec.Applications[i].Name == appName {
+			app = &r.kfDef.Spec.Applications[i]
+			break
+		}
+	}
+	if app == nil {
+		return "", fmt.Errorf("the KfDef has no application %v", appName)
+	}
+	if app.KustomizeConfig == nil {
+		return "", fmt.Errorf("application %v has no params", appName)
+	}
+	for _, nv := range app.KustomizeConfig.Parameters {
+		if nv.Name == param {
+			return r.expand(nv.Value)
+		}
+	}
+	if app.KustomizeConfig.RepoRef != nil {
+		if repoCache, ok := r.kfDef.GetRepoCache(app.KustomizeConfig.RepoRef.Name); ok {
+			paramFile := filepath.Join(repoCache.LocalPath, app.KustomizeConfig.RepoRef.Path, kftypesv3.KustomizationParamFile)
+			// A missing params.env just has no params.
+			lines, _ := readLines(paramFile)
+			for _, line := range lines {
+				if arr := strings.SplitN(line, "=", 2); len(arr) == 2 && arr[0] == param {
+					return r.expand(arr[1])
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("application %v has no param %v", appName, param)
+}
+
+// builtinParams are the params the operator handles itself rather than through params.env.
+var builtinParams = map[string]bool{"namespace": true, OverlayParamName: true}
+
+// validateParams checks the params of app against the param schemas of its base and selected
+// overlays in appDir. Applications without a schema aren't checked.
+func validateParams(appDir string, app kfconfig.Application) error {
+	dirs := []string{appDir, path.Join(appDir, "base")}
+	for _, overlay := range app.KustomizeConfig.Overlays {
+		dirs = append(dirs, path.Join(appDir, "overlays", overlay))
+	}
+	var schema *kfconfig.ParamSchema
+	for _, dir := range dirs {
+		s, err := kfconfig.LoadParamSchema(dir)
+		if err != nil {
+			return err
+		}
+		if s == nil {
+			continue
+		}
+		if schema == nil {
+			schema = &kfconfig.ParamSchema{}
+		}
+		schema.Merge(s)
+	}
+	if schema == nil {
+		return nil
+	}
+	var params []kfconfig.NameValue
+	for _, nv := range app.KustomizeConfig.Parameters {
+		if !builtinParams[nv.Name] {
+			params = append(params, nv)
+		}
+	}
+	return schema.Validate(app.Name, params)
+}
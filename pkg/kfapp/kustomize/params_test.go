@@ -0,0 +1,226 @@
+package kustomize
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/kustomize/v3/pkg/types"
+)
+
+func TestParamResolver(t *testing.T) {
+	repoDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(repoDir)
+	if err := os.MkdirAll(path.Join(repoDir, "odh-dashboard"), 0755); err != nil {
+		t.Fatalf("Failed to create the dashboard dir: %v", err)
+	}
+	params := "# the route of the dashboard\nhost=dashboard.${cluster.ingressDomain}\nport=8080\n"
+	if err := ioutil.WriteFile(path.Join(repoDir, "odh-dashboard", "params.env"), []byte(params), 0644); err != nil {
+		t.Fatalf("Failed to write params.env: %v", err)
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	scheme.AddKnownTypeWithName(ingressConfig, &unstructured.Unstructured{})
+	ingress := &unstructured.Unstructured{}
+	ingress.SetGroupVersionKind(ingressConfig)
+	ingress.SetName("cluster")
+	_ = unstructured.SetNestedField(ingress.Object, "apps.example.com", "spec", "domain")
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		ingress,
+	).Build()
+	defer func(f func() (client.Client, error)) { newParamClient = f }(newParamClient)
+	newParamClient = func() (client.Client, error) {
+		return kubeClient, nil
+	}
+
+	kfDef := &kfconfig.KfConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "odh", Namespace: "opendatahub"},
+		Spec: kfconfig.KfConfigSpec{
+			Project: "odh-project",
+			Applications: []kfconfig.Application{
+				{
+					Name: "odh-dashboard",
+					KustomizeConfig: &kfconfig.KustomizeConfig{
+						RepoRef: &kfconfig.RepoRef{Name: "manifests", Path: "odh-dashboard"},
+						Parameters: []kfconfig.NameValue{
+							{Name: "url", Value: "https://${app:odh-dashboard.host}:${app:odh-dashboard.port}"},
+							{Name: "loop", Value: "${app:odh-dashboard.loop}"},
+						},
+					},
+				},
+			},
+		},
+		Status: kfconfig.Status{
+			Caches: []kfconfig.Cache{{Name: "manifests", LocalPath: repoDir}},
+		},
+	}
+
+	type testCase struct {
+		Name     string
+		Value    string
+		Expected string
+		Error    string
+	}
+	testCases := []testCase{
+		{Name: "constant", Value: "odh", Expected: "odh"},
+		{Name: "kfdef", Value: "${kfdef.name}.${kfdef.namespace}.${ kfdef.project }", Expected: "odh.opendatahub.odh-project"},
+		{Name: "ingress-domain", Value: "https://${cluster.ingressDomain}", Expected: "https://apps.example.com"},
+		{Name: "secret", Value: "${secret:db/password}", Error: "secrets can't be used in params"},
+		{Name: "app-param", Value: "${app:odh-dashboard.url}", Expected: "https://dashboard.apps.example.com:8080"},
+		{Name: "kfdef-unknown-field", Value: "${kfdef.uid}", Error: "unresolved reference ${kfdef.uid}: the KfDef has no field uid"},
+		{Name: "uncollected-fact", Value: "${cluster.version}", Error: "the facts about the cluster weren't collected"},
+		{Name: "missing-app", Value: "${app:notebooks.image}", Error: "the KfDef has no application notebooks"},
+		{Name: "missing-app-param", Value: "${app:odh-dashboard.image}", Error: "application odh-dashboard has no param image"},
+		{Name: "cyclic-app-param", Value: "${app:odh-dashboard.loop}", Error: "refers to itself"},
+		{Name: "unrelated-expression", Value: "${FOO}", Expected: "${FOO}"},
+		{Name: "shell-snippet", Value: "echo ${HOME} $${PATH} ${kfdef.name}", Expected: "echo ${HOME} $${PATH} odh"},
+		{Name: "escaped", Value: "$${kfdef.name}/${kfdef.name}", Expected: "${kfdef.name}/odh"},
+		{Name: "escaped-only", Value: "echo $${app:x.y} $$${cluster.version}", Expected: "echo ${app:x.y} $${cluster.version}"},
+	}
+	withFacts := kfDef.DeepCopy()
+	withFacts.Status.ClusterFacts = &kfconfig.ClusterFacts{
+		Platform:          kfconfig.PlatformKubernetes,
+		Version:           "v1.21.0",
+		KubernetesVersion: "v1.21.0",
+		Proxy:             &kfconfig.ClusterProxy{NoProxy: ".cluster.local"},
+	}
+	factCases := []testCase{
+		{Name: "fact", Value: "${cluster.platform}-${cluster.version}", Expected: "Kubernetes-v1.21.0"},
+		{Name: "proxy", Value: "${cluster.httpProxy}|${cluster.noProxy}", Expected: "|.cluster.local"},
+		{Name: "missing-fact", Value: "${cluster.ingressDomain}", Error: "the cluster has no ingressDomain"},
+		{Name: "unknown-fact", Value: "${cluster.region}", Error: "unknown cluster fact region"},
+	}
+	for _, c := range factCases {
+		value, err := newParamResolver(withFacts).expand(c.Value)
+		if c.Error != "" {
+			if err == nil || !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("Case %v: expected an error containing %q; got %v", c.Name, c.Error, err)
+			}
+		} else if err != nil || value != c.Expected {
+			t.Errorf("Case %v: expected %v; got %v, %v", c.Name, c.Expected, value, err)
+		}
+	}
+
+	for _, c := range testCases {
+		value, err := newParamResolver(kfDef).expand(c.Value)
+		if c.Error != "" {
+			if err == nil || !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("Case %v: expected an error containing %q; got %v", c.Name, c.Error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case %v: failed to expand %v: %v", c.Name, c.Value, err)
+		} else if value != c.Expected {
+			t.Errorf("Case %v: expected %v; got %v", c.Name, c.Expected, value)
+		}
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	appDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(appDir)
+	files := map[string]string{
+		"base/kustomization.yaml":            "resources: []\n",
+		"base/params.env":                    "replicas=\nimage=\nnamespace=\n",
+		"base/params.schema.yaml":            "params:\n- name: replicas\n  type: integer\n  default: \"2\"\n- name: image\n",
+		"overlays/gpu/params.schema.yaml":    "params:\n- name: gpus\n  type: integer\n",
+		"overlays/gpu/kustomization.yaml":    "resources: []\n",
+		"overlays/broken/params.schema.yaml": "params: {}\n",
+	}
+	for name, contents := range files {
+		if err := os.MkdirAll(path.Join(appDir, path.Dir(name)), 0755); err != nil {
+			t.Fatalf("Failed to create %v: %v", path.Dir(name), err)
+		}
+		if err := ioutil.WriteFile(path.Join(appDir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write %v: %v", name, err)
+		}
+	}
+
+	type testCase struct {
+		Name     string
+		Overlays []string
+		Params   []kfconfig.NameValue
+		Error    string
+	}
+	testCases := []testCase{
+		{
+			Name:   "base",
+			Params: []kfconfig.NameValue{{Name: "replicas", Value: "3"}, {Name: "namespace", Value: "odh"}},
+		},
+		{
+			Name:     "overlay-param",
+			Overlays: []string{"gpu"},
+			Params:   []kfconfig.NameValue{{Name: "gpus", Value: "1"}},
+		},
+		{
+			Name:   "param-of-unselected-overlay",
+			Params: []kfconfig.NameValue{{Name: "gpus", Value: "1"}},
+			Error:  "unknown param gpus",
+		},
+		{
+			Name:   "invalid-value",
+			Params: []kfconfig.NameValue{{Name: "replicas", Value: "many"}},
+			Error:  `param replicas: "many" is not a valid integer`,
+		},
+		{
+			Name:     "invalid-schema",
+			Overlays: []string{"broken"},
+			Error:    "invalid param schema",
+		},
+	}
+	for _, c := range testCases {
+		app := kfconfig.Application{
+			Name:            "dashboard",
+			KustomizeConfig: &kfconfig.KustomizeConfig{Overlays: c.Overlays, Parameters: c.Params},
+		}
+		err := validateParams(appDir, app)
+		if c.Error == "" {
+			if err != nil {
+				t.Errorf("Case %v: expected the params to be valid; got %v", c.Name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.Error) {
+			t.Errorf("Case %v: expected an error containing %q; got %v", c.Name, c.Error, err)
+		}
+	}
+
+	// Applications without a schema aren't checked.
+	noSchema := kfconfig.Application{
+		Name:            "notebooks",
+		KustomizeConfig: &kfconfig.KustomizeConfig{Parameters: []kfconfig.NameValue{{Name: "anything", Value: "x"}}},
+	}
+	if err := validateParams(path.Join(appDir, "overlays", "gpu", "missing"), noSchema); err != nil {
+		t.Errorf("Expected an application without a schema to be valid; got %v", err)
+	}
+
+	// The defaults of the schema fill the params left empty.
+	kfDef := &kfconfig.KfConfig{ObjectMeta: metav1.ObjectMeta{Name: "odh", Namespace: "opendatahub"}}
+	baseDir := path.Join(appDir, "base")
+	if err := MergeKustomization(appDir, baseDir, kfDef, []kfconfig.NameValue{{Name: "image", Value: "dashboard:v2"}},
+		&types.Kustomization{}, GetKustomization(baseDir), CreateKustomizationMaps()); err != nil {
+		t.Fatalf("Failed to merge the base: %v", err)
+	}
+	params, err := ioutil.ReadFile(path.Join(baseDir, "params.env"))
+	if err != nil {
+		t.Fatalf("Failed to read params.env: %v", err)
+	}
+	if expected := "replicas=2\nimage=dashboard:v2\nnamespace=opendatahub\n"; string(params) != expected {
+		t.Errorf("Expected params.env %q; got %q", expected, string(params))
+	}
+}
@@ -0,0 +1,144 @@
+package kustomize
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+)
+
+// podTemplateKinds are the workload kinds whose pod template lives under spec.template.
+var podTemplateKinds = map[string]bool{
+	"Deployment":       true,
+	"StatefulSet":      true,
+	"DaemonSet":        true,
+	"DeploymentConfig": true,
+	"Job":              true,
+}
+
+// PlacementTransformer injects nodeSelector, tolerations, affinity and priorityClassName
+// into the pod template of every workload in the resmap.
+type PlacementTransformer struct {
+	Placement *kfconfig.Placement
+}
+
+func (p *PlacementTransformer) Transform(m resmap.ResMap) error {
+	if p.Placement == nil {
+		return nil
+	}
+	for _, r := range m.Resources() {
+		if !podTemplateKinds[r.GetKind()] {
+			continue
+		}
+		obj := r.Map()
+		podSpec, ok := getPodSpec(obj)
+		if !ok {
+			log.Warnf("Skipping the placement of %v %v: it has no spec.template.spec", r.GetKind(), r.GetName())
+			continue
+		}
+		if err := applyPlacement(podSpec, p.Placement); err != nil {
+			return fmt.Errorf("could not set placement on %v %v: %v", r.GetKind(), r.GetName(), err)
+		}
+		r.SetMap(obj)
+	}
+	return nil
+}
+
+// getPodSpec returns the pod spec of the workload obj, or false if obj has no spec.template.spec.
+// Missing fields aren't created, so a workload without a pod template is left as it is.
+// obj must be the result of r.Map(); the caller is responsible for writing it back with SetMap.
+func getPodSpec(obj map[string]interface{}) (map[string]interface{}, bool) {
+	m := obj
+	for _, field := range []string{"spec", "template", "spec"} {
+		next, ok := m[field].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = next
+	}
+	return m, true
+}
+
+func applyPlacement(podSpec map[string]interface{}, p *kfconfig.Placement) error {
+	if len(p.NodeSelector) > 0 {
+		nodeSelector, ok := podSpec["nodeSelector"].(map[string]interface{})
+		if !ok {
+			nodeSelector = map[string]interface{}{}
+		}
+		for k, v := range p.NodeSelector {
+			nodeSelector[k] = v
+		}
+		podSpec["nodeSelector"] = nodeSelector
+	}
+	if len(p.Tolerations) > 0 {
+		tolerations, _ := podSpec["tolerations"].([]interface{})
+		for i := range p.Tolerations {
+			t, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&p.Tolerations[i])
+			if err != nil {
+				return err
+			}
+			if !containsValue(tolerations, t) {
+				tolerations = append(tolerations, t)
+			}
+		}
+		podSpec["tolerations"] = tolerations
+	}
+	if p.Affinity != nil {
+		affinity, err := runtime.DefaultUnstructuredConverter.ToUnstructured(p.Affinity)
+		if err != nil {
+			return err
+		}
+		podSpec["affinity"] = affinity
+	}
+	if p.PriorityClassName != "" {
+		podSpec["priorityClassName"] = p.PriorityClassName
+	}
+	return nil
+}
+
+func containsValue(values []interface{}, v interface{}) bool {
+	for _, existing := range values {
+		if reflect.DeepEqual(existing, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergePlacement combines the KfDef level placement with the application level one.
+// The nodeSelector and tolerations of both are combined; the application wins for
+// affinity, priorityClassName and conflicting nodeSelector keys.
+func mergePlacement(kfDefPlacement *kfconfig.Placement, appPlacement *kfconfig.Placement) *kfconfig.Placement {
+	if kfDefPlacement == nil {
+		return appPlacement
+	}
+	if appPlacement == nil {
+		return kfDefPlacement
+	}
+	merged := &kfconfig.Placement{
+		Affinity:          kfDefPlacement.Affinity,
+		PriorityClassName: kfDefPlacement.PriorityClassName,
+	}
+	if len(kfDefPlacement.NodeSelector)+len(appPlacement.NodeSelector) > 0 {
+		merged.NodeSelector = map[string]string{}
+		for k, v := range kfDefPlacement.NodeSelector {
+			merged.NodeSelector[k] = v
+		}
+		for k, v := range appPlacement.NodeSelector {
+			merged.NodeSelector[k] = v
+		}
+	}
+	merged.Tolerations = append([]v1.Toleration{}, kfDefPlacement.Tolerations...)
+	merged.Tolerations = append(merged.Tolerations, appPlacement.Tolerations...)
+	if appPlacement.Affinity != nil {
+		merged.Affinity = appPlacement.Affinity
+	}
+	if appPlacement.PriorityClassName != "" {
+		merged.PriorityClassName = appPlacement.PriorityClassName
+	}
+	return merged
+}
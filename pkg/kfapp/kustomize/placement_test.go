@@ -0,0 +1,205 @@
+package kustomize
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendatahub-io/opendatahub-operator/pkg/kfconfig"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/kunstruct"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/transformer"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/kustomize/v3/pkg/resource"
+)
+
+func newResMapFromYaml(t *testing.T, data string) resmap.ResMap {
+	rf := resmap.NewFactory(resource.NewFactory(kunstruct.NewKunstructuredFactoryImpl()), transformer.NewFactoryImpl())
+	m, err := rf.NewResMapFromBytes([]byte(data))
+	if err != nil {
+		t.Fatalf("Failed to create resmap: %v", err)
+	}
+	return m
+}
+
+func assertResMapYaml(t *testing.T, name string, m resmap.ResMap, expected string) {
+	actual, err := m.AsYaml()
+	if err != nil {
+		t.Fatalf("Case %v: failed to encode resmap: %v", name, err)
+	}
+	// Normalize the expected document through the same encoder.
+	want, err := newResMapFromYaml(t, expected).AsYaml()
+	if err != nil {
+		t.Fatalf("Case %v: failed to encode expected resmap: %v", name, err)
+	}
+	if diff := cmp.Diff(string(want), string(actual)); diff != "" {
+		t.Errorf("Case %v: unexpected resources (-want, +got):\n%s", name, diff)
+	}
+}
+
+func TestPlacementTransformer(t *testing.T) {
+	type testCase struct {
+		Name      string
+		Placement *kfconfig.Placement
+		Input     string
+		Expected  string
+	}
+
+	testCases := []testCase{
+		{
+			Name: "deployment-and-service",
+			Placement: &kfconfig.Placement{
+				NodeSelector: map[string]string{"node-role.kubernetes.io/infra": ""},
+				Tolerations: []v1.Toleration{
+					{
+						Key:      "node-role.kubernetes.io/infra",
+						Operator: v1.TolerationOpExists,
+						Effect:   v1.TaintEffectNoSchedule,
+					},
+				},
+				PriorityClassName: "system-cluster-critical",
+			},
+			Input: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dashboard
+spec:
+  template:
+    spec:
+      nodeSelector:
+        kubernetes.io/os: linux
+      containers:
+      - name: dashboard
+        image: dashboard
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: dashboard
+spec:
+  ports:
+  - port: 80
+`,
+			Expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dashboard
+spec:
+  template:
+    spec:
+      containers:
+      - name: dashboard
+        image: dashboard
+      nodeSelector:
+        kubernetes.io/os: linux
+        node-role.kubernetes.io/infra: ""
+      priorityClassName: system-cluster-critical
+      tolerations:
+      - key: node-role.kubernetes.io/infra
+        operator: Exists
+        effect: NoSchedule
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: dashboard
+spec:
+  ports:
+  - port: 80
+`,
+		},
+		{
+			Name: "workloads-without-pod-spec",
+			Placement: &kfconfig.Placement{
+				Affinity: &v1.Affinity{
+					NodeAffinity: &v1.NodeAffinity{
+						RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+							NodeSelectorTerms: []v1.NodeSelectorTerm{
+								{
+									MatchExpressions: []v1.NodeSelectorRequirement{
+										{
+											Key:      "zone",
+											Operator: v1.NodeSelectorOpIn,
+											Values:   []string{"a"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			Input: `
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dashboard
+spec:
+  template:
+    metadata:
+      labels:
+        app: dashboard
+`,
+			// Workloads without a pod spec are left as they are.
+			Expected: `
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dashboard
+spec:
+  template:
+    metadata:
+      labels:
+        app: dashboard
+`,
+		},
+	}
+
+	for _, c := range testCases {
+		m := newResMapFromYaml(t, c.Input)
+		p := &PlacementTransformer{Placement: c.Placement}
+		if err := p.Transform(m); err != nil {
+			t.Fatalf("Case %v: failed to transform: %v", c.Name, err)
+		}
+		assertResMapYaml(t, c.Name, m, c.Expected)
+	}
+}
+
+func TestMergePlacement(t *testing.T) {
+	kfDefPlacement := &kfconfig.Placement{
+		NodeSelector:      map[string]string{"a": "1", "b": "1"},
+		Tolerations:       []v1.Toleration{{Key: "infra", Operator: v1.TolerationOpExists}},
+		PriorityClassName: "low",
+	}
+	appPlacement := &kfconfig.Placement{
+		NodeSelector: map[string]string{"b": "2"},
+		Tolerations:  []v1.Toleration{{Key: "gpu", Operator: v1.TolerationOpExists}},
+	}
+	expected := &kfconfig.Placement{
+		NodeSelector: map[string]string{"a": "1", "b": "2"},
+		Tolerations: []v1.Toleration{
+			{Key: "infra", Operator: v1.TolerationOpExists},
+			{Key: "gpu", Operator: v1.TolerationOpExists},
+		},
+		PriorityClassName: "low",
+	}
+
+	actual := mergePlacement(kfDefPlacement, appPlacement)
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("Unexpected placement (-want, +got):\n%s", diff)
+	}
+	if mergePlacement(nil, appPlacement) != appPlacement {
+		t.Errorf("Expected application placement when KfDef placement is unset")
+	}
+}
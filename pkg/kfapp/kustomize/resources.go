@@ -0,0 +1,160 @@
+package kustomize
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+)
+
+// ResourcesTransformer overrides the requests and limits of the containers of every workload
+// in the resmap. Resources is keyed by container name or by workload name; when both match a
+// container the container name override is applied last.
+type ResourcesTransformer struct {
+	Resources map[string]v1.ResourceRequirements
+}
+
+func (p *ResourcesTransformer) Transform(m resmap.ResMap) error {
+	if len(p.Resources) == 0 {
+		return nil
+	}
+	matched := map[string]bool{}
+	for _, r := range m.Resources() {
+		if !podTemplateKinds[r.GetKind()] {
+			continue
+		}
+		obj := r.Map()
+		for _, field := range []string{"initContainers", "containers"} {
+			containers, found, err := unstructured.NestedSlice(obj, "spec", "template", "spec", field)
+			if err != nil || !found {
+				continue
+			}
+			for i, c := range containers {
+				container, ok := c.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				containerName, _ := container["name"].(string)
+				for _, key := range []string{r.GetName(), containerName} {
+					override, ok := p.Resources[key]
+					if !ok {
+						continue
+					}
+					matched[key] = true
+					if err := applyResources(container, override); err != nil {
+						return fmt.Errorf("could not set resources on container %v of %v %v: %v",
+							containerName, r.GetKind(), r.GetName(), err)
+					}
+				}
+				if err := validateResources(container); err != nil {
+					return fmt.Errorf("invalid resources for container %v of %v %v: %v",
+						containerName, r.GetKind(), r.GetName(), err)
+				}
+				containers[i] = container
+			}
+			if err := unstructured.SetNestedSlice(obj, containers, "spec", "template", "spec", field); err != nil {
+				return err
+			}
+		}
+		r.SetMap(obj)
+	}
+
+	var unmatched []string
+	for key := range p.Resources {
+		if !matched[key] {
+			unmatched = append(unmatched, key)
+		}
+	}
+	sort.Strings(unmatched)
+	for _, key := range unmatched {
+		log.Warnf("Resources override %v does not match any rendered workload or container", key)
+	}
+	return nil
+}
+
+// applyResources merges the requests and limits of override into the resources of container.
+func applyResources(container map[string]interface{}, override v1.ResourceRequirements) error {
+	o, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&override)
+	if err != nil {
+		return err
+	}
+	resources, ok := container["resources"].(map[string]interface{})
+	if !ok {
+		resources = map[string]interface{}{}
+	}
+	for _, field := range []string{"requests", "limits"} {
+		values, ok := o[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		existing, ok := resources[field].(map[string]interface{})
+		if !ok {
+			existing = map[string]interface{}{}
+		}
+		for k, v := range values {
+			existing[k] = v
+		}
+		resources[field] = existing
+	}
+	container["resources"] = resources
+	return nil
+}
+
+// validateResources checks that the requests and limits of container are valid quantities and
+// that no request exceeds the corresponding limit.
+func validateResources(container map[string]interface{}) error {
+	requests, err := quantities(container, "requests")
+	if err != nil {
+		return err
+	}
+	limits, err := quantities(container, "limits")
+	if err != nil {
+		return err
+	}
+	for name, limit := range limits {
+		request, ok := requests[name]
+		if !ok {
+			continue
+		}
+		if request.Cmp(limit) > 0 {
+			return fmt.Errorf("%v request %v is greater than limit %v", name, request.String(), limit.String())
+		}
+	}
+	return nil
+}
+
+// quantities parses the requests or limits of container. Manifests may set them as numbers,
+// e.g. cpu: 1, as well as strings.
+func quantities(container map[string]interface{}, field string) (map[string]resource.Quantity, error) {
+	values, _, err := unstructured.NestedMap(container, "resources", field)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v: %v", field, err)
+	}
+	parsed := map[string]resource.Quantity{}
+	for name, v := range values {
+		var s string
+		switch value := v.(type) {
+		case string:
+			s = value
+		case int64:
+			s = strconv.FormatInt(value, 10)
+		case float64:
+			s = strconv.FormatFloat(value, 'f', -1, 64)
+		default:
+			return nil, fmt.Errorf("invalid %v %v %v: expected a quantity", name, strings.TrimSuffix(field, "s"), v)
+		}
+		q, err := resource.ParseQuantity(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v %v %v: %v", name, strings.TrimSuffix(field, "s"), s, err)
+		}
+		parsed[name] = q
+	}
+	return parsed, nil
+}
@@ -0,0 +1,279 @@
+package kustomize
+
+import (
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestResourcesTransformer(t *testing.T) {
+	type testCase struct {
+		Name      string
+		Resources map[string]v1.ResourceRequirements
+		Input     string
+		Expected  string
+		Warnings  []string
+		Error     string
+	}
+
+	input := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dashboard
+spec:
+  template:
+    spec:
+      containers:
+      - name: dashboard
+        image: dashboard
+        resources:
+          requests:
+            cpu: 100m
+          limits:
+            cpu: "1"
+      - name: oauth-proxy
+        image: oauth-proxy
+`
+
+	testCases := []testCase{
+		{
+			Name: "workload-and-container",
+			Resources: map[string]v1.ResourceRequirements{
+				"dashboard": {
+					Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("256Mi")},
+				},
+				"oauth-proxy": {
+					Limits: v1.ResourceList{v1.ResourceCPU: resource.MustParse("200m")},
+				},
+				"missing": {
+					Limits: v1.ResourceList{v1.ResourceCPU: resource.MustParse("200m")},
+				},
+			},
+			Input: input,
+			Expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dashboard
+spec:
+  template:
+    spec:
+      containers:
+      - name: dashboard
+        image: dashboard
+        resources:
+          requests:
+            cpu: 100m
+            memory: 256Mi
+          limits:
+            cpu: "1"
+      - name: oauth-proxy
+        image: oauth-proxy
+        resources:
+          requests:
+            memory: 256Mi
+          limits:
+            cpu: 200m
+`,
+			Warnings: []string{"Resources override missing does not match any rendered workload or container"},
+		},
+		{
+			Name: "request-above-limit",
+			Resources: map[string]v1.ResourceRequirements{
+				"dashboard": {
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")},
+				},
+			},
+			Input: input,
+			Error: "cpu request 2 is greater than limit 1",
+		},
+		{
+			Name: "numeric-quantities",
+			Resources: map[string]v1.ResourceRequirements{
+				"db": {
+					Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")},
+				},
+			},
+			Input: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  template:
+    spec:
+      containers:
+      - name: db
+        image: db
+        resources:
+          requests:
+            cpu: 0.5
+            memory: 536870912
+          limits:
+            cpu: 1
+`,
+			Expected: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  template:
+    spec:
+      containers:
+      - name: db
+        image: db
+        resources:
+          requests:
+            cpu: 0.5
+            memory: 536870912
+          limits:
+            cpu: 1
+            memory: 1Gi
+`,
+		},
+		{
+			Name: "numeric-request-above-limit",
+			Resources: map[string]v1.ResourceRequirements{
+				"db": {
+					Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("256Mi")},
+				},
+			},
+			Input: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  template:
+    spec:
+      containers:
+      - name: db
+        image: db
+        resources:
+          requests:
+            memory: 536870912
+`,
+			Error: "memory request 536870912 is greater than limit 256Mi",
+		},
+		{
+			Name: "invalid-quantity",
+			Resources: map[string]v1.ResourceRequirements{
+				"db": {},
+			},
+			Input: `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  template:
+    spec:
+      containers:
+      - name: db
+        image: db
+        resources:
+          limits:
+            cpu: one
+`,
+			Error: "invalid cpu limit one",
+		},
+		{
+			Name: "init-containers",
+			Resources: map[string]v1.ResourceRequirements{
+				"migrate": {
+					Limits: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")},
+				},
+			},
+			Input: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dashboard
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: dashboard
+      containers:
+      - name: dashboard
+        image: dashboard
+`,
+			Expected: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dashboard
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: dashboard
+        resources:
+          limits:
+            cpu: 500m
+      containers:
+      - name: dashboard
+        image: dashboard
+`,
+		},
+		{
+			Name: "init-container-request-above-limit",
+			Resources: map[string]v1.ResourceRequirements{
+				"migrate": {
+					Limits: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")},
+				},
+			},
+			Input: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dashboard
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: dashboard
+        resources:
+          requests:
+            cpu: 1
+`,
+			Error: "invalid resources for container migrate of Deployment dashboard: cpu request 1 is greater than limit 500m",
+		},
+	}
+
+	for _, c := range testCases {
+		hook := test.NewGlobal()
+		m := newResMapFromYaml(t, c.Input)
+		p := &ResourcesTransformer{Resources: c.Resources}
+		err := p.Transform(m)
+		if c.Error != "" {
+			if err == nil || !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("Case %v: expected error containing %v; got %v", c.Name, c.Error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Case %v: failed to transform: %v", c.Name, err)
+		}
+		assertResMapYaml(t, c.Name, m, c.Expected)
+
+		var warnings []string
+		for _, e := range hook.AllEntries() {
+			if e.Level == log.WarnLevel {
+				warnings = append(warnings, e.Message)
+			}
+		}
+		if strings.Join(warnings, "\n") != strings.Join(c.Warnings, "\n") {
+			t.Errorf("Case %v: expected warnings %v; got %v", c.Name, c.Warnings, warnings)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package kfconfig
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	kfapis "github.com/opendatahub-io/opendatahub-operator/apis"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+)
+
+// archiveMeta records the repo, the HTTP validators and the digest of the archive unpacked
+// in a cache dir.
+type archiveMeta struct {
+	Repo         Repo   `json:"repo"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	// Digest is the sha256 digest of the archive, e.g. sha256:<hex>.
+	Digest string `json:"digest,omitempty"`
+}
+
+// archiveMetaFile returns the file holding the archiveMeta of cacheDir, next to it so that
+// it isn't part of the cached content.
+func archiveMetaFile(cacheDir string) string {
+	return path.Join(path.Dir(cacheDir), "."+path.Base(cacheDir)+".json")
+}
+
+// revision returns the version of the archive recorded in Cache.Revision: its ETag, else its
+// Last-Modified date.
+func (m *archiveMeta) revision() string {
+	if m.ETag != "" {
+		return m.ETag
+	}
+	return m.LastModified
+}
+
+func readArchiveMeta(cacheDir string) *archiveMeta {
+	if _, err := os.Stat(cacheDir); err != nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(archiveMetaFile(cacheDir))
+	if err != nil {
+		return nil
+	}
+	meta := &archiveMeta{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		log.Warnf("Ignoring invalid archive metadata of %v: %v", cacheDir, err)
+		return nil
+	}
+	return meta
+}
+
+// bearerTokenKey is the key of an AuthSecret holding a bearer token.
+const bearerTokenKey = "token"
+
+// httpCredentials returns the Authorization header and the client certificate provided by
+// secret. Either may be empty but not both.
+func httpCredentials(secret *v1.Secret) (string, []tls.Certificate, error) {
+	var certificates []tls.Certificate
+	if _, ok := secret.Data[v1.TLSCertKey]; ok {
+		cert, err := tls.X509KeyPair(secret.Data[v1.TLSCertKey], secret.Data[v1.TLSPrivateKeyKey])
+		if err != nil {
+			return "", nil, fmt.Errorf("secret %v has an invalid client certificate: %v", secret.Name, err)
+		}
+		certificates = append(certificates, cert)
+	}
+
+	authorization := ""
+	username, hasUsername := secret.Data[v1.BasicAuthUsernameKey]
+	password, hasPassword := secret.Data[v1.BasicAuthPasswordKey]
+	if token, ok := secret.Data[bearerTokenKey]; ok {
+		authorization = "Bearer " + strings.TrimSpace(string(token))
+	} else if hasUsername || hasPassword {
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(string(username)+":"+string(password)))
+	} else if len(certificates) == 0 {
+		return "", nil, fmt.Errorf("secret %v has neither a %v, a %v and %v nor a %v and %v key", secret.Name,
+			bearerTokenKey, v1.BasicAuthUsernameKey, v1.BasicAuthPasswordKey, v1.TLSCertKey, v1.TLSPrivateKeyKey)
+	}
+	return authorization, certificates, nil
+}
+
+// authTransport sets the Authorization header of the requests to host.
+type authTransport struct {
+	host          string
+	authorization string
+	transport     http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host || (req.URL.Scheme != "http" && req.URL.Scheme != "https") {
+		return t.transport.RoundTrip(req)
+	}
+	// RoundTrippers must not modify the request.
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", t.authorization)
+	return t.transport.RoundTrip(req)
+}
+
+// newArchiveClient returns the client downloading the archive and the signature of r with the
+// credentials of its AuthSecret and trusting its CABundle. The credentials are only sent to
+// the host of r.URI, including when following redirects.
+func (c *KfConfig) newArchiveClient(r Repo) (*http.Client, error) {
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+	}
+	t.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	t.RegisterProtocol("", http.NewFileTransport(http.Dir("/")))
+	if r.AuthSecret == "" && r.CABundle == nil {
+		return &http.Client{Transport: t}, nil
+	}
+
+	t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if r.CABundle != nil {
+		bundle, err := c.getKey(*r.CABundle)
+		if err != nil {
+			return nil, &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("couldn't get the CA bundle of repo %v: %v", r.Name, err),
+			}
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			log.Warnf("Couldn't load the system certificates; only trusting the CA bundle of repo %v: %v", r.Name, err)
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("CA bundle %v of repo %v has no PEM encoded certificate", r.CABundle.Name, r.Name),
+			}
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+	if r.AuthSecret == "" {
+		return &http.Client{Transport: t}, nil
+	}
+
+	secret, err := c.getSecret(r.AuthSecret)
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't get auth secret %v of repo %v: %v", r.AuthSecret, r.Name, err),
+		}
+	}
+	authorization, certificates, err := httpCredentials(secret)
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: err.Error(),
+		}
+	}
+	t.TLSClientConfig.Certificates = certificates
+	if authorization == "" {
+		return &http.Client{Transport: t}, nil
+	}
+	u, err := url.Parse(r.URI)
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("invalid URI %v: %v", r.URI, err),
+		}
+	}
+	return &http.Client{Transport: &authTransport{host: u.Host, authorization: authorization, transport: t}}, nil
+}
+
+// fetchArchive streams the gzipped tarball r.URI into cacheDir. When cacheDir holds an archive
+// previously fetched for the same repo, the request is conditional on its ETag and
+// Last-Modified and an unchanged archive is not downloaded again. Archives with a sha256 or
+// signature are spooled to a temporary file and verified before they are unpacked.
+func (c *KfConfig) fetchArchive(r Repo, cacheDir string) error {
+	hclient, err := c.newArchiveClient(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("GET", r.URI, nil)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("invalid URI %v: %v", r.URI, err),
+		}
+	}
+	req.Header.Set("User-Agent", "kfctl")
+	if meta := readArchiveMeta(cacheDir); meta != nil && sourceKey(meta.Repo) == sourceKey(r) {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	resp, err := hclient.Do(req)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't download URI %v: %v", r.URI, err),
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		log.Infof("%v is not modified; keeping %v", r.URI, cacheDir)
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't download URI %v: %v", r.URI, resp.Status),
+		}
+	}
+
+	digest := sha256.New()
+	var archive io.Reader = io.TeeReader(resp.Body, digest)
+	if r.SHA256 != "" || r.Signature != nil {
+		f, err := ioutil.TempFile("", "repo-archive")
+		if err != nil {
+			return &kfapis.KfError{
+				Code:    int(kfapis.INTERNAL_ERROR),
+				Message: fmt.Sprintf("couldn't create a temporary file for %v: %v", r.URI, err),
+			}
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		if _, err := io.Copy(f, archive); err != nil {
+			return &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("couldn't download URI %v: %v", r.URI, err),
+			}
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := c.verifyArchive(r, f, hclient); err != nil {
+			return err
+		}
+		archive = f
+	}
+
+	metaFile := archiveMetaFile(cacheDir)
+	if err := os.Remove(metaFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := resetCacheDir(cacheDir); err != nil {
+		return err
+	}
+	if err := untar(archive, cacheDir); err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't unpack %v: %v", r.URI, err),
+		}
+	}
+	// The digest covers the whole archive, including any padding after the tarball.
+	if _, err := io.Copy(ioutil.Discard, archive); err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't download URI %v: %v", r.URI, err),
+		}
+	}
+
+	meta := &archiveMeta{
+		Repo:         r,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Digest:       "sha256:" + hex.EncodeToString(digest.Sum(nil)),
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(metaFile, data, 0644)
+}
@@ -0,0 +1,337 @@
+package kfconfig
+
+import (
+	"archive/tar"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSyncCacheArchive(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	archiveFor := func(name string, version string) []byte {
+		return newArchive(t, []archiveEntry{
+			{Name: name + "/", Type: tar.TypeDir},
+			{Name: name + "/version", Type: tar.TypeReg, Content: version},
+		})
+	}
+
+	var mu sync.Mutex
+	etags := map[string]string{"/manifests.tar.gz": `"v1"`, "/odh.tar.gz": `"v1"`}
+	downloads := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		etag, ok := etags[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads[r.URL.Path]++
+		w.Write(archiveFor(strings.TrimSuffix(path.Base(r.URL.Path), ".tar.gz"), etag))
+	}))
+	defer server.Close()
+
+	kfDef := &KfConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "opendatahub", Namespace: "opendatahub"},
+		Spec: KfConfigSpec{
+			AppDir: testDir,
+			Repos: []Repo{
+				{Name: "manifests", URI: server.URL + "/manifests.tar.gz"},
+				{Name: "odh", URI: server.URL + "/odh.tar.gz"},
+			},
+		},
+	}
+
+	type testCase struct {
+		Name      string
+		ETags     map[string]string
+		Downloads map[string]int
+		Versions  map[string]string
+	}
+	testCases := []testCase{
+		{
+			Name:      "initial",
+			Downloads: map[string]int{"/manifests.tar.gz": 1, "/odh.tar.gz": 1},
+			Versions:  map[string]string{"manifests": `"v1"`, "odh": `"v1"`},
+		},
+		{
+			Name:      "not-modified",
+			Downloads: map[string]int{"/manifests.tar.gz": 1, "/odh.tar.gz": 1},
+			Versions:  map[string]string{"manifests": `"v1"`, "odh": `"v1"`},
+		},
+		{
+			Name:      "modified",
+			ETags:     map[string]string{"/odh.tar.gz": `"v2"`},
+			Downloads: map[string]int{"/manifests.tar.gz": 1, "/odh.tar.gz": 2},
+			Versions:  map[string]string{"manifests": `"v1"`, "odh": `"v2"`},
+		},
+	}
+	for _, c := range testCases {
+		mu.Lock()
+		for p, etag := range c.ETags {
+			etags[p] = etag
+		}
+		mu.Unlock()
+
+		// Clearing the status makes SyncCache check every repo again.
+		kfDef.Status.Caches = nil
+		if err := kfDef.SyncCache(); err != nil {
+			t.Fatalf("Case %v: failed to sync cache: %v", c.Name, err)
+		}
+		for p, expected := range c.Downloads {
+			if downloads[p] != expected {
+				t.Errorf("Case %v: expected %v downloads of %v; got %v", c.Name, expected, p, downloads[p])
+			}
+		}
+		if len(kfDef.Status.Caches) != len(kfDef.Spec.Repos) {
+			t.Fatalf("Case %v: expected %v caches; got %v", c.Name, len(kfDef.Spec.Repos), kfDef.Status.Caches)
+		}
+		for i, r := range kfDef.Spec.Repos {
+			cache := kfDef.Status.Caches[i]
+			if cache.Name != r.Name {
+				t.Errorf("Case %v: expected cache %v to be %v; got %v", c.Name, i, r.Name, cache.Name)
+			}
+			expectedPath := path.Join(testDir, DefaultCacheDir, r.Name, r.Name)
+			if cache.LocalPath != expectedPath {
+				t.Errorf("Case %v: expected LocalPath %v; got %v", c.Name, expectedPath, cache.LocalPath)
+			}
+			data, err := ioutil.ReadFile(path.Join(cache.LocalPath, "version"))
+			if err != nil || string(data) != c.Versions[r.Name] {
+				t.Errorf("Case %v: expected %v version %v; got %v %v", c.Name, r.Name, c.Versions[r.Name], string(data), err)
+			}
+		}
+	}
+
+	kfDef.Spec.Repos = append(kfDef.Spec.Repos, Repo{Name: "missing", URI: server.URL + "/missing.tar.gz"})
+	kfDef.Status.Caches = nil
+	if err := kfDef.SyncCache(); err == nil || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Errorf("Expected an error downloading a missing archive; got %v", err)
+	}
+	if len(kfDef.Status.Caches) != 2 {
+		t.Errorf("Expected the caches of the other repos to be recorded; got %v", kfDef.Status.Caches)
+	}
+}
+
+// newClientCertificate returns a self signed PEM encoded client certificate and its key.
+func newClientCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestSyncCacheArchiveAuth(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	clientCert, clientKey := newClientCertificate(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(clientCert)
+	archive := newArchive(t, []archiveEntry{
+		{Name: "manifests/", Type: tar.TypeDir},
+		{Name: "manifests/version", Type: tar.TypeReg, Content: "v1"},
+	})
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorized := false
+		switch r.URL.Path {
+		case "/basic.tar.gz":
+			username, password, ok := r.BasicAuth()
+			authorized = ok && username == "odh" && password == "secret"
+		case "/bearer.tar.gz":
+			authorized = r.Header.Get("Authorization") == "Bearer t0ken"
+		case "/cert.tar.gz":
+			authorized = len(r.TLS.PeerCertificates) > 0
+		case "/redirect.tar.gz":
+			http.Redirect(w, r, "/bearer.tar.gz", http.StatusFound)
+			return
+		}
+		if !authorized {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(archive)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	serverCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	kubeClient := fake.NewSimpleClientset(
+		&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "opendatahub"},
+			Data:       map[string]string{"ca-bundle.crt": string(serverCA)},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "basic", Namespace: "opendatahub"},
+			Type:       v1.SecretTypeBasicAuth,
+			Data: map[string][]byte{
+				v1.BasicAuthUsernameKey: []byte("odh"),
+				v1.BasicAuthPasswordKey: []byte("secret"),
+			},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bearer", Namespace: "opendatahub"},
+			Data:       map[string][]byte{"token": []byte("t0ken\n")},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "cert", Namespace: "opendatahub"},
+			Type:       v1.SecretTypeTLS,
+			Data: map[string][]byte{
+				v1.TLSCertKey:       clientCert,
+				v1.TLSPrivateKeyKey: clientKey,
+			},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "empty", Namespace: "opendatahub"},
+		},
+	)
+	defer func(f func() (kubernetes.Interface, error)) { newKubeClient = f }(newKubeClient)
+	newKubeClient = func() (kubernetes.Interface, error) {
+		return kubeClient, nil
+	}
+	caBundle := &KeyReference{Kind: "ConfigMap", Name: "ca", Key: "ca-bundle.crt"}
+
+	type testCase struct {
+		Name       string
+		Path       string
+		AuthSecret string
+		CABundle   *KeyReference
+		Error      string
+	}
+	testCases := []testCase{
+		{
+			Name:       "basic",
+			Path:       "/basic.tar.gz",
+			AuthSecret: "basic",
+			CABundle:   caBundle,
+		},
+		{
+			Name:       "bearer",
+			Path:       "/bearer.tar.gz",
+			AuthSecret: "bearer",
+			CABundle:   caBundle,
+		},
+		{
+			Name:       "client-certificate",
+			Path:       "/cert.tar.gz",
+			AuthSecret: "cert",
+			CABundle:   caBundle,
+		},
+		{
+			Name:       "redirect",
+			Path:       "/redirect.tar.gz",
+			AuthSecret: "bearer",
+			CABundle:   caBundle,
+		},
+		{
+			Name:     "unauthorized",
+			Path:     "/bearer.tar.gz",
+			CABundle: caBundle,
+			Error:    "401 Unauthorized",
+		},
+		{
+			Name:       "wrong-credentials",
+			Path:       "/basic.tar.gz",
+			AuthSecret: "bearer",
+			CABundle:   caBundle,
+			Error:      "401 Unauthorized",
+		},
+		{
+			Name:       "untrusted-server",
+			Path:       "/bearer.tar.gz",
+			AuthSecret: "bearer",
+			Error:      "certificate",
+		},
+		{
+			Name:       "no-credentials",
+			Path:       "/bearer.tar.gz",
+			AuthSecret: "empty",
+			CABundle:   caBundle,
+			Error:      "secret empty has neither",
+		},
+		{
+			Name:       "missing-secret",
+			Path:       "/bearer.tar.gz",
+			AuthSecret: "missing",
+			CABundle:   caBundle,
+			Error:      "couldn't get auth secret missing",
+		},
+	}
+	for _, c := range testCases {
+		kfDef := &KfConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "opendatahub", Namespace: "opendatahub"},
+			Spec: KfConfigSpec{
+				AppDir: path.Join(testDir, c.Name),
+				Repos: []Repo{{
+					Name:       "manifests",
+					URI:        server.URL + c.Path,
+					AuthSecret: c.AuthSecret,
+					CABundle:   c.CABundle,
+				}},
+			},
+		}
+		err := kfDef.SyncCache()
+		if c.Error != "" {
+			if err == nil || !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("Case %v: expected error containing %v; got %v", c.Name, c.Error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case %v: failed to sync cache: %v", c.Name, err)
+			continue
+		}
+		if _, err := os.Stat(path.Join(kfDef.Status.Caches[0].LocalPath, "version")); err != nil {
+			t.Errorf("Case %v: archive was not unpacked: %v", c.Name, err)
+		}
+	}
+}
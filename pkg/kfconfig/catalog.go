@@ -0,0 +1,154 @@
+package kfconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	kfapis "github.com/opendatahub-io/opendatahub-operator/apis"
+	kftypesv3 "github.com/opendatahub-io/opendatahub-operator/apis/apps"
+)
+
+// CatalogMetadataFile, in the directory of an application, describes the application, e.g.
+//
+//	description: The Open Data Hub dashboard.
+const CatalogMetadataFile = "metadata.yaml"
+
+// kustomizationFiles are the names kustomize accepts for a kustomization file.
+var kustomizationFiles = []string{kftypesv3.KustomizationFile, "kustomization.yml", "Kustomization"}
+
+// Catalog lists the applications a repo provides, i.e. what can be put in spec.applications.
+type Catalog struct {
+	Repo         string               `json:"repo"`
+	Applications []CatalogApplication `json:"applications,omitempty"`
+}
+
+// CatalogApplication is a kustomize package of a repo.
+type CatalogApplication struct {
+	Name string `json:"name"`
+	// Path of the application in the repo, i.e. its repoRef path.
+	Path        string `json:"path"`
+	Description string `json:"description,omitempty"`
+	// Overlays are the directories in the overlays directory of the application.
+	Overlays []string `json:"overlays,omitempty"`
+	// Params are the keys of the params.env files of the application and its base.
+	Params []string `json:"params,omitempty"`
+}
+
+// catalogMetadata is the contents of CatalogMetadataFile.
+type catalogMetadata struct {
+	Description string `json:"description,omitempty"`
+}
+
+// GetCatalog returns the applications of the cached repo repoName.
+func (c *KfConfig) GetCatalog(repoName string) (*Catalog, error) {
+	cache, ok := c.GetRepoCache(repoName)
+	if !ok {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("repo %v isn't cached", repoName),
+		}
+	}
+	return BuildCatalog(repoName, cache.LocalPath)
+}
+
+// BuildCatalog returns the applications in repoDir: the directories holding a kustomization file,
+// a base or overlays, outside of the directories of other applications.
+func BuildCatalog(repoName string, repoDir string) (*Catalog, error) {
+	catalog := &Catalog{Repo: repoName}
+	err := filepath.Walk(repoDir, func(dir string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || dir == repoDir {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !isApplicationDir(dir) {
+			return nil
+		}
+		app, err := catalogApplication(repoDir, dir)
+		if err != nil {
+			return err
+		}
+		catalog.Applications = append(catalog.Applications, *app)
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("couldn't build the catalog of repo %v: %v", repoName, err),
+		}
+	}
+	return catalog, nil
+}
+
+// isApplicationDir returns true if dir is a kustomize package or has a base or overlays.
+func isApplicationDir(dir string) bool {
+	if hasKustomization(dir) || hasKustomization(filepath.Join(dir, "base")) {
+		return true
+	}
+	info, err := os.Stat(filepath.Join(dir, "overlays"))
+	return err == nil && info.IsDir()
+}
+
+func hasKustomization(dir string) bool {
+	for _, name := range kustomizationFiles {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// catalogApplication describes the application in dir.
+func catalogApplication(repoDir string, dir string) (*CatalogApplication, error) {
+	relPath, err := filepath.Rel(repoDir, dir)
+	if err != nil {
+		return nil, err
+	}
+	app := &CatalogApplication{Name: filepath.Base(dir), Path: filepath.ToSlash(relPath)}
+
+	metadataFile := filepath.Join(dir, CatalogMetadataFile)
+	if data, err := ioutil.ReadFile(metadataFile); err == nil {
+		metadata := &catalogMetadata{}
+		if err := yaml.Unmarshal(data, metadata); err != nil {
+			return nil, fmt.Errorf("invalid metadata file %v: %v", metadataFile, err)
+		}
+		app.Description = metadata.Description
+	}
+
+	if files, err := ioutil.ReadDir(filepath.Join(dir, "overlays")); err == nil {
+		for _, f := range files {
+			if f.IsDir() {
+				app.Overlays = append(app.Overlays, f.Name())
+			}
+		}
+	}
+
+	params := map[string]bool{}
+	for _, paramsDir := range []string{dir, filepath.Join(dir, "base")} {
+		data, err := ioutil.ReadFile(filepath.Join(paramsDir, kftypesv3.KustomizationParamFile))
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			params[strings.TrimSpace(strings.SplitN(line, "=", 2)[0])] = true
+		}
+	}
+	for name := range params {
+		app.Params = append(app.Params, name)
+	}
+	sort.Strings(app.Params)
+	return app, nil
+}
@@ -0,0 +1,65 @@
+package kfconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuildCatalog(t *testing.T) {
+	repoDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(repoDir)
+	files := map[string]string{
+		"odh-dashboard/base/kustomization.yaml":                        "resources: []\n",
+		"odh-dashboard/base/params.env":                                "# the dashboard image\nimage=\nnamespace=\n",
+		"odh-dashboard/params.env":                                     "replicas=1\n",
+		"odh-dashboard/metadata.yaml":                                  "description: The Open Data Hub dashboard.\n",
+		"odh-dashboard/overlays/authentication/kustomization.yaml":     "resources: []\n",
+		"odh-dashboard/overlays/odhdashboardconfig/kustomization.yaml": "resources: []\n",
+		"kfdef/odh-core.yaml":                                          "kind: KfDef\n",
+		"odh-notebook-controller/kustomization.yml":                    "resources: []\n",
+		"odh-notebook-controller/base/kustomization.yaml":              "resources: []\n",
+		"data-science-pipelines/overlays/mariadb/kustomization.yaml":   "resources: []\n",
+		".github/workflows/kustomization.yaml":                         "resources: []\n",
+	}
+	for name, contents := range files {
+		if err := os.MkdirAll(filepath.Join(repoDir, filepath.Dir(name)), 0755); err != nil {
+			t.Fatalf("Failed to create %v: %v", filepath.Dir(name), err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(repoDir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write %v: %v", name, err)
+		}
+	}
+
+	config := &KfConfig{Status: Status{Caches: []Cache{{Name: "manifests", LocalPath: repoDir}}}}
+	catalog, err := config.GetCatalog("manifests")
+	if err != nil {
+		t.Fatalf("Failed to build the catalog: %v", err)
+	}
+	expected := &Catalog{
+		Repo: "manifests",
+		Applications: []CatalogApplication{
+			{Name: "data-science-pipelines", Path: "data-science-pipelines", Overlays: []string{"mariadb"}},
+			{
+				Name:        "odh-dashboard",
+				Path:        "odh-dashboard",
+				Description: "The Open Data Hub dashboard.",
+				Overlays:    []string{"authentication", "odhdashboardconfig"},
+				Params:      []string{"image", "namespace", "replicas"},
+			},
+			{Name: "odh-notebook-controller", Path: "odh-notebook-controller"},
+		},
+	}
+	if !reflect.DeepEqual(catalog, expected) {
+		t.Errorf("Expected catalog %+v; got %+v", expected, catalog)
+	}
+
+	if _, err := config.GetCatalog("missing"); err == nil {
+		t.Errorf("Expected an error for a repo which isn't cached")
+	}
+}
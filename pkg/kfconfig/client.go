@@ -0,0 +1,44 @@
+package kfconfig
+
+import (
+	"context"
+	"fmt"
+
+	kftypesv3 "github.com/opendatahub-io/opendatahub-operator/apis/apps"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// newKubeClient returns the client used to read the cluster objects referenced by repos.
+// It is a variable so that tests can substitute a fake clientset.
+var newKubeClient = func() (kubernetes.Interface, error) {
+	config := kftypesv3.GetConfig()
+	if config == nil {
+		return nil, fmt.Errorf("could not load the kubernetes client config")
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// getSecret returns the Secret name in the namespace of the KfConfig.
+func (c *KfConfig) getSecret(name string) (*v1.Secret, error) {
+	kubeClient, err := newKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	return kubeClient.CoreV1().Secrets(c.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// getConfigMap returns the ConfigMap name in the namespace of the KfConfig.
+func (c *KfConfig) getConfigMap(name string) (*v1.ConfigMap, error) {
+	return getConfigMap(c.Namespace, name)
+}
+
+// getConfigMap returns the ConfigMap name in namespace.
+func getConfigMap(namespace string, name string) (*v1.ConfigMap, error) {
+	kubeClient, err := newKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	return kubeClient.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
@@ -0,0 +1,121 @@
+package kfconfig
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/client-go/discovery"
+)
+
+const (
+	// PlatformOpenShift is the platform of clusters serving the OpenShift API groups.
+	PlatformOpenShift = "OpenShift"
+	// PlatformKubernetes is the platform of other clusters.
+	PlatformKubernetes = "Kubernetes"
+)
+
+// OpenShiftAPIGroups are the API groups whose presence identifies OpenShift clusters.
+var OpenShiftAPIGroups = []string{"config.openshift.io", "route.openshift.io"}
+
+// GetClusterFacts returns the facts about the cluster collected by the operator. Without them,
+// e.g. when run by kfctl, it discovers the platform, the Kubernetes version and the API groups.
+func (c *KfConfig) GetClusterFacts() (*ClusterFacts, error) {
+	if c.Status.ClusterFacts != nil {
+		return c.Status.ClusterFacts, nil
+	}
+	kubeClient, err := newKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	facts, err := DiscoverAPIs(kubeClient.Discovery())
+	if err != nil {
+		return nil, err
+	}
+	serverVersion, err := kubeClient.Discovery().ServerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't discover the version of the cluster: %v", err)
+	}
+	facts.Version = serverVersion.GitVersion
+	facts.KubernetesVersion = serverVersion.GitVersion
+	c.Status.ClusterFacts = facts
+	return facts, nil
+}
+
+// DiscoverAPIs returns the facts about the cluster served by discovery: the API groups, the group
+// versions and the platform they identify. The other facts are left empty.
+func DiscoverAPIs(d discovery.DiscoveryInterface) (*ClusterFacts, error) {
+	groups, err := d.ServerGroups()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't discover the API groups of the cluster: %v", err)
+	}
+	facts := &ClusterFacts{Platform: PlatformKubernetes}
+	for _, g := range groups.Groups {
+		facts.APIGroups = append(facts.APIGroups, g.Name)
+		for _, v := range g.Versions {
+			facts.APIVersions = append(facts.APIVersions, v.GroupVersion)
+		}
+	}
+	sort.Strings(facts.APIGroups)
+	sort.Strings(facts.APIVersions)
+	for _, g := range OpenShiftAPIGroups {
+		if facts.HasAPIGroup(g) {
+			facts.Platform = PlatformOpenShift
+		}
+	}
+	return facts, nil
+}
+
+// HasAPIGroup returns true if the cluster serves the API group.
+func (f *ClusterFacts) HasAPIGroup(group string) bool {
+	for _, g := range f.APIGroups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAPIVersion returns true if the cluster serves the group version, e.g. apps/v1.
+func (f *ClusterFacts) HasAPIVersion(groupVersion string) bool {
+	for _, v := range f.APIVersions {
+		if v == groupVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// Param returns the value of the fact name as a render param: platform, version,
+// kubernetesVersion, ingressDomain, defaultStorageClass, httpProxy, httpsProxy or noProxy.
+// The proxy settings are empty when the cluster has no proxy; the other facts are required.
+func (f *ClusterFacts) Param(name string) (string, error) {
+	var value string
+	proxy := f.Proxy
+	if proxy == nil {
+		proxy = &ClusterProxy{}
+	}
+	switch name {
+	case "platform":
+		value = f.Platform
+	case "version":
+		value = f.Version
+	case "kubernetesVersion":
+		value = f.KubernetesVersion
+	case "ingressDomain":
+		value = f.IngressDomain
+	case "defaultStorageClass":
+		value = f.DefaultStorageClass
+	case "httpProxy":
+		return proxy.HTTPProxy, nil
+	case "httpsProxy":
+		return proxy.HTTPSProxy, nil
+	case "noProxy":
+		return proxy.NoProxy, nil
+	default:
+		return "", fmt.Errorf("unknown cluster fact %v", name)
+	}
+	if value == "" {
+		return "", fmt.Errorf("the cluster has no %v", name)
+	}
+	return value, nil
+}
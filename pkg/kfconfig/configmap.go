@@ -0,0 +1,82 @@
+package kfconfig
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	kfapis "github.com/opendatahub-io/opendatahub-operator/apis"
+)
+
+const (
+	// ConfigMapScheme is the URI scheme of repos stored as a gzipped tarball in the binaryData
+	// of a ConfigMap, e.g. configmap://opendatahub/odh-manifests/odh-manifests.tar.gz
+	ConfigMapScheme = "configmap"
+)
+
+// splitRepoURI returns the n slash separated elements following the scheme of uri. The last
+// element holds the rest of the path and is optional when optionalLast is true.
+func splitRepoURI(uri string, scheme string, n int, optionalLast bool) ([]string, error) {
+	prefix := scheme + "://"
+	if !strings.HasPrefix(uri, prefix) {
+		return nil, fmt.Errorf("%v is not a %v URI", uri, prefix)
+	}
+	elements := strings.SplitN(strings.TrimPrefix(uri, prefix), "/", n)
+	if optionalLast && len(elements) == n-1 {
+		elements = append(elements, "")
+	}
+	if len(elements) != n {
+		return nil, fmt.Errorf("%v has %v path elements; expected %v", uri, len(elements), n)
+	}
+	for i, element := range elements {
+		if element == "" && (i < n-1 || !optionalLast) {
+			return nil, fmt.Errorf("%v has an empty path element", uri)
+		}
+	}
+	return elements, nil
+}
+
+// fetchConfigMap unpacks the tarball of the configmap://<namespace>/<name>/<key> URI r.URI
+// into cacheDir. It is verified like any other archive.
+func (c *KfConfig) fetchConfigMap(r Repo, cacheDir string) error {
+	elements, err := splitRepoURI(r.URI, ConfigMapScheme, 3, false)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: err.Error(),
+		}
+	}
+	namespace, name, key := elements[0], elements[1], elements[2]
+	cm, err := getConfigMap(namespace, name)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't get ConfigMap %v/%v of repo %v: %v", namespace, name, r.Name, err),
+		}
+	}
+	data, ok := cm.BinaryData[key]
+	if !ok {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("ConfigMap %v/%v has no binaryData key %v", namespace, name, key),
+		}
+	}
+
+	archive := bytes.NewReader(data)
+	if r.SHA256 != "" || r.Signature != nil {
+		hclient, err := c.newArchiveClient(r)
+		if err != nil {
+			return err
+		}
+		if err := c.verifyArchive(r, archive, hclient); err != nil {
+			return err
+		}
+	}
+	if err := untar(archive, cacheDir); err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't unpack %v: %v", r.URI, err),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package kfconfig
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSplitRepoURI(t *testing.T) {
+	type testCase struct {
+		URI          string
+		Scheme       string
+		OptionalLast bool
+		Expected     []string
+		Error        string
+	}
+	testCases := []testCase{
+		{
+			URI:      "configmap://opendatahub/manifests/odh-manifests.tar.gz",
+			Scheme:   ConfigMapScheme,
+			Expected: []string{"opendatahub", "manifests", "odh-manifests.tar.gz"},
+		},
+		{
+			URI:          "pvc://opendatahub/manifests/releases/odh-manifests.tar.gz",
+			Scheme:       PVCScheme,
+			OptionalLast: true,
+			Expected:     []string{"opendatahub", "manifests", "releases/odh-manifests.tar.gz"},
+		},
+		{
+			URI:          "pvc://opendatahub/manifests",
+			Scheme:       PVCScheme,
+			OptionalLast: true,
+			Expected:     []string{"opendatahub", "manifests", ""},
+		},
+		{
+			URI:    "configmap://opendatahub/manifests",
+			Scheme: ConfigMapScheme,
+			Error:  "has 2 path elements; expected 3",
+		},
+		{
+			URI:    "configmap://opendatahub//odh-manifests.tar.gz",
+			Scheme: ConfigMapScheme,
+			Error:  "has an empty path element",
+		},
+		{
+			URI:    "pvc://opendatahub/manifests",
+			Scheme: ConfigMapScheme,
+			Error:  "is not a configmap:// URI",
+		},
+	}
+	for _, c := range testCases {
+		elements, err := splitRepoURI(c.URI, c.Scheme, 3, c.OptionalLast)
+		if c.Error != "" {
+			if err == nil || !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("Case %v: expected error containing %v; got %v", c.URI, c.Error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case %v: failed to split: %v", c.URI, err)
+			continue
+		}
+		if strings.Join(elements, "|") != strings.Join(c.Expected, "|") {
+			t.Errorf("Case %v: expected %q; got %q", c.URI, c.Expected, elements)
+		}
+	}
+}
+
+func TestSyncCacheConfigMap(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	archive := newArchive(t, []archiveEntry{
+		{Name: "odh-manifests/", Type: tar.TypeDir},
+		{Name: "odh-manifests/version", Type: tar.TypeReg, Content: "v1"},
+	})
+	kubeClient := fake.NewSimpleClientset(
+		&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "odh-manifests", Namespace: "manifests"},
+			BinaryData: map[string][]byte{"odh-manifests.tar.gz": archive},
+		},
+	)
+	defer func(f func() (kubernetes.Interface, error)) { newKubeClient = f }(newKubeClient)
+	newKubeClient = func() (kubernetes.Interface, error) {
+		return kubeClient, nil
+	}
+
+	type testCase struct {
+		Name   string
+		URI    string
+		SHA256 string
+		Error  string
+	}
+	testCases := []testCase{
+		{
+			Name:   "valid",
+			URI:    "configmap://manifests/odh-manifests/odh-manifests.tar.gz",
+			SHA256: fmt.Sprintf("%x", sha256.Sum256(archive)),
+		},
+		{
+			Name:  "missing-key",
+			URI:   "configmap://manifests/odh-manifests/missing.tar.gz",
+			Error: "ConfigMap manifests/odh-manifests has no binaryData key missing.tar.gz",
+		},
+		{
+			Name:  "missing-configmap",
+			URI:   "configmap://opendatahub/odh-manifests/odh-manifests.tar.gz",
+			Error: "couldn't get ConfigMap opendatahub/odh-manifests",
+		},
+		{
+			Name:   "sha256-mismatch",
+			URI:    "configmap://manifests/odh-manifests/odh-manifests.tar.gz",
+			SHA256: strings.Repeat("0", 64),
+			Error:  "failed verification",
+		},
+	}
+	for _, c := range testCases {
+		kfDef := &KfConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "opendatahub", Namespace: "opendatahub"},
+			Spec: KfConfigSpec{
+				AppDir: path.Join(testDir, c.Name),
+				Repos:  []Repo{{Name: "manifests", URI: c.URI, SHA256: c.SHA256}},
+			},
+		}
+		err := kfDef.SyncCache()
+		if c.Error != "" {
+			if err == nil || !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("Case %v: expected error containing %v; got %v", c.Name, c.Error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case %v: failed to sync cache: %v", c.Name, err)
+			continue
+		}
+		expected := path.Join(testDir, c.Name, DefaultCacheDir, "manifests", "odh-manifests")
+		if len(kfDef.Status.Caches) != 1 || kfDef.Status.Caches[0].LocalPath != expected {
+			t.Errorf("Case %v: expected the cache at %v; got %v", c.Name, expected, kfDef.Status.Caches)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package kfconfig
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	kfapis "github.com/opendatahub-io/opendatahub-operator/apis"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	// GitPrefix forces a repo URI to be cloned with git, as in go-getter, e.g.
+	// git::https://github.com/opendatahub-io/odh-manifests.git?ref=v1.4&depth=1
+	GitPrefix = "git::"
+)
+
+var (
+	commitSHA = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+	// gitRef allows the characters of branch and tag names, without a leading "-" which git would
+	// read as an option.
+	gitRef = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._/+-]*$`)
+)
+
+// gitSource is a git repository at a given ref.
+type gitSource struct {
+	URL string
+	// Ref is a branch, tag or commit; the default branch is used when empty.
+	Ref string
+	// Depth creates a shallow clone with the given number of commits when greater than 0.
+	Depth      int
+	Submodules bool
+}
+
+// parseGitURI parses a URI of the form
+// git::<url>[?ref=<branch|tag|commit>][&depth=<n>][&submodules=true].
+// Other query parameters are kept in the url.
+func parseGitURI(uri string) (*gitSource, error) {
+	if !strings.HasPrefix(uri, GitPrefix) {
+		return nil, fmt.Errorf("%v is not a %v URI", uri, GitPrefix)
+	}
+	src := &gitSource{URL: strings.TrimPrefix(uri, GitPrefix)}
+	i := strings.LastIndex(src.URL, "?")
+	if i < 0 {
+		if err := src.validate(); err != nil {
+			return nil, fmt.Errorf("%v: %v", uri, err)
+		}
+		return src, nil
+	}
+	query, err := url.ParseQuery(src.URL[i+1:])
+	if err != nil {
+		return nil, fmt.Errorf("%v has an invalid query: %v", uri, err)
+	}
+	src.URL = src.URL[:i]
+	src.Ref = query.Get("ref")
+	if depth := query.Get("depth"); depth != "" {
+		if src.Depth, err = strconv.Atoi(depth); err != nil || src.Depth < 0 {
+			return nil, fmt.Errorf("%v has an invalid depth %v", uri, depth)
+		}
+	}
+	if submodules := query.Get("submodules"); submodules != "" {
+		if src.Submodules, err = strconv.ParseBool(submodules); err != nil {
+			return nil, fmt.Errorf("%v has an invalid submodules value %v", uri, submodules)
+		}
+	}
+	for _, k := range []string{"ref", "depth", "submodules"} {
+		query.Del(k)
+	}
+	if len(query) > 0 {
+		src.URL += "?" + query.Encode()
+	}
+	if src.URL == "" {
+		return nil, fmt.Errorf("%v must specify a repository", uri)
+	}
+	if err := src.validate(); err != nil {
+		return nil, fmt.Errorf("%v: %v", uri, err)
+	}
+	return src, nil
+}
+
+// validate checks that the URL and ref of s can't be read by git as options, and that the ref
+// is a valid ref name.
+func (s *gitSource) validate() error {
+	if strings.HasPrefix(s.URL, "-") {
+		return fmt.Errorf("the repository URL must not start with \"-\"")
+	}
+	if s.Ref == "" {
+		return nil
+	}
+	if !gitRef.MatchString(s.Ref) || strings.Contains(s.Ref, "..") || strings.Contains(s.Ref, "//") ||
+		strings.Contains(s.Ref, "/.") || strings.HasSuffix(s.Ref, "/") || strings.HasSuffix(s.Ref, ".") ||
+		strings.HasSuffix(s.Ref, ".lock") {
+		return fmt.Errorf("invalid ref %v", s.Ref)
+	}
+	return nil
+}
+
+// gitCredentials returns the environment passing the credentials of secret to git.
+// A kubernetes.io/ssh-auth Secret provides the key through GIT_SSH_COMMAND, checking the
+// host against its optional known_hosts key. A kubernetes.io/basic-auth Secret provides an
+// Authorization header scoped to the host of the repository. Files are written to tmpDir.
+func gitCredentials(secret *v1.Secret, repoURL string, tmpDir string) ([]string, error) {
+	if key, ok := secret.Data[v1.SSHAuthPrivateKey]; ok {
+		keyFile := filepath.Join(tmpDir, "id")
+		if err := ioutil.WriteFile(keyFile, key, 0600); err != nil {
+			return nil, err
+		}
+		knownHostsFile := filepath.Join(tmpDir, "known_hosts")
+		strictHostKeyChecking := "accept-new"
+		if knownHosts, ok := secret.Data["known_hosts"]; ok {
+			if err := ioutil.WriteFile(knownHostsFile, knownHosts, 0600); err != nil {
+				return nil, err
+			}
+			strictHostKeyChecking = "yes"
+		} else {
+			log.Warnf("Secret %v has no known_hosts; accepting the host key of %v on first use", secret.Name, repoURL)
+		}
+		return []string{fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %v -o IdentitiesOnly=yes -o UserKnownHostsFile=%v -o StrictHostKeyChecking=%v",
+			keyFile, knownHostsFile, strictHostKeyChecking)}, nil
+	}
+
+	username, hasUsername := secret.Data[v1.BasicAuthUsernameKey]
+	password, hasPassword := secret.Data[v1.BasicAuthPasswordKey]
+	if !hasUsername && !hasPassword {
+		return nil, fmt.Errorf("secret %v has neither an %v nor a %v and %v key",
+			secret.Name, v1.SSHAuthPrivateKey, v1.BasicAuthUsernameKey, v1.BasicAuthPasswordKey)
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("basic auth secret %v can only be used with http(s) git URLs", secret.Name)
+	}
+	// The header is passed through the environment so that it does not show up in the process list.
+	auth := base64.StdEncoding.EncodeToString([]byte(string(username) + ":" + string(password)))
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		fmt.Sprintf("GIT_CONFIG_KEY_0=http.%v://%v/.extraHeader", u.Scheme, u.Host),
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + auth,
+	}, nil
+}
+
+// git runs a git command in dir and returns its trimmed standard output.
+func git(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), env...)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %v failed: %v: %v", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// fetchGit clones the git repo r.URI at its ref into cacheDir and returns the resolved commit SHA.
+func (c *KfConfig) fetchGit(r Repo, cacheDir string) (string, error) {
+	src, err := parseGitURI(r.URI)
+	if err != nil {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: err.Error(),
+		}
+	}
+
+	env, cleanup, err := c.gitEnv(r, src)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	revision, err := cloneGit(src, cacheDir, env)
+	if err != nil {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't clone URI %v: %v", r.URI, err),
+		}
+	}
+	return revision, nil
+}
+
+// gitEnv returns the environment passing the credentials of the AuthSecret of r to git and
+// the function removing the files it refers to.
+func (c *KfConfig) gitEnv(r Repo, src *gitSource) ([]string, func(), error) {
+	if r.AuthSecret == "" {
+		return nil, func() {}, nil
+	}
+	secret, err := c.getSecret(r.AuthSecret)
+	if err != nil {
+		return nil, nil, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't get auth secret %v of repo %v: %v", r.AuthSecret, r.Name, err),
+		}
+	}
+	tmpDir, err := ioutil.TempDir("", "git-credentials")
+	if err != nil {
+		return nil, nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("couldn't create the credentials dir: %v", err),
+		}
+	}
+	cleanup := func() { os.RemoveAll(tmpDir) }
+	env, err := gitCredentials(secret, src.URL, tmpDir)
+	if err != nil {
+		cleanup()
+		return nil, nil, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: err.Error(),
+		}
+	}
+	return env, cleanup, nil
+}
+
+// cloneGit checks out src into the empty directory dir. Branches and tags are fetched
+// directly, shallowly if requested; a commit that cannot be fetched by SHA falls back to
+// fetching every ref.
+func cloneGit(src *gitSource, dir string, env []string) (string, error) {
+	if _, err := git(dir, env, "init", "-q"); err != nil {
+		return "", err
+	}
+	if _, err := git(dir, env, "remote", "add", "--", "origin", src.URL); err != nil {
+		return "", err
+	}
+	ref := src.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	fetch := []string{"fetch", "-q"}
+	if src.Depth > 0 {
+		fetch = append(fetch, "--depth", strconv.Itoa(src.Depth))
+	}
+	if _, err := git(dir, env, append(fetch, "--", "origin", ref)...); err != nil {
+		if !commitSHA.MatchString(ref) {
+			return "", err
+		}
+		log.Infof("Could not fetch commit %v directly, fetching all refs of %v: %v", ref, src.URL, err)
+		if _, err := git(dir, env, "fetch", "-q", "--", "origin", "+refs/heads/*:refs/remotes/origin/*", "+refs/tags/*:refs/tags/*"); err != nil {
+			return "", err
+		}
+		// The trailing "--" makes git read ref as a revision and never as a path.
+		if _, err := git(dir, env, "checkout", "-q", "--detach", ref, "--"); err != nil {
+			return "", err
+		}
+	} else if _, err := git(dir, env, "checkout", "-q", "--detach", "FETCH_HEAD", "--"); err != nil {
+		return "", err
+	}
+
+	if src.Submodules {
+		update := []string{"submodule", "update", "-q", "--init", "--recursive"}
+		if src.Depth > 0 {
+			update = append(update, "--depth", strconv.Itoa(src.Depth))
+		}
+		if _, err := git(dir, env, update...); err != nil {
+			return "", err
+		}
+	}
+	return git(dir, env, "rev-parse", "HEAD")
+}
@@ -0,0 +1,254 @@
+package kfconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseGitURI(t *testing.T) {
+	type testCase struct {
+		URI      string
+		Expected *gitSource
+		Error    bool
+	}
+	testCases := []testCase{
+		{
+			URI:      "git::https://github.com/opendatahub-io/odh-manifests.git",
+			Expected: &gitSource{URL: "https://github.com/opendatahub-io/odh-manifests.git"},
+		},
+		{
+			URI: "git::https://github.com/opendatahub-io/odh-manifests.git?ref=v1.4&depth=1&submodules=true",
+			Expected: &gitSource{
+				URL:        "https://github.com/opendatahub-io/odh-manifests.git",
+				Ref:        "v1.4",
+				Depth:      1,
+				Submodules: true,
+			},
+		},
+		{
+			URI:      "git::git@github.com:opendatahub-io/odh-manifests.git?ref=master",
+			Expected: &gitSource{URL: "git@github.com:opendatahub-io/odh-manifests.git", Ref: "master"},
+		},
+		{
+			URI:   "git::https://github.com/opendatahub-io/odh-manifests.git?depth=-1",
+			Error: true,
+		},
+		{
+			URI:   "https://github.com/opendatahub-io/odh-manifests.git",
+			Error: true,
+		},
+		{
+			URI:   "git::https://github.com/opendatahub-io/odh-manifests.git?ref=--upload-pack=touch%20/tmp/pwned",
+			Error: true,
+		},
+		{
+			URI:   "git::--upload-pack=touch /tmp/pwned",
+			Error: true,
+		},
+		{
+			URI:   "git::https://github.com/opendatahub-io/odh-manifests.git?ref=v1..v2",
+			Error: true,
+		},
+		{
+			URI:   "git::https://github.com/opendatahub-io/odh-manifests.git?ref=master@{1}",
+			Error: true,
+		},
+		{
+			URI:      "git::https://github.com/opendatahub-io/odh-manifests.git?ref=release/v1.4-rc_1",
+			Expected: &gitSource{URL: "https://github.com/opendatahub-io/odh-manifests.git", Ref: "release/v1.4-rc_1"},
+		},
+	}
+	for _, c := range testCases {
+		src, err := parseGitURI(c.URI)
+		if c.Error {
+			if err == nil {
+				t.Errorf("Case %v: expected an error", c.URI)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Case %v: failed to parse: %v", c.URI, err)
+		}
+		if diff := cmp.Diff(c.Expected, src); diff != "" {
+			t.Errorf("Case %v: unexpected source (-want, +got):\n%s", c.URI, diff)
+		}
+	}
+}
+
+func TestGitCredentials(t *testing.T) {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "git-credentials"},
+		Type:       v1.SecretTypeBasicAuth,
+		Data: map[string][]byte{
+			v1.BasicAuthUsernameKey: []byte("user"),
+			v1.BasicAuthPasswordKey: []byte("secret"),
+		},
+	}
+	env, err := gitCredentials(secret, "https://github.com/opendatahub-io/odh-manifests.git", "")
+	if err != nil {
+		t.Fatalf("Failed to get credentials: %v", err)
+	}
+	expected := []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.https://github.com/.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic dXNlcjpzZWNyZXQ=",
+	}
+	if diff := cmp.Diff(expected, env); diff != "" {
+		t.Errorf("Unexpected environment (-want, +got):\n%s", diff)
+	}
+
+	if _, err := gitCredentials(secret, "git@github.com:opendatahub-io/odh-manifests.git", ""); err == nil {
+		t.Errorf("Expected an error using basic auth with an ssh URL")
+	}
+}
+
+// newTestGitRepo creates a bare repository with two commits on master, a tag v1 on the
+// first one and a submodule, and returns its path with the SHAs of both commits.
+func newTestGitRepo(t *testing.T, dir string) (string, string, string) {
+	// Use a dedicated git config allowing file:// submodules.
+	gitConfig := path.Join(dir, "gitconfig")
+	ioutil.WriteFile(gitConfig, []byte("[user]\n\tname = test\n\temail = test@example.com\n"+
+		"[protocol \"file\"]\n\tallow = always\n"), 0644)
+	t.Setenv("GIT_CONFIG_GLOBAL", gitConfig)
+
+	run := func(dir string, args ...string) string {
+		out, err := git(dir, nil, args...)
+		if err != nil {
+			t.Fatalf("Failed to run git %v: %v", strings.Join(args, " "), err)
+		}
+		return out
+	}
+	write := func(file string, content string) {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %v: %v", file, err)
+		}
+	}
+
+	sub := path.Join(dir, "sub")
+	os.MkdirAll(sub, os.ModePerm)
+	run(sub, "init", "-q", "-b", "master")
+	write(path.Join(sub, "params.env"), "key=value\n")
+	run(sub, "add", ".")
+	run(sub, "commit", "-q", "-m", "submodule")
+
+	work := path.Join(dir, "work")
+	os.MkdirAll(work, os.ModePerm)
+	run(work, "init", "-q", "-b", "master")
+	write(path.Join(work, "version"), "v1\n")
+	run(work, "add", ".")
+	run(work, "commit", "-q", "-m", "v1")
+	run(work, "tag", "-a", "v1", "-m", "v1")
+	first := run(work, "rev-parse", "HEAD")
+
+	write(path.Join(work, "version"), "v2\n")
+	run(work, "submodule", "add", "-q", "file://"+sub, "sub")
+	run(work, "add", ".")
+	run(work, "commit", "-q", "-m", "v2")
+	second := run(work, "rev-parse", "HEAD")
+
+	bare := path.Join(dir, "manifests.git")
+	run(dir, "clone", "-q", "--bare", work, bare)
+	return bare, first, second
+}
+
+func TestSyncCacheGit(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	bare, first, second := newTestGitRepo(t, testDir)
+
+	type testCase struct {
+		Name       string
+		URI        string
+		Revision   string
+		Version    string
+		Commits    string
+		Submodules bool
+	}
+	testCases := []testCase{
+		{
+			Name:     "default-branch",
+			URI:      "git::file://" + bare,
+			Revision: second,
+			Version:  "v2\n",
+			Commits:  "2",
+		},
+		{
+			Name:     "tag",
+			URI:      "git::file://" + bare + "?ref=v1",
+			Revision: first,
+			Version:  "v1\n",
+			Commits:  "1",
+		},
+		{
+			Name:     "commit",
+			URI:      "git::file://" + bare + "?ref=" + first,
+			Revision: first,
+			Version:  "v1\n",
+			Commits:  "1",
+		},
+		{
+			Name:     "short-commit",
+			URI:      "git::file://" + bare + "?ref=" + first[:8],
+			Revision: first,
+			Version:  "v1\n",
+			Commits:  "1",
+		},
+		{
+			Name:       "shallow-branch-with-submodules",
+			URI:        "git::file://" + bare + "?ref=master&depth=1&submodules=true",
+			Revision:   second,
+			Version:    "v2\n",
+			Commits:    "1",
+			Submodules: true,
+		},
+	}
+
+	for _, c := range testCases {
+		appDir := path.Join(testDir, c.Name)
+		kfDef := &KfConfig{
+			Spec: KfConfigSpec{
+				AppDir: appDir,
+				Repos:  []Repo{{Name: "manifests", URI: c.URI}},
+			},
+		}
+		if err := kfDef.SyncCache(); err != nil {
+			t.Fatalf("Case %v: failed to sync cache: %v", c.Name, err)
+		}
+		cacheDir := path.Join(appDir, DefaultCacheDir, "manifests")
+		expected := []Cache{{Name: "manifests", LocalPath: cacheDir, Revision: c.Revision}}
+		if diff := cmp.Diff(expected, kfDef.Status.Caches); diff != "" {
+			t.Errorf("Case %v: unexpected caches (-want, +got):\n%s", c.Name, diff)
+		}
+		if version, _ := ioutil.ReadFile(path.Join(cacheDir, "version")); string(version) != c.Version {
+			t.Errorf("Case %v: expected version %q; got %q", c.Name, c.Version, string(version))
+		}
+		if commits, _ := git(cacheDir, nil, "rev-list", "--count", "HEAD"); commits != c.Commits {
+			t.Errorf("Case %v: expected %v commits; got %v", c.Name, c.Commits, commits)
+		}
+		_, err := os.Stat(path.Join(cacheDir, "sub", "params.env"))
+		if c.Submodules != (err == nil) {
+			t.Errorf("Case %v: expected submodule checked out %v; got %v", c.Name, c.Submodules, err == nil)
+		}
+	}
+
+	kfDef := &KfConfig{
+		Spec: KfConfigSpec{
+			AppDir: path.Join(testDir, "missing-ref"),
+			Repos:  []Repo{{Name: "manifests", URI: "git::file://" + bare + "?ref=missing"}},
+		},
+	}
+	if err := kfDef.SyncCache(); err == nil || !strings.Contains(err.Error(), "couldn't clone URI") {
+		t.Errorf("Expected a clone error for a missing ref; got %v", err)
+	}
+}
@@ -71,10 +71,49 @@ func (v V1) LoadKfConfig(def interface{}) (*kfconfig.KfConfig, error) {
 				}
 				kconfig.Parameters = append(kconfig.Parameters, p)
 			}
+			kconfig.Include = app.KustomizeConfig.Include
+			kconfig.PatchesStrategicMerge = app.KustomizeConfig.PatchesStrategicMerge
+			for _, patch := range app.KustomizeConfig.PatchesJson6902 {
+				p := kfconfig.PatchJson6902{
+					Patch: patch.Patch,
+				}
+				if patch.Target != nil {
+					p.Target = &kfconfig.PatchTarget{
+						Group:     patch.Target.Group,
+						Version:   patch.Target.Version,
+						Kind:      patch.Target.Kind,
+						Name:      patch.Target.Name,
+						Namespace: patch.Target.Namespace,
+					}
+				}
+				kconfig.PatchesJson6902 = append(kconfig.PatchesJson6902, p)
+			}
+			for _, overlay := range app.KustomizeConfig.ConditionalOverlays {
+				kconfig.ConditionalOverlays = append(kconfig.ConditionalOverlays, kfconfig.ConditionalOverlay{
+					Name:                overlay.Name,
+					WhenAPIGroupPresent: overlay.WhenAPIGroupPresent,
+					WhenPlatform:        overlay.WhenPlatform,
+					WhenClusterVersion:  overlay.WhenClusterVersion,
+				})
+			}
 			application.KustomizeConfig = kconfig
 		}
+		application.HelmConfig = toKfConfigHelmConfig(app.HelmConfig)
+		application.Placement = toKfConfigPlacement(app.Placement)
+		application.Resources = app.Resources
+		for _, output := range app.Outputs {
+			application.Outputs = append(application.Outputs, kfconfig.ApplicationOutput{
+				Name:       output.Name,
+				APIVersion: output.APIVersion,
+				Kind:       output.Kind,
+				ObjectName: output.ObjectName,
+				Namespace:  output.Namespace,
+				FieldPath:  output.FieldPath,
+			})
+		}
 		config.Spec.Applications = append(config.Spec.Applications, application)
 	}
+	config.Spec.Placement = toKfConfigPlacement(kfdef.Spec.Placement)
 
 	for _, plugin := range kfdef.Spec.Plugins {
 		p := kfconfig.Plugin{
@@ -130,8 +169,35 @@ func (v V1) LoadKfConfig(def interface{}) (*kfconfig.KfConfig, error) {
 
 	for _, repo := range kfdef.Spec.Repos {
 		r := kfconfig.Repo{
-			Name: repo.Name,
-			URI:  repo.URI,
+			Name:       repo.Name,
+			URI:        repo.URI,
+			PullSecret: repo.PullSecret,
+			AuthSecret: repo.AuthSecret,
+			SHA256:     repo.SHA256,
+		}
+		if repo.CABundle != nil {
+			r.CABundle = &kfconfig.KeyReference{
+				Kind: repo.CABundle.Kind,
+				Name: repo.CABundle.Name,
+				Key:  repo.CABundle.Key,
+			}
+		}
+		if repo.Update != nil {
+			r.Update = &kfconfig.RepoUpdatePolicy{
+				Interval: repo.Update.Interval,
+				Auto:     repo.Update.Auto,
+			}
+		}
+		if repo.Signature != nil {
+			r.Signature = &kfconfig.RepoSignature{
+				URI:    repo.Signature.URI,
+				Format: repo.Signature.Format,
+				PublicKey: kfconfig.KeyReference{
+					Kind: repo.Signature.PublicKey.Kind,
+					Name: repo.Signature.PublicKey.Name,
+					Key:  repo.Signature.PublicKey.Key,
+				},
+			}
 		}
 		config.Spec.Repos = append(config.Spec.Repos, r)
 	}
@@ -151,9 +217,41 @@ func (v V1) LoadKfConfig(def interface{}) (*kfconfig.KfConfig, error) {
 		c := kfconfig.Cache{
 			Name:      cache.Name,
 			LocalPath: cache.LocalPath,
+			Revision:  cache.Revision,
 		}
 		config.Status.Caches = append(config.Status.Caches, c)
 	}
+	for _, overlays := range kfdef.Status.Overlays {
+		config.Status.Overlays = append(config.Status.Overlays, kfconfig.ApplicationOverlays{
+			Name:     overlays.Name,
+			Overlays: overlays.Overlays,
+		})
+	}
+	for _, outputs := range kfdef.Status.Outputs {
+		o := kfconfig.ApplicationOutputs{Name: outputs.Name}
+		for _, nv := range outputs.Values {
+			o.Values = append(o.Values, kfconfig.NameValue{Name: nv.Name, Value: nv.Value})
+		}
+		config.Status.Outputs = append(config.Status.Outputs, o)
+	}
+	if facts := kfdef.Status.ClusterFacts; facts != nil {
+		config.Status.ClusterFacts = &kfconfig.ClusterFacts{
+			Platform:            facts.Platform,
+			Version:             facts.Version,
+			KubernetesVersion:   facts.KubernetesVersion,
+			IngressDomain:       facts.IngressDomain,
+			APIGroups:           facts.APIGroups,
+			APIVersions:         facts.APIVersions,
+			DefaultStorageClass: facts.DefaultStorageClass,
+		}
+		if facts.Proxy != nil {
+			config.Status.ClusterFacts.Proxy = &kfconfig.ClusterProxy{
+				HTTPProxy:  facts.Proxy.HTTPProxy,
+				HTTPSProxy: facts.Proxy.HTTPSProxy,
+				NoProxy:    facts.Proxy.NoProxy,
+			}
+		}
+	}
 
 	return config, nil
 }
@@ -190,10 +288,49 @@ func (v V1) LoadKfDef(config kfconfig.KfConfig, out interface{}) error {
 				}
 				kconfig.Parameters = append(kconfig.Parameters, p)
 			}
+			kconfig.Include = app.KustomizeConfig.Include
+			kconfig.PatchesStrategicMerge = app.KustomizeConfig.PatchesStrategicMerge
+			for _, patch := range app.KustomizeConfig.PatchesJson6902 {
+				p := kfdeftypes.PatchJson6902{
+					Patch: patch.Patch,
+				}
+				if patch.Target != nil {
+					p.Target = &kfdeftypes.PatchTarget{
+						Group:     patch.Target.Group,
+						Version:   patch.Target.Version,
+						Kind:      patch.Target.Kind,
+						Name:      patch.Target.Name,
+						Namespace: patch.Target.Namespace,
+					}
+				}
+				kconfig.PatchesJson6902 = append(kconfig.PatchesJson6902, p)
+			}
+			for _, overlay := range app.KustomizeConfig.ConditionalOverlays {
+				kconfig.ConditionalOverlays = append(kconfig.ConditionalOverlays, kfdeftypes.ConditionalOverlay{
+					Name:                overlay.Name,
+					WhenAPIGroupPresent: overlay.WhenAPIGroupPresent,
+					WhenPlatform:        overlay.WhenPlatform,
+					WhenClusterVersion:  overlay.WhenClusterVersion,
+				})
+			}
 			application.KustomizeConfig = kconfig
 		}
+		application.HelmConfig = toKfDefHelmConfig(app.HelmConfig)
+		application.Placement = toKfDefPlacement(app.Placement)
+		application.Resources = app.Resources
+		for _, output := range app.Outputs {
+			application.Outputs = append(application.Outputs, kfdeftypes.ApplicationOutput{
+				Name:       output.Name,
+				APIVersion: output.APIVersion,
+				Kind:       output.Kind,
+				ObjectName: output.ObjectName,
+				Namespace:  output.Namespace,
+				FieldPath:  output.FieldPath,
+			})
+		}
 		kfdef.Spec.Applications = append(kfdef.Spec.Applications, application)
 	}
+	kfdef.Spec.Placement = toKfDefPlacement(config.Spec.Placement)
 
 	for _, plugin := range config.Spec.Plugins {
 		p := kfdeftypes.Plugin{
@@ -222,8 +359,35 @@ func (v V1) LoadKfDef(config kfconfig.KfConfig, out interface{}) error {
 
 	for _, repo := range config.Spec.Repos {
 		r := kfdeftypes.Repo{
-			Name: repo.Name,
-			URI:  repo.URI,
+			Name:       repo.Name,
+			URI:        repo.URI,
+			PullSecret: repo.PullSecret,
+			AuthSecret: repo.AuthSecret,
+			SHA256:     repo.SHA256,
+		}
+		if repo.CABundle != nil {
+			r.CABundle = &kfdeftypes.KeyReference{
+				Kind: repo.CABundle.Kind,
+				Name: repo.CABundle.Name,
+				Key:  repo.CABundle.Key,
+			}
+		}
+		if repo.Update != nil {
+			r.Update = &kfdeftypes.RepoUpdatePolicy{
+				Interval: repo.Update.Interval,
+				Auto:     repo.Update.Auto,
+			}
+		}
+		if repo.Signature != nil {
+			r.Signature = &kfdeftypes.RepoSignature{
+				URI:    repo.Signature.URI,
+				Format: repo.Signature.Format,
+				PublicKey: kfdeftypes.KeyReference{
+					Kind: repo.Signature.PublicKey.Kind,
+					Name: repo.Signature.PublicKey.Name,
+					Key:  repo.Signature.PublicKey.Key,
+				},
+			}
 		}
 		kfdef.Spec.Repos = append(kfdef.Spec.Repos, r)
 	}
@@ -244,9 +408,41 @@ func (v V1) LoadKfDef(config kfconfig.KfConfig, out interface{}) error {
 		c := kfdeftypes.RepoCache{
 			Name:      cache.Name,
 			LocalPath: cache.LocalPath,
+			Revision:  cache.Revision,
 		}
 		kfdef.Status.ReposCache = append(kfdef.Status.ReposCache, c)
 	}
+	for _, overlays := range config.Status.Overlays {
+		kfdef.Status.Overlays = append(kfdef.Status.Overlays, kfdeftypes.ApplicationOverlays{
+			Name:     overlays.Name,
+			Overlays: overlays.Overlays,
+		})
+	}
+	for _, outputs := range config.Status.Outputs {
+		o := kfdeftypes.ApplicationOutputs{Name: outputs.Name}
+		for _, nv := range outputs.Values {
+			o.Values = append(o.Values, kfdeftypes.NameValue{Name: nv.Name, Value: nv.Value})
+		}
+		kfdef.Status.Outputs = append(kfdef.Status.Outputs, o)
+	}
+	if facts := config.Status.ClusterFacts; facts != nil {
+		kfdef.Status.ClusterFacts = &kfdeftypes.ClusterFacts{
+			Platform:            facts.Platform,
+			Version:             facts.Version,
+			KubernetesVersion:   facts.KubernetesVersion,
+			IngressDomain:       facts.IngressDomain,
+			APIGroups:           facts.APIGroups,
+			APIVersions:         facts.APIVersions,
+			DefaultStorageClass: facts.DefaultStorageClass,
+		}
+		if facts.Proxy != nil {
+			kfdef.Status.ClusterFacts.Proxy = &kfdeftypes.ClusterProxy{
+				HTTPProxy:  facts.Proxy.HTTPProxy,
+				HTTPSProxy: facts.Proxy.HTTPSProxy,
+				NoProxy:    facts.Proxy.NoProxy,
+			}
+		}
+	}
 
 	kfdefBytes, err := yaml.Marshal(kfdef)
 	if err != nil {
@@ -266,3 +462,79 @@ func (v V1) LoadKfDef(config kfconfig.KfConfig, out interface{}) error {
 		}
 	}
 }
+
+func toKfConfigPlacement(p *kfdeftypes.Placement) *kfconfig.Placement {
+	if p == nil {
+		return nil
+	}
+	return &kfconfig.Placement{
+		NodeSelector:      p.NodeSelector,
+		Tolerations:       p.Tolerations,
+		Affinity:          p.Affinity,
+		PriorityClassName: p.PriorityClassName,
+	}
+}
+
+func toKfDefPlacement(p *kfconfig.Placement) *kfdeftypes.Placement {
+	if p == nil {
+		return nil
+	}
+	return &kfdeftypes.Placement{
+		NodeSelector:      p.NodeSelector,
+		Tolerations:       p.Tolerations,
+		Affinity:          p.Affinity,
+		PriorityClassName: p.PriorityClassName,
+	}
+}
+
+func toKfConfigHelmConfig(h *kfdeftypes.HelmConfig) *kfconfig.HelmConfig {
+	if h == nil {
+		return nil
+	}
+	config := &kfconfig.HelmConfig{
+		ReleaseName: h.ReleaseName,
+		Namespace:   h.Namespace,
+		Values:      h.Values,
+	}
+	if h.RepoRef != nil {
+		config.RepoRef = &kfconfig.RepoRef{
+			Name: h.RepoRef.Name,
+			Path: h.RepoRef.Path,
+		}
+	}
+	for _, v := range h.ValuesFrom {
+		config.ValuesFrom = append(config.ValuesFrom, kfconfig.ValuesReference{
+			Kind:     v.Kind,
+			Name:     v.Name,
+			Key:      v.Key,
+			Optional: v.Optional,
+		})
+	}
+	return config
+}
+
+func toKfDefHelmConfig(h *kfconfig.HelmConfig) *kfdeftypes.HelmConfig {
+	if h == nil {
+		return nil
+	}
+	config := &kfdeftypes.HelmConfig{
+		ReleaseName: h.ReleaseName,
+		Namespace:   h.Namespace,
+		Values:      h.Values,
+	}
+	if h.RepoRef != nil {
+		config.RepoRef = &kfdeftypes.RepoRef{
+			Name: h.RepoRef.Name,
+			Path: h.RepoRef.Path,
+		}
+	}
+	for _, v := range h.ValuesFrom {
+		config.ValuesFrom = append(config.ValuesFrom, kfdeftypes.ValuesReference{
+			Kind:     v.Kind,
+			Name:     v.Name,
+			Key:      v.Key,
+			Optional: v.Optional,
+		})
+	}
+	return config
+}
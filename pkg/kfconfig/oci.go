@@ -0,0 +1,445 @@
+package kfconfig
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	kfapis "github.com/opendatahub-io/opendatahub-operator/apis"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	// OCIScheme is the URI scheme of repos stored as OCI artifacts,
+	// e.g. oci://quay.io/opendatahub/manifests:v1.0@sha256:<digest>
+	OCIScheme = "oci"
+)
+
+// ociManifestMediaTypes are the manifest media types accepted from a registry.
+var ociManifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// ociLayerMediaTypes are the layer media types unpacked into the cache.
+var ociLayerMediaTypes = map[string]bool{
+	"application/vnd.oci.image.layer.v1.tar+gzip":       true,
+	"application/vnd.docker.image.rootfs.diff.tar.gzip": true,
+}
+
+// maxOCIManifestSize is the maximum size of a manifest. It's a variable so that tests can lower it.
+var maxOCIManifestSize int64 = 4 << 20
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// ociReference identifies an artifact stored in an OCI registry.
+type ociReference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType,omitempty"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Layers        []ociDescriptor `json:"layers"`
+	// digest is the digest of the manifest as returned by the registry.
+	digest string
+}
+
+// parseOCIReference parses a URI of the form oci://registry/repository[:tag][@digest].
+// The tag defaults to latest when neither a tag nor a digest is given.
+func parseOCIReference(uri string) (*ociReference, error) {
+	rest := strings.TrimPrefix(uri, OCIScheme+"://")
+	if rest == uri {
+		return nil, fmt.Errorf("%v is not an %v:// URI", uri, OCIScheme)
+	}
+	i := strings.Index(rest, "/")
+	if i <= 0 || i == len(rest)-1 {
+		return nil, fmt.Errorf("%v must specify a registry and a repository", uri)
+	}
+	ref := &ociReference{Registry: rest[:i]}
+	name := rest[i+1:]
+	if j := strings.Index(name, "@"); j >= 0 {
+		ref.Digest = name[j+1:]
+		name = name[:j]
+		if err := validateDigest(ref.Digest); err != nil {
+			return nil, fmt.Errorf("%v has an invalid digest: %v", uri, err)
+		}
+	}
+	if j := strings.LastIndex(name, ":"); j > strings.LastIndex(name, "/") {
+		ref.Tag = name[j+1:]
+		name = name[:j]
+	}
+	if name == "" {
+		return nil, fmt.Errorf("%v must specify a repository", uri)
+	}
+	ref.Repository = name
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return ref, nil
+}
+
+// reference returns the digest of the artifact if pinned, its tag otherwise.
+func (r *ociReference) reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// baseURL returns the registry API URL of the repository. Registries on the loopback
+// interface are accessed over plain HTTP, all others over HTTPS.
+func (r *ociReference) baseURL() string {
+	host := r.Registry
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	scheme := "https"
+	if host == "localhost" || net.ParseIP(host).IsLoopback() {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%v://%v/v2/%v", scheme, r.Registry, r.Repository)
+}
+
+func validateDigest(digest string) error {
+	hexDigest := strings.TrimPrefix(digest, "sha256:")
+	if hexDigest == digest {
+		return fmt.Errorf("unsupported digest algorithm in %v; only sha256 is supported", digest)
+	}
+	if b, err := hex.DecodeString(hexDigest); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("%v is not a valid sha256 digest", digest)
+	}
+	return nil
+}
+
+func verifyDigest(data []byte, digest string) error {
+	sum := sha256.Sum256(data)
+	if actual := "sha256:" + hex.EncodeToString(sum[:]); actual != digest {
+		return fmt.Errorf("digest mismatch: expected %v; got %v", digest, actual)
+	}
+	return nil
+}
+
+// ociClient pulls manifests and blobs from a registry using the distribution API.
+type ociClient struct {
+	client   *http.Client
+	ref      *ociReference
+	username string
+	password string
+	// authorization is the Authorization header obtained by answering the registry challenge.
+	authorization string
+}
+
+func (o *ociClient) do(u string, accept []string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "kfctl")
+	if len(accept) > 0 {
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+	if o.authorization != "" {
+		req.Header.Set("Authorization", o.authorization)
+	}
+	return o.client.Do(req)
+}
+
+// open fetches u, authenticating once if the registry challenges the request.
+// The caller must close the returned body.
+func (o *ociClient) open(u string, accept []string) (io.ReadCloser, error) {
+	resp, err := o.do(u, accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && o.authorization == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := o.authenticate(challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = o.do(u, accept); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %v returned %v", u, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// authenticate answers a Basic or Bearer WWW-Authenticate challenge of the registry.
+func (o *ociClient) authenticate(challenge string) error {
+	scheme := strings.SplitN(challenge, " ", 2)[0]
+	params := map[string]string{}
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if o.username == "" && o.password == "" {
+			return fmt.Errorf("registry %v requires credentials; set the pullSecret of the repo", o.ref.Registry)
+		}
+		o.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(o.username+":"+o.password))
+	case "bearer":
+		realm, err := url.Parse(params["realm"])
+		if err != nil || params["realm"] == "" {
+			return fmt.Errorf("registry %v returned an invalid token realm %q", o.ref.Registry, params["realm"])
+		}
+		q := realm.Query()
+		if service := params["service"]; service != "" {
+			q.Set("service", service)
+		}
+		scope := params["scope"]
+		if scope == "" {
+			scope = fmt.Sprintf("repository:%v:pull", o.ref.Repository)
+		}
+		q.Set("scope", scope)
+		realm.RawQuery = q.Encode()
+
+		req, err := http.NewRequest("GET", realm.String(), nil)
+		if err != nil {
+			return err
+		}
+		if o.username != "" || o.password != "" {
+			req.SetBasicAuth(o.username, o.password)
+		}
+		resp, err := o.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("could not get a token for registry %v: %v", o.ref.Registry, resp.Status)
+		}
+		token := struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+			return fmt.Errorf("could not decode the token of registry %v: %v", o.ref.Registry, err)
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		o.authorization = "Bearer " + token.Token
+	default:
+		return fmt.Errorf("registry %v returned an unsupported challenge %q", o.ref.Registry, challenge)
+	}
+	return nil
+}
+
+// manifest fetches the manifest of the artifact, verifying it against the digest if pinned.
+func (o *ociClient) manifest() (*ociManifest, error) {
+	body, err := o.open(fmt.Sprintf("%v/manifests/%v", o.ref.baseURL(), o.ref.reference()), ociManifestMediaTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(body, maxOCIManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxOCIManifestSize {
+		return nil, fmt.Errorf("manifest %v exceeds the limit of %v bytes", o.ref.reference(), maxOCIManifestSize)
+	}
+	if o.ref.Digest != "" {
+		if err := verifyDigest(data, o.ref.Digest); err != nil {
+			return nil, fmt.Errorf("manifest %v: %v", o.ref.reference(), err)
+		}
+	}
+	sum := sha256.Sum256(data)
+	manifest := &ociManifest{digest: "sha256:" + hex.EncodeToString(sum[:])}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("could not decode manifest %v: %v", o.ref.reference(), err)
+	}
+	return manifest, nil
+}
+
+// unpackLayer streams the blob of layer into untar, verifying its size and digest on the way.
+// The unpacked files can't be trusted when an error is returned.
+func (o *ociClient) unpackLayer(layer ociDescriptor, cacheDir string) error {
+	if err := validateDigest(layer.Digest); err != nil {
+		return err
+	}
+	limit := maxArchiveSize
+	if layer.Size > 0 && layer.Size < limit {
+		limit = layer.Size
+	}
+	body, err := o.open(fmt.Sprintf("%v/blobs/%v", o.ref.baseURL(), layer.Digest), nil)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	digest := sha256.New()
+	limited := &io.LimitedReader{R: body, N: limit + 1}
+	blob := io.TeeReader(limited, digest)
+	err = untar(blob, cacheDir)
+	if err == nil {
+		// The digest covers the whole blob, including any padding after the tarball.
+		_, err = io.Copy(ioutil.Discard, blob)
+	}
+	// A truncated blob fails to unpack, so check the limit first.
+	if limited.N == 0 {
+		return fmt.Errorf("blob %v exceeds the limit of %v bytes", layer.Digest, limit)
+	}
+	if err != nil {
+		return err
+	}
+	if actual := "sha256:" + hex.EncodeToString(digest.Sum(nil)); actual != layer.Digest {
+		return fmt.Errorf("digest mismatch: expected %v; got %v", layer.Digest, actual)
+	}
+	return nil
+}
+
+// registryCredentials returns the username and password for registry found in a
+// kubernetes.io/dockerconfigjson or kubernetes.io/dockercfg pull secret.
+func registryCredentials(secret *v1.Secret, registry string) (string, string, error) {
+	type authEntry struct {
+		Username string `json:"username,omitempty"`
+		Password string `json:"password,omitempty"`
+		Auth     string `json:"auth,omitempty"`
+	}
+	auths := map[string]authEntry{}
+	if data, ok := secret.Data[v1.DockerConfigJsonKey]; ok {
+		config := struct {
+			Auths map[string]authEntry `json:"auths"`
+		}{}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return "", "", fmt.Errorf("could not decode %v of secret %v: %v", v1.DockerConfigJsonKey, secret.Name, err)
+		}
+		auths = config.Auths
+	} else if data, ok := secret.Data[v1.DockerConfigKey]; ok {
+		if err := json.Unmarshal(data, &auths); err != nil {
+			return "", "", fmt.Errorf("could not decode %v of secret %v: %v", v1.DockerConfigKey, secret.Name, err)
+		}
+	} else {
+		return "", "", fmt.Errorf("secret %v has neither a %v nor a %v key", secret.Name, v1.DockerConfigJsonKey, v1.DockerConfigKey)
+	}
+
+	for key, entry := range auths {
+		if registryHost(key) != registryHost(registry) {
+			continue
+		}
+		if entry.Auth == "" {
+			return entry.Username, entry.Password, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return "", "", fmt.Errorf("could not decode the auth of registry %v in secret %v: %v", key, secret.Name, err)
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return "", "", fmt.Errorf("the auth of registry %v in secret %v is not of the form username:password", key, secret.Name)
+		}
+		return parts[0], parts[1], nil
+	}
+	return "", "", fmt.Errorf("secret %v has no credentials for registry %v", secret.Name, registry)
+}
+
+// registryHost normalizes a docker config key such as https://index.docker.io/v1/ to a registry host.
+func registryHost(key string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	host = strings.SplitN(host, "/", 2)[0]
+	switch host {
+	case "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return host
+}
+
+// newOCIClient returns the client pulling r.URI with the credentials of its PullSecret.
+func (c *KfConfig) newOCIClient(r Repo) (*ociClient, error) {
+	ref, err := parseOCIReference(r.URI)
+	if err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: err.Error(),
+		}
+	}
+	o := &ociClient{
+		client: &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}},
+		ref:    ref,
+	}
+	if r.PullSecret != "" {
+		secret, err := c.getSecret(r.PullSecret)
+		if err != nil {
+			return nil, &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("couldn't get pull secret %v of repo %v: %v", r.PullSecret, r.Name, err),
+			}
+		}
+		if o.username, o.password, err = registryCredentials(secret, ref.Registry); err != nil {
+			return nil, &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: err.Error(),
+			}
+		}
+	}
+	return o, nil
+}
+
+// fetchOCI pulls the manifests bundle stored as the OCI artifact r.URI and unpacks its
+// tar+gzip layers, in order, into cacheDir. It returns the digest of the manifest.
+func (c *KfConfig) fetchOCI(r Repo, cacheDir string) (string, error) {
+	o, err := c.newOCIClient(r)
+	if err != nil {
+		return "", err
+	}
+
+	manifest, err := o.manifest()
+	if err != nil {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't download URI %v: %v", r.URI, err),
+		}
+	}
+	unpacked := 0
+	for _, layer := range manifest.Layers {
+		if !ociLayerMediaTypes[layer.MediaType] {
+			log.Infof("Skipping layer %v of %v with media type %v", layer.Digest, r.URI, layer.MediaType)
+			continue
+		}
+		if err := o.unpackLayer(layer, cacheDir); err != nil {
+			// Don't leave the content of an unverified layer behind.
+			if err := os.RemoveAll(cacheDir); err != nil {
+				log.Warnf("Could not clean up %v: %v", cacheDir, err)
+			}
+			return "", &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("couldn't unpack layer %v of %v: %v", layer.Digest, r.URI, err),
+			}
+		}
+		unpacked++
+	}
+	if unpacked == 0 {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("%v has no tar+gzip layer", r.URI),
+		}
+	}
+	return manifest.digest, nil
+}
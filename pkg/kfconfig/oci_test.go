@@ -0,0 +1,326 @@
+package kfconfig
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseOCIReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	type testCase struct {
+		URI      string
+		Expected *ociReference
+		Error    bool
+	}
+	testCases := []testCase{
+		{
+			URI:      "oci://quay.io/opendatahub/manifests:v1.0",
+			Expected: &ociReference{Registry: "quay.io", Repository: "opendatahub/manifests", Tag: "v1.0"},
+		},
+		{
+			URI:      "oci://localhost:5000/manifests:v1.0@" + digest,
+			Expected: &ociReference{Registry: "localhost:5000", Repository: "manifests", Tag: "v1.0", Digest: digest},
+		},
+		{
+			URI:      "oci://localhost:5000/manifests@" + digest,
+			Expected: &ociReference{Registry: "localhost:5000", Repository: "manifests", Digest: digest},
+		},
+		{
+			URI:      "oci://quay.io/opendatahub/manifests",
+			Expected: &ociReference{Registry: "quay.io", Repository: "opendatahub/manifests", Tag: "latest"},
+		},
+		{
+			URI:   "oci://quay.io/manifests@md5:abc",
+			Error: true,
+		},
+		{
+			URI:   "oci://quay.io",
+			Error: true,
+		},
+	}
+	for _, c := range testCases {
+		ref, err := parseOCIReference(c.URI)
+		if c.Error {
+			if err == nil {
+				t.Errorf("Case %v: expected an error", c.URI)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Case %v: failed to parse: %v", c.URI, err)
+		}
+		if diff := cmp.Diff(c.Expected, ref); diff != "" {
+			t.Errorf("Case %v: unexpected reference (-want, +got):\n%s", c.URI, diff)
+		}
+	}
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// newTestRegistry starts a registry serving the manifests bundle files as the single layer
+// of manifests:v1 behind a bearer token obtained with the credentials user:secret.
+func newTestRegistry(t *testing.T, files map[string]string) (*httptest.Server, string) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	dirs := map[string]bool{}
+	for name, content := range files {
+		if dir := path.Dir(name); dir != "." && !dirs[dir] {
+			dirs[dir] = true
+			if err := tw.WriteHeader(&tar.Header{Name: dir + "/", Mode: 0755, Typeflag: tar.TypeDir}); err != nil {
+				t.Fatalf("Failed to write tar header: %v", err)
+			}
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("Failed to write tar content: %v", err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	layer := buf.Bytes()
+
+	manifest, err := json.Marshal(&ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaTypes[0],
+		Layers: []ociDescriptor{
+			{MediaType: "application/vnd.oci.image.config.v1+json", Digest: sha256Digest([]byte("{}")), Size: 2},
+			{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: sha256Digest(layer), Size: int64(len(layer))},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal manifest: %v", err)
+	}
+	manifestDigest := sha256Digest(manifest)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"token": "pull-token"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer pull-token" {
+			w.Header().Set("WWW-Authenticate",
+				fmt.Sprintf(`Bearer realm="%v/token",service="test",scope="repository:manifests:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v2/manifests/manifests/"):
+			// Serve the manifest for any reference so that digest verification is exercised.
+			w.Header().Set("Content-Type", ociManifestMediaTypes[0])
+			w.Write(manifest)
+		case r.URL.Path == "/v2/manifests/blobs/"+sha256Digest(layer):
+			w.Write(layer)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server, manifestDigest
+}
+
+func TestSyncCacheOCI(t *testing.T) {
+	server, manifestDigest := newTestRegistry(t, map[string]string{
+		"kfdef/kustomization.yaml": "resources: []\n",
+	})
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	dockerConfig := fmt.Sprintf(`{"auths": {"%v": {"username": "user", "password": "secret"}}}`, registry)
+	kubeClient := fake.NewSimpleClientset(
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "pull-secret", Namespace: "opendatahub"},
+			Type:       v1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{v1.DockerConfigJsonKey: []byte(dockerConfig)},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "wrong-secret", Namespace: "opendatahub"},
+			Type:       v1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{v1.DockerConfigJsonKey: []byte(
+				fmt.Sprintf(`{"auths": {"%v": {"auth": "dXNlcjp3cm9uZw=="}}}`, registry))},
+		},
+	)
+	defer func(f func() (kubernetes.Interface, error)) { newKubeClient = f }(newKubeClient)
+	newKubeClient = func() (kubernetes.Interface, error) {
+		return kubeClient, nil
+	}
+
+	type testCase struct {
+		Name  string
+		Repo  Repo
+		Error string
+	}
+	testCases := []testCase{
+		{
+			Name: "tag",
+			Repo: Repo{URI: "oci://" + registry + "/manifests:v1", PullSecret: "pull-secret"},
+		},
+		{
+			Name: "digest",
+			Repo: Repo{URI: "oci://" + registry + "/manifests:v1@" + manifestDigest, PullSecret: "pull-secret"},
+		},
+		{
+			Name:  "digest-mismatch",
+			Repo:  Repo{URI: "oci://" + registry + "/manifests:v1@sha256:" + strings.Repeat("0", 64), PullSecret: "pull-secret"},
+			Error: "digest mismatch",
+		},
+		{
+			Name:  "wrong-credentials",
+			Repo:  Repo{URI: "oci://" + registry + "/manifests:v1", PullSecret: "wrong-secret"},
+			Error: "could not get a token",
+		},
+		{
+			Name:  "no-pull-secret",
+			Repo:  Repo{URI: "oci://" + registry + "/manifests:v1"},
+			Error: "could not get a token",
+		},
+	}
+
+	for _, c := range testCases {
+		appDir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(appDir)
+
+		c.Repo.Name = "manifests"
+		kfDef := &KfConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "opendatahub", Namespace: "opendatahub"},
+			Spec: KfConfigSpec{
+				AppDir: appDir,
+				Repos:  []Repo{c.Repo},
+			},
+		}
+		err = kfDef.SyncCache()
+		if c.Error != "" {
+			if err == nil || !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("Case %v: expected error containing %v; got %v", c.Name, c.Error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Case %v: failed to sync cache: %v", c.Name, err)
+		}
+		expected := []Cache{{Name: "manifests", LocalPath: path.Join(appDir, DefaultCacheDir, "manifests"), Revision: manifestDigest}}
+		if diff := cmp.Diff(expected, kfDef.Status.Caches); diff != "" {
+			t.Errorf("Case %v: unexpected caches (-want, +got):\n%s", c.Name, diff)
+		}
+		data, err := ioutil.ReadFile(path.Join(appDir, DefaultCacheDir, "manifests", "kfdef", "kustomization.yaml"))
+		if err != nil {
+			t.Errorf("Case %v: failed to read unpacked file: %v", c.Name, err)
+		} else if string(data) != "resources: []\n" {
+			t.Errorf("Case %v: unexpected unpacked content %q", c.Name, string(data))
+		}
+	}
+}
+
+func TestFetchOCIVerifiesLayers(t *testing.T) {
+	layer := newArchive(t, []archiveEntry{{Name: "kustomization.yaml", Type: tar.TypeReg, Content: "resources: []\n"}})
+	tampered := newArchive(t, []archiveEntry{{Name: "kustomization.yaml", Type: tar.TypeReg, Content: "resources: [evil.yaml]\n"}})
+
+	type testCase struct {
+		Name         string
+		Layer        ociDescriptor
+		Blob         []byte
+		ManifestSize int64
+		Error        string
+	}
+	testCases := []testCase{
+		{
+			Name:  "verified",
+			Layer: ociDescriptor{Digest: sha256Digest(layer), Size: int64(len(layer))},
+			Blob:  layer,
+		},
+		{
+			Name:  "tampered-layer",
+			Layer: ociDescriptor{Digest: sha256Digest(layer), Size: int64(len(tampered))},
+			Blob:  tampered,
+			Error: "digest mismatch",
+		},
+		{
+			Name:  "layer-larger-than-its-size",
+			Layer: ociDescriptor{Digest: sha256Digest(layer), Size: 16},
+			Blob:  layer,
+			Error: "exceeds the limit of 16 bytes",
+		},
+		{
+			Name:         "manifest-too-large",
+			Layer:        ociDescriptor{Digest: sha256Digest(layer), Size: int64(len(layer))},
+			Blob:         layer,
+			ManifestSize: 64,
+			Error:        "exceeds the limit of 64 bytes",
+		},
+	}
+
+	for _, c := range testCases {
+		c.Layer.MediaType = "application/vnd.oci.image.layer.v1.tar+gzip"
+		manifest, err := json.Marshal(&ociManifest{SchemaVersion: 2, Layers: []ociDescriptor{c.Layer}})
+		if err != nil {
+			t.Fatalf("Failed to marshal manifest: %v", err)
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v2/manifests/manifests/v1":
+				w.Write(manifest)
+			case "/v2/manifests/blobs/" + c.Layer.Digest:
+				w.Write(c.Blob)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+		if c.ManifestSize != 0 {
+			maxOCIManifestSize, c.ManifestSize = c.ManifestSize, maxOCIManifestSize
+		}
+
+		cacheDir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(cacheDir)
+		kfDef := &KfConfig{}
+		_, err = kfDef.fetchOCI(Repo{Name: "manifests", URI: "oci://" + strings.TrimPrefix(server.URL, "http://") + "/manifests:v1"}, cacheDir)
+		if c.ManifestSize != 0 {
+			maxOCIManifestSize = c.ManifestSize
+		}
+		if c.Error == "" {
+			if err != nil {
+				t.Errorf("Case %v: failed to fetch: %v", c.Name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.Error) {
+			t.Errorf("Case %v: expected error containing %v; got %v", c.Name, c.Error, err)
+		}
+		if _, err := os.Stat(path.Join(cacheDir, "kustomization.yaml")); !os.IsNotExist(err) {
+			t.Errorf("Case %v: expected the unverified layer to be removed; got %v", c.Name, err)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package kfconfig
+
+// GetOutput returns the value of the output name of the application app, if it was read.
+func (c *KfConfig) GetOutput(app string, name string) (string, bool) {
+	for _, outputs := range c.Status.Outputs {
+		if outputs.Name != app {
+			continue
+		}
+		for _, nv := range outputs.Values {
+			if nv.Name == name {
+				return nv.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// SetOutputs records the values of the outputs of the application app, replacing those read before.
+func (c *KfConfig) SetOutputs(app string, values []NameValue) {
+	for i := range c.Status.Outputs {
+		if c.Status.Outputs[i].Name == app {
+			c.Status.Outputs[i].Values = values
+			return
+		}
+	}
+	c.Status.Outputs = append(c.Status.Outputs, ApplicationOutputs{Name: app, Values: values})
+}
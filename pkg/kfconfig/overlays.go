@@ -0,0 +1,115 @@
+package kfconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	kfapis "github.com/opendatahub-io/opendatahub-operator/apis"
+)
+
+// versionConstraint matches the constraints of ConditionalOverlay.WhenClusterVersion.
+var versionConstraint = regexp.MustCompile(`^\s*(>=|<=|==|>|<)?\s*(\S+)\s*$`)
+
+// SelectOverlays returns the overlays of the application: its Overlays, then those of its
+// ConditionalOverlays whose conditions match facts.
+func (k *KustomizeConfig) SelectOverlays(facts *ClusterFacts) ([]string, error) {
+	overlays := append([]string{}, k.Overlays...)
+	for _, o := range k.ConditionalOverlays {
+		matches, err := o.Matches(facts)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			overlays = append(overlays, o.Name)
+		}
+	}
+	return overlays, nil
+}
+
+// Matches returns true if the cluster described by facts matches all the conditions of o.
+func (o *ConditionalOverlay) Matches(facts *ClusterFacts) (bool, error) {
+	if o.WhenAPIGroupPresent != "" && !facts.HasAPIGroup(o.WhenAPIGroupPresent) {
+		return false, nil
+	}
+	if o.WhenPlatform != "" && !strings.EqualFold(o.WhenPlatform, facts.Platform) {
+		return false, nil
+	}
+	if o.WhenClusterVersion != "" {
+		m := versionConstraint.FindStringSubmatch(o.WhenClusterVersion)
+		var want []int
+		var err error
+		if m != nil {
+			want, err = parseVersion(m[2])
+		}
+		if m == nil || err != nil {
+			return false, &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("overlay %v has an invalid whenClusterVersion %q", o.Name, o.WhenClusterVersion),
+			}
+		}
+		have, err := parseVersion(facts.Version)
+		if err != nil {
+			return false, &kfapis.KfError{
+				Code:    int(kfapis.INTERNAL_ERROR),
+				Message: fmt.Sprintf("couldn't compare the version %q of the cluster: %v", facts.Version, err),
+			}
+		}
+		cmp := compareVersions(have, want)
+		matches := cmp >= 0
+		switch m[1] {
+		case ">":
+			matches = cmp > 0
+		case "<":
+			matches = cmp < 0
+		case "<=":
+			matches = cmp <= 0
+		case "==":
+			matches = cmp == 0
+		}
+		if !matches {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// parseVersion returns the numbers of a version such as v1.23.3+k3s1 or 4.10.3, ignoring its
+// pre-release and build suffixes.
+func parseVersion(version string) ([]int, error) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	var numbers []int
+	for _, part := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", version)
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, nil
+}
+
+// compareVersions returns -1, 0 or 1 if a is lower, equal or greater than b. Missing numbers
+// are 0, e.g. 4.10 equals 4.10.0.
+func compareVersions(a []int, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,94 @@
+package kfconfig
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelectOverlays(t *testing.T) {
+	openShift := &ClusterFacts{
+		Platform:          PlatformOpenShift,
+		Version:           "4.10.3",
+		KubernetesVersion: "v1.23.3+e419edf",
+		APIGroups:         []string{"apps", "monitoring.coreos.com", "route.openshift.io"},
+	}
+	kubernetes := &ClusterFacts{
+		Platform:          PlatformKubernetes,
+		Version:           "v1.21.2+k3s1",
+		KubernetesVersion: "v1.21.2+k3s1",
+		APIGroups:         []string{"apps", "networking.k8s.io"},
+	}
+
+	type testCase struct {
+		Name       string
+		Facts      *ClusterFacts
+		Constraint string
+		Expected   []string
+		Error      string
+	}
+	config := &KustomizeConfig{
+		Overlays: []string{"odh"},
+		ConditionalOverlays: []ConditionalOverlay{
+			{Name: "monitoring", WhenAPIGroupPresent: "monitoring.coreos.com"},
+			{Name: "route", WhenPlatform: "openshift"},
+			{Name: "ingress", WhenPlatform: PlatformKubernetes},
+			{Name: "gateway-api", WhenClusterVersion: ">=4.11"},
+			{Name: "legacy", WhenClusterVersion: "<1.22"},
+			{Name: "openshift-4.10.3", WhenPlatform: PlatformOpenShift, WhenClusterVersion: "== 4.10.3"},
+		},
+	}
+	testCases := []testCase{
+		{Name: "openshift", Facts: openShift, Expected: []string{"odh", "monitoring", "route", "openshift-4.10.3"}},
+		{Name: "kubernetes", Facts: kubernetes, Expected: []string{"odh", "ingress", "legacy"}},
+	}
+	for _, c := range testCases {
+		overlays, err := config.SelectOverlays(c.Facts)
+		if err != nil {
+			t.Errorf("Case %v: failed to select the overlays: %v", c.Name, err)
+		} else if !reflect.DeepEqual(overlays, c.Expected) {
+			t.Errorf("Case %v: expected overlays %v; got %v", c.Name, c.Expected, overlays)
+		}
+	}
+	if !reflect.DeepEqual(config.Overlays, []string{"odh"}) {
+		t.Errorf("Expected SelectOverlays to leave the overlays unchanged; got %v", config.Overlays)
+	}
+
+	invalidCases := []testCase{
+		{Name: "invalid-constraint", Facts: openShift, Constraint: "~> 4", Error: `overlay broken has an invalid whenClusterVersion "~> 4"`},
+		{Name: "invalid-cluster-version", Facts: &ClusterFacts{Version: "unknown"}, Constraint: "4.10", Error: `couldn't compare the version "unknown" of the cluster`},
+	}
+	for _, c := range invalidCases {
+		broken := &KustomizeConfig{ConditionalOverlays: []ConditionalOverlay{{Name: "broken", WhenClusterVersion: c.Constraint}}}
+		if _, err := broken.SelectOverlays(c.Facts); err == nil || !strings.Contains(err.Error(), c.Error) {
+			t.Errorf("Case %v: expected an error containing %q; got %v", c.Name, c.Error, err)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	type testCase struct {
+		A        string
+		B        string
+		Expected int
+	}
+	testCases := []testCase{
+		{A: "4.10", B: "4.10.0", Expected: 0},
+		{A: "v1.23.3+e419edf", B: "1.23.3", Expected: 0},
+		{A: "4.10.3", B: "4.9", Expected: 1},
+		{A: "4.9.0-rc.1", B: "4.10", Expected: -1},
+	}
+	for _, c := range testCases {
+		a, err := parseVersion(c.A)
+		if err != nil {
+			t.Fatalf("Failed to parse %v: %v", c.A, err)
+		}
+		b, err := parseVersion(c.B)
+		if err != nil {
+			t.Fatalf("Failed to parse %v: %v", c.B, err)
+		}
+		if cmp := compareVersions(a, b); cmp != c.Expected {
+			t.Errorf("Case %v vs %v: expected %v; got %v", c.A, c.B, c.Expected, cmp)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package kfconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	kfapis "github.com/opendatahub-io/opendatahub-operator/apis"
+)
+
+const (
+	// ParamSchemaFile declares the params of the params.env next to it.
+	ParamSchemaFile = "params.schema.yaml"
+
+	// Types of params.
+	ParamTypeString  = "string"
+	ParamTypeInteger = "integer"
+	ParamTypeNumber  = "number"
+	ParamTypeBoolean = "boolean"
+
+	invalidParamsMessage = "invalid parameters"
+)
+
+// ParamSchema declares the params of an application, e.g.
+//
+//	params:
+//	- name: replicas
+//	  type: integer
+//	  default: "1"
+//	  description: The number of replicas of the dashboard.
+//	- name: logLevel
+//	  enum: [debug, info, warning]
+type ParamSchema struct {
+	Params []ParamDeclaration `json:"params,omitempty"`
+}
+
+type ParamDeclaration struct {
+	Name string `json:"name"`
+	// Type is string, the default, integer, number or boolean.
+	Type string `json:"type,omitempty"`
+	// Default is the value of the param when neither the KfDef nor params.env set it.
+	Default string `json:"default,omitempty"`
+	// Enum lists the allowed values, if not empty.
+	Enum        []string `json:"enum,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// IsInvalidParamsError returns true if err, or an error it wraps, was caused by params not
+// matching the schema of their application.
+func IsInvalidParamsError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), invalidParamsMessage)
+}
+
+// LoadParamSchema returns the param schema in dir, or nil if dir has none.
+func LoadParamSchema(dir string) (*ParamSchema, error) {
+	schemaFile := filepath.Join(dir, ParamSchemaFile)
+	data, err := ioutil.ReadFile(schemaFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("couldn't read %v: %v", schemaFile, err),
+		}
+	}
+	schema := &ParamSchema{}
+	if err := yaml.Unmarshal(data, schema); err != nil {
+		return nil, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("invalid param schema %v: %v", schemaFile, err),
+		}
+	}
+	for _, p := range schema.Params {
+		switch p.Type {
+		case "", ParamTypeString, ParamTypeInteger, ParamTypeNumber, ParamTypeBoolean:
+		default:
+			return nil, &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("invalid param schema %v: param %v has unknown type %v", schemaFile, p.Name, p.Type),
+			}
+		}
+	}
+	return schema, nil
+}
+
+// Merge adds the declarations of other to s, replacing those with the same name.
+func (s *ParamSchema) Merge(other *ParamSchema) {
+	for _, p := range other.Params {
+		if d := s.Declaration(p.Name); d != nil {
+			*d = p
+		} else {
+			s.Params = append(s.Params, p)
+		}
+	}
+}
+
+// Declaration returns the declaration of the param name, or nil if s doesn't declare it.
+func (s *ParamSchema) Declaration(name string) *ParamDeclaration {
+	for i := range s.Params {
+		if s.Params[i].Name == name {
+			return &s.Params[i]
+		}
+	}
+	return nil
+}
+
+// Validate checks that params are declared by s and their values match their declaration.
+// Values with expressions, e.g. ${kfdef.namespace}, are only checked once evaluated.
+func (s *ParamSchema) Validate(app string, params []NameValue) error {
+	var problems []string
+	for _, nv := range params {
+		d := s.Declaration(nv.Name)
+		if d == nil {
+			problem := fmt.Sprintf("unknown param %v", nv.Name)
+			if suggestion := s.closestParam(nv.Name); suggestion != "" {
+				problem += fmt.Sprintf(" (did you mean %v?)", suggestion)
+			}
+			problems = append(problems, problem)
+		} else if !strings.Contains(nv.Value, "${") {
+			if err := d.check(nv.Value); err != nil {
+				problems = append(problems, fmt.Sprintf("param %v: %v", nv.Name, err))
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return &kfapis.KfError{
+		Code:    int(kfapis.INVALID_ARGUMENT),
+		Message: fmt.Sprintf("application %v has %v: %v", app, invalidParamsMessage, strings.Join(problems, "; ")),
+	}
+}
+
+// check returns an error if value doesn't match the type or the enum of d.
+func (d *ParamDeclaration) check(value string) error {
+	var err error
+	switch d.Type {
+	case ParamTypeInteger:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case ParamTypeNumber:
+		_, err = strconv.ParseFloat(value, 64)
+	case ParamTypeBoolean:
+		_, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%q is not a valid %v", value, d.Type)
+	}
+	if len(d.Enum) > 0 {
+		for _, allowed := range d.Enum {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %v", value, strings.Join(d.Enum, ", "))
+	}
+	return nil
+}
+
+// closestParam returns the declared param name closest to name, if it's a likely typo.
+func (s *ParamSchema) closestParam(name string) string {
+	var names []string
+	for _, p := range s.Params {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	closest, best := "", 3
+	for _, n := range names {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(n)); d < best {
+			closest, best = n, d
+		}
+	}
+	return closest
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,108 @@
+package kfconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestParamSchema(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+	schemaYaml := `
+params:
+- name: replicas
+  type: integer
+  default: "1"
+  description: The number of replicas.
+- name: ratio
+  type: number
+- name: debug
+  type: boolean
+- name: logLevel
+  enum: [debug, info]
+- name: image
+`
+	if err := ioutil.WriteFile(path.Join(testDir, ParamSchemaFile), []byte(schemaYaml), 0644); err != nil {
+		t.Fatalf("Failed to write the schema: %v", err)
+	}
+	schema, err := LoadParamSchema(testDir)
+	if err != nil {
+		t.Fatalf("Failed to load the schema: %v", err)
+	}
+	if d := schema.Declaration("replicas"); d == nil || d.Default != "1" || d.Description != "The number of replicas." {
+		t.Errorf("Expected replicas to be declared with its default and description; got %+v", d)
+	}
+
+	type testCase struct {
+		Name   string
+		Params []NameValue
+		Error  string
+	}
+	testCases := []testCase{
+		{
+			Name: "valid",
+			Params: []NameValue{
+				{Name: "replicas", Value: "3"},
+				{Name: "ratio", Value: "0.5"},
+				{Name: "debug", Value: "true"},
+				{Name: "logLevel", Value: "info"},
+				{Name: "image", Value: "quay.io/odh/dashboard:v1"},
+			},
+		},
+		{
+			Name:   "expression",
+			Params: []NameValue{{Name: "replicas", Value: "${app:other.replicas}"}},
+		},
+		{
+			Name:   "typo",
+			Params: []NameValue{{Name: "replica", Value: "3"}},
+			Error:  "application dashboard has invalid parameters: unknown param replica (did you mean replicas?)",
+		},
+		{
+			Name:   "unknown",
+			Params: []NameValue{{Name: "storageSize", Value: "3"}},
+			Error:  "unknown param storageSize",
+		},
+		{
+			Name:   "invalid-integer",
+			Params: []NameValue{{Name: "replicas", Value: "three"}},
+			Error:  `param replicas: "three" is not a valid integer`,
+		},
+		{
+			Name:   "invalid-boolean",
+			Params: []NameValue{{Name: "debug", Value: "yes"}},
+			Error:  `param debug: "yes" is not a valid boolean`,
+		},
+		{
+			Name:   "invalid-enum",
+			Params: []NameValue{{Name: "logLevel", Value: "trace"}, {Name: "ratio", Value: "half"}},
+			Error:  `param logLevel: "trace" is not one of debug, info; param ratio: "half" is not a valid number`,
+		},
+	}
+	for _, c := range testCases {
+		err := schema.Validate("dashboard", c.Params)
+		if c.Error == "" {
+			if err != nil {
+				t.Errorf("Case %v: expected the params to be valid; got %v", c.Name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.Error) || !IsInvalidParamsError(err) {
+			t.Errorf("Case %v: expected an error containing %q; got %v", c.Name, c.Error, err)
+		}
+	}
+
+	if schema, err := LoadParamSchema(path.Join(testDir, "missing")); schema != nil || err != nil {
+		t.Errorf("Expected no schema in a directory without one; got %v, %v", schema, err)
+	}
+	if err := ioutil.WriteFile(path.Join(testDir, ParamSchemaFile), []byte("params:\n- name: replicas\n  type: int\n"), 0644); err != nil {
+		t.Fatalf("Failed to write the schema: %v", err)
+	}
+	if _, err := LoadParamSchema(testDir); err == nil || !strings.Contains(err.Error(), "param replicas has unknown type int") {
+		t.Errorf("Expected an error for an unknown type; got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package kfconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	kfapis "github.com/opendatahub-io/opendatahub-operator/apis"
+	"github.com/otiai10/copy"
+)
+
+const (
+	// PVCScheme is the URI scheme of repos read from a PersistentVolumeClaim mounted into the
+	// operator, e.g. pvc://opendatahub/odh-manifests/odh-manifests.tar.gz. The path is either a
+	// directory of manifests or a gzipped tarball and defaults to the root of the volume.
+	PVCScheme = "pvc"
+)
+
+// pvcMountDir is the directory under which claims are mounted into the operator: the claim
+// of pvc://<namespace>/<claim>/<path> is expected at <pvcMountDir>/<namespace>/<claim>.
+// It is a variable so that tests can substitute a temporary directory.
+var pvcMountDir = "/opt/repos"
+
+// fetchPVC copies, or unpacks when it is an archive, the path of the pvc:// URI r.URI into
+// cacheDir. It returns true if the path was an archive.
+func (c *KfConfig) fetchPVC(r Repo, cacheDir string) (bool, error) {
+	elements, err := splitRepoURI(r.URI, PVCScheme, 3, true)
+	if err != nil {
+		return false, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: err.Error(),
+		}
+	}
+	namespace, claim, subPath := elements[0], elements[1], elements[2]
+	if _, err := archiveEntryPath(subPath); err != nil {
+		return false, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("invalid path %v in %v: %v", subPath, r.URI, err),
+		}
+	}
+	mountPath := filepath.Join(pvcMountDir, namespace, claim)
+	if _, err := os.Stat(mountPath); err != nil {
+		return false, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("claim %v/%v of repo %v is not mounted at %v: %v", namespace, claim, r.Name, mountPath, err),
+		}
+	}
+	source := filepath.Join(mountPath, filepath.FromSlash(subPath))
+	fi, err := os.Stat(source)
+	if err != nil {
+		return false, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't stat %v of repo %v: %v", source, r.Name, err),
+		}
+	}
+	if fi.IsDir() {
+		if err := checkVerifiable(r); err != nil {
+			return false, err
+		}
+		if err := copy.Copy(source, cacheDir); err != nil {
+			return false, &kfapis.KfError{
+				Code:    int(kfapis.INTERNAL_ERROR),
+				Message: fmt.Sprintf("couldn't copy %v: %v", source, err),
+			}
+		}
+		return false, nil
+	}
+
+	f, err := os.Open(source)
+	if err != nil {
+		return false, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't open %v of repo %v: %v", source, r.Name, err),
+		}
+	}
+	defer f.Close()
+	if r.SHA256 != "" || r.Signature != nil {
+		hclient, err := c.newArchiveClient(r)
+		if err != nil {
+			return false, err
+		}
+		if err := c.verifyArchive(r, f, hclient); err != nil {
+			return false, err
+		}
+	}
+	if err := untar(f, cacheDir); err != nil {
+		return false, &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't unpack %v: %v", r.URI, err),
+		}
+	}
+	return true, nil
+}
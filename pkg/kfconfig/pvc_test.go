@@ -0,0 +1,99 @@
+package kfconfig
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSyncCachePVC(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	defer func(dir string) { pvcMountDir = dir }(pvcMountDir)
+	pvcMountDir = path.Join(testDir, "mnt")
+	claimDir := path.Join(pvcMountDir, "opendatahub", "manifests")
+	if err := os.MkdirAll(path.Join(claimDir, "odh-manifests", "base"), os.ModePerm); err != nil {
+		t.Fatalf("Failed to create claim dir: %v", err)
+	}
+	ioutil.WriteFile(path.Join(claimDir, "odh-manifests", "base", "kustomization.yaml"), []byte("resources: []\n"), 0644)
+	archive := newArchive(t, []archiveEntry{
+		{Name: "odh-manifests/", Type: tar.TypeDir},
+		{Name: "odh-manifests/version", Type: tar.TypeReg, Content: "v1"},
+	})
+	ioutil.WriteFile(path.Join(claimDir, "odh-manifests.tar.gz"), archive, 0644)
+
+	type testCase struct {
+		Name     string
+		URI      string
+		Expected string
+		Error    string
+	}
+	testCases := []testCase{
+		{
+			Name:     "directory",
+			URI:      "pvc://opendatahub/manifests/odh-manifests",
+			Expected: "base/kustomization.yaml",
+		},
+		{
+			Name:     "root",
+			URI:      "pvc://opendatahub/manifests",
+			Expected: "odh-manifests/base/kustomization.yaml",
+		},
+		{
+			Name:     "archive",
+			URI:      "pvc://opendatahub/manifests/odh-manifests.tar.gz",
+			Expected: "version",
+		},
+		{
+			Name:  "not-mounted",
+			URI:   "pvc://opendatahub/other/odh-manifests",
+			Error: "claim opendatahub/other of repo manifests is not mounted",
+		},
+		{
+			Name:  "missing-path",
+			URI:   "pvc://opendatahub/manifests/missing",
+			Error: "couldn't stat",
+		},
+		{
+			Name:  "parent-path",
+			URI:   "pvc://opendatahub/manifests/../../etc",
+			Error: "path contains ..",
+		},
+	}
+	for _, c := range testCases {
+		kfDef := &KfConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "opendatahub", Namespace: "opendatahub"},
+			Spec: KfConfigSpec{
+				AppDir: path.Join(testDir, c.Name),
+				Repos:  []Repo{{Name: "manifests", URI: c.URI}},
+			},
+		}
+		err := kfDef.SyncCache()
+		if c.Error != "" {
+			if err == nil || !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("Case %v: expected error containing %v; got %v", c.Name, c.Error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case %v: failed to sync cache: %v", c.Name, err)
+			continue
+		}
+		if len(kfDef.Status.Caches) != 1 {
+			t.Errorf("Case %v: expected 1 cache; got %v", c.Name, kfDef.Status.Caches)
+			continue
+		}
+		if _, err := os.Stat(path.Join(kfDef.Status.Caches[0].LocalPath, c.Expected)); err != nil {
+			t.Errorf("Case %v: expected %v in the cache: %v", c.Name, c.Expected, err)
+		}
+	}
+}
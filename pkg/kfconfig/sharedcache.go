@@ -0,0 +1,483 @@
+package kfconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	kfapis "github.com/opendatahub-io/opendatahub-operator/apis"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	sharedCacheIndexFile   = "index.json"
+	sharedCacheObjectsDir  = "objects"
+	sharedCacheSourcesDir  = "sources"
+	sharedCacheHit         = "hit"
+	sharedCacheMiss        = "miss"
+	sharedCacheMetricsName = "kfdef_repo_cache"
+)
+
+var (
+	sharedCacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: sharedCacheMetricsName + "_size_bytes",
+		Help: "Size of the content held by the shared repo cache.",
+	})
+	sharedCacheEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: sharedCacheMetricsName + "_entries",
+		Help: "Number of repo revisions held by the shared repo cache.",
+	})
+	sharedCacheReferences = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: sharedCacheMetricsName + "_references",
+		Help: "Number of references from KfDefs to entries of the shared repo cache.",
+	})
+	sharedCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: sharedCacheMetricsName + "_requests_total",
+		Help: "Lookups of repo revisions in the shared repo cache by result, hit or miss.",
+	}, []string{"result"})
+	sharedCacheEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: sharedCacheMetricsName + "_evictions_total",
+		Help: "Entries removed from the shared repo cache by garbage collection.",
+	})
+)
+
+// sharedCache is the operator wide repo cache used by SyncCache once EnableSharedCache is
+// called; repos are cached in the AppDir of each KfConfig otherwise.
+var sharedCache *repoCache
+
+// SharedCacheMetrics returns the collectors of the shared repo cache metrics.
+func SharedCacheMetrics() []prometheus.Collector {
+	return []prometheus.Collector{sharedCacheSize, sharedCacheEntries, sharedCacheReferences,
+		sharedCacheRequests, sharedCacheEvictions}
+}
+
+// EnableSharedCache makes SyncCache fetch git, oci and archive repos into a cache in dir shared
+// by every KfConfig, e.g. on a PersistentVolumeClaim. Entries are keyed by the URI and the
+// digest of a repo so KfConfigs fetching the same revision share a single copy. Entries no
+// KfConfig refers to are removed, least recently used first, once the cache exceeds maxSize
+// bytes; maxSize 0 disables garbage collection.
+//
+// References are not persisted: they are recorded again as KfConfigs are synced after a
+// restart.
+func EnableSharedCache(dir string, maxSize int64) error {
+	s := &repoCache{
+		dir:     dir,
+		maxSize: maxSize,
+		entries: map[string]*sharedCacheEntry{},
+		refs:    map[string]map[string]bool{},
+		sources: map[string]*sync.Mutex{},
+	}
+	for _, d := range []string{s.objectsDir(), s.sourcesDir()} {
+		if err := os.MkdirAll(d, os.ModePerm); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+	// Garbage is only collected once KfConfigs had a chance to refer to the entries again.
+	s.mu.Lock()
+	s.report()
+	s.mu.Unlock()
+	sharedCache = s
+	log.Infof("Using the shared repo cache %v with %v entries", dir, len(s.entries))
+	return nil
+}
+
+// ReleaseSharedCache drops the references of the KfConfig name in namespace to the shared
+// cache, making its entries eligible for garbage collection.
+func ReleaseSharedCache(namespace string, name string) {
+	if sharedCache == nil {
+		return
+	}
+	sharedCache.setRefs(namespace+"/"+name, nil)
+}
+
+// sharedCacheEntry is a repo revision in the shared cache.
+type sharedCacheEntry struct {
+	Key    string `json:"key"`
+	URI    string `json:"uri"`
+	Digest string `json:"digest"`
+	// Revision is the Cache.Revision of the repo.
+	Revision string    `json:"revision,omitempty"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+type repoCache struct {
+	dir     string
+	maxSize int64
+
+	// mu guards entries and refs.
+	mu      sync.Mutex
+	entries map[string]*sharedCacheEntry
+	// refs maps the namespace/name of each KfConfig to the keys of the entries it uses.
+	refs map[string]map[string]bool
+
+	// sources holds a lock per source dir so that a repo is only fetched once at a time.
+	sourcesMu sync.Mutex
+	sources   map[string]*sync.Mutex
+}
+
+func (s *repoCache) objectsDir() string {
+	return filepath.Join(s.dir, sharedCacheObjectsDir)
+}
+
+func (s *repoCache) sourcesDir() string {
+	return filepath.Join(s.dir, sharedCacheSourcesDir)
+}
+
+// entryKey returns the key of the entry holding the revision digest of uri.
+func entryKey(uri string, digest string) string {
+	sum := sha256.Sum256([]byte(uri + "\n" + digest))
+	return hex.EncodeToString(sum[:])
+}
+
+// sourceKey returns the key of the dir r is fetched into before being added to the cache.
+// Repos which only differ by name share it.
+func sourceKey(r Repo) string {
+	r.Name = ""
+	r.Update = nil
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// pinnedDigest returns the digest r is pinned to, if any, so that it can be found in the cache
+// without being fetched. Signed archives are always fetched to check their signature.
+func pinnedDigest(r Repo, u *url.URL) string {
+	switch {
+	case strings.HasPrefix(r.URI, GitPrefix):
+		if src, err := parseGitURI(r.URI); err == nil && len(src.Ref) == 40 && commitSHA.MatchString(src.Ref) {
+			return src.Ref
+		}
+	case u.Scheme == OCIScheme:
+		if ref, err := parseOCIReference(r.URI); err == nil {
+			return ref.Digest
+		}
+	case r.SHA256 != "" && r.Signature == nil:
+		return "sha256:" + strings.ToLower(strings.TrimPrefix(r.SHA256, "sha256:"))
+	}
+	return ""
+}
+
+// key returns the key of the entry holding localPath, if any.
+func (s *repoCache) key(localPath string) (string, bool) {
+	rel, err := filepath.Rel(s.objectsDir(), localPath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return strings.Split(filepath.ToSlash(rel), "/")[0], true
+}
+
+// fetch returns the dir of the entry holding r, and its revision, fetching r unless the cache
+// already holds the revision it is pinned to. owner refers to the entry from then on.
+func (s *repoCache) fetch(c *KfConfig, owner string, r Repo, u *url.URL) (string, string, error) {
+	if digest := pinnedDigest(r, u); digest != "" {
+		if entry, ok := s.acquire(owner, r.URI, digest); ok {
+			log.Infof("Using the cached revision %v of %v", digest, r.URI)
+			sharedCacheRequests.WithLabelValues(sharedCacheHit).Inc()
+			return filepath.Join(s.objectsDir(), entry.Key), entry.Revision, nil
+		}
+	}
+
+	key := sourceKey(r)
+	lock := s.sourceLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	sourceDir := filepath.Join(s.sourcesDir(), key)
+	for attempt := 0; ; attempt++ {
+		digest, revision, err := s.fetchSource(c, r, u, sourceDir)
+		if err != nil {
+			return "", "", err
+		}
+		if entry, ok := s.acquire(owner, r.URI, digest); ok {
+			log.Infof("Using the cached revision %v of %v", digest, r.URI)
+			sharedCacheRequests.WithLabelValues(sharedCacheHit).Inc()
+			// Keep the dir, and the metadata of archives, to make the next request conditional.
+			if err := os.RemoveAll(sourceDir); err != nil {
+				return "", "", errors.WithStack(err)
+			}
+			return filepath.Join(s.objectsDir(), entry.Key), entry.Revision, os.MkdirAll(sourceDir, os.ModePerm)
+		}
+		files, err := ioutil.ReadDir(sourceDir)
+		if err != nil {
+			return "", "", errors.WithStack(err)
+		}
+		if len(files) > 0 {
+			sharedCacheRequests.WithLabelValues(sharedCacheMiss).Inc()
+			entry, err := s.add(owner, r.URI, digest, revision, sourceDir)
+			if err != nil {
+				return "", "", err
+			}
+			return filepath.Join(s.objectsDir(), entry.Key), entry.Revision, nil
+		}
+		// The archive was not modified but its entry has been removed since; fetch it again.
+		if attempt > 0 {
+			return "", "", &kfapis.KfError{
+				Code:    int(kfapis.INTERNAL_ERROR),
+				Message: fmt.Sprintf("couldn't fetch %v into the shared cache", r.URI),
+			}
+		}
+		if err := os.Remove(archiveMetaFile(sourceDir)); err != nil && !os.IsNotExist(err) {
+			return "", "", errors.WithStack(err)
+		}
+	}
+}
+
+// fetchSource fetches r into sourceDir and returns its digest and revision.
+func (s *repoCache) fetchSource(c *KfConfig, r Repo, u *url.URL, sourceDir string) (string, string, error) {
+	if strings.HasPrefix(r.URI, GitPrefix) {
+		if err := resetCacheDir(sourceDir); err != nil {
+			return "", "", err
+		}
+		revision, err := c.fetchGit(r, sourceDir)
+		return revision, revision, err
+	}
+	if u.Scheme == OCIScheme {
+		if err := resetCacheDir(sourceDir); err != nil {
+			return "", "", err
+		}
+		digest, err := c.fetchOCI(r, sourceDir)
+		return digest, digest, err
+	}
+	if err := os.MkdirAll(sourceDir, os.ModePerm); err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	if err := c.fetchArchive(r, sourceDir); err != nil {
+		return "", "", err
+	}
+	meta := readArchiveMeta(sourceDir)
+	if meta == nil || meta.Digest == "" {
+		return "", "", &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("couldn't read the digest of %v", r.URI),
+		}
+	}
+	return meta.Digest, meta.revision(), nil
+}
+
+func (s *repoCache) sourceLock(key string) *sync.Mutex {
+	s.sourcesMu.Lock()
+	defer s.sourcesMu.Unlock()
+	if _, ok := s.sources[key]; !ok {
+		s.sources[key] = &sync.Mutex{}
+	}
+	return s.sources[key]
+}
+
+// acquire returns the entry of the revision digest of uri, if any, and adds a reference from owner.
+func (s *repoCache) acquire(owner string, uri string, digest string) (*sharedCacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[entryKey(uri, digest)]
+	if !ok {
+		return nil, false
+	}
+	entry.LastUsed = time.Now()
+	s.addRef(owner, entry.Key)
+	s.save()
+	return entry, true
+}
+
+// add moves the content of sourceDir into a new entry for the revision digest of uri,
+// referred to by owner, and collects garbage. sourceDir is left empty.
+func (s *repoCache) add(owner string, uri string, digest string, revision string, sourceDir string) (*sharedCacheEntry, error) {
+	entry := &sharedCacheEntry{
+		Key:      entryKey(uri, digest),
+		URI:      uri,
+		Digest:   digest,
+		Revision: revision,
+		LastUsed: time.Now(),
+	}
+	var err error
+	if entry.Size, err = dirSize(sourceDir); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	entryDir := filepath.Join(s.objectsDir(), entry.Key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.entries[entry.Key]; ok {
+		// Another source with the same URI, e.g. with other credentials, added it meanwhile.
+		entry = existing
+		entry.LastUsed = time.Now()
+		if err := os.RemoveAll(sourceDir); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	} else {
+		// Remove what may be left of an entry which was being added or removed when the operator stopped.
+		if err := os.RemoveAll(entryDir); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := os.Rename(sourceDir, entryDir); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		log.Infof("Added revision %v of %v to the shared cache", digest, uri)
+		s.entries[entry.Key] = entry
+	}
+	if err := os.MkdirAll(sourceDir, os.ModePerm); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	s.addRef(owner, entry.Key)
+	s.gc()
+	return entry, nil
+}
+
+// setRefs replaces the references of owner with the entries holding localPaths.
+func (s *repoCache) setRefs(owner string, localPaths []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.refs, owner)
+	for _, p := range localPaths {
+		if key, ok := s.key(p); ok {
+			if _, ok := s.entries[key]; ok {
+				s.addRef(owner, key)
+			}
+		}
+	}
+	s.gc()
+}
+
+// addRef must be called with mu held.
+func (s *repoCache) addRef(owner string, key string) {
+	if s.refs[owner] == nil {
+		s.refs[owner] = map[string]bool{}
+	}
+	s.refs[owner][key] = true
+}
+
+// gc removes the least recently used entries without references while the cache exceeds its
+// maximum size. It must be called with mu held.
+func (s *repoCache) gc() {
+	referenced := map[string]bool{}
+	for _, keys := range s.refs {
+		for key := range keys {
+			referenced[key] = true
+		}
+	}
+	var size int64
+	var unreferenced []*sharedCacheEntry
+	for key, entry := range s.entries {
+		size += entry.Size
+		if !referenced[key] {
+			unreferenced = append(unreferenced, entry)
+		}
+	}
+	sort.Slice(unreferenced, func(i, j int) bool {
+		return unreferenced[i].LastUsed.Before(unreferenced[j].LastUsed)
+	})
+	for _, entry := range unreferenced {
+		if s.maxSize <= 0 || size <= s.maxSize {
+			break
+		}
+		log.Infof("Removing revision %v of %v from the shared cache", entry.Digest, entry.URI)
+		if err := os.RemoveAll(filepath.Join(s.objectsDir(), entry.Key)); err != nil {
+			log.Errorf("Could not remove the shared cache entry %v; error %v", entry.Key, err)
+			continue
+		}
+		delete(s.entries, entry.Key)
+		size -= entry.Size
+		sharedCacheEvictions.Inc()
+	}
+	if size > s.maxSize && s.maxSize > 0 {
+		log.Warnf("The shared cache holds %v bytes in use, more than its maximum size %v", size, s.maxSize)
+	}
+	s.report()
+}
+
+// report updates the metrics and saves the index. It must be called with mu held.
+func (s *repoCache) report() {
+	var size int64
+	for _, entry := range s.entries {
+		size += entry.Size
+	}
+	references := 0
+	for _, keys := range s.refs {
+		references += len(keys)
+	}
+	sharedCacheSize.Set(float64(size))
+	sharedCacheEntries.Set(float64(len(s.entries)))
+	sharedCacheReferences.Set(float64(references))
+	s.save()
+}
+
+// save writes the index of the entries. It must be called with mu held.
+func (s *repoCache) save() {
+	var entries []*sharedCacheEntry
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	data, err := json.Marshal(entries)
+	if err == nil {
+		tmpFile := filepath.Join(s.dir, "."+sharedCacheIndexFile)
+		if err = ioutil.WriteFile(tmpFile, data, 0644); err == nil {
+			err = os.Rename(tmpFile, filepath.Join(s.dir, sharedCacheIndexFile))
+		}
+	}
+	if err != nil {
+		log.Errorf("Could not save the shared cache index; error %v", err)
+	}
+}
+
+// load reads the index of the entries and removes the entry dirs it doesn't list.
+func (s *repoCache) load() error {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, sharedCacheIndexFile))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	var entries []*sharedCacheEntry
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			log.Warnf("Ignoring the invalid shared cache index; error %v", err)
+			entries = nil
+		}
+	}
+	for _, entry := range entries {
+		if _, err := os.Stat(filepath.Join(s.objectsDir(), entry.Key)); err == nil {
+			s.entries[entry.Key] = entry
+		}
+	}
+	files, err := ioutil.ReadDir(s.objectsDir())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, f := range files {
+		if _, ok := s.entries[f.Name()]; !ok {
+			log.Infof("Removing the unknown shared cache entry %v", f.Name())
+			if err := os.RemoveAll(path.Join(s.objectsDir(), f.Name())); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
+
+// dirSize returns the total size of the regular files below dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,153 @@
+package kfconfig
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSharedCache(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	archives := map[string][]byte{}
+	for _, version := range []string{"v1", "v2"} {
+		archives[version] = newArchive(t, []archiveEntry{
+			{Name: "odh-manifests/", Type: tar.TypeDir},
+			{Name: "odh-manifests/version", Type: tar.TypeReg, Content: version},
+		})
+	}
+	var mu sync.Mutex
+	version := "v1"
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("ETag", `"`+version+`"`)
+		if r.Header.Get("If-None-Match") == `"`+version+`"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Write(archives[version])
+	}))
+	defer server.Close()
+	setVersion := func(v string) {
+		mu.Lock()
+		defer mu.Unlock()
+		version = v
+		downloads = 0
+	}
+	getDownloads := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return downloads
+	}
+
+	defer func(s *repoCache) { sharedCache = s }(sharedCache)
+	cacheDir := path.Join(testDir, "shared")
+	if err := EnableSharedCache(cacheDir, int64(len("v1")+len("v2")-1)); err != nil {
+		t.Fatalf("Failed to enable the shared cache: %v", err)
+	}
+	hits := func() float64 { return testutil.ToFloat64(sharedCacheRequests.WithLabelValues(sharedCacheHit)) }
+	initialHits := hits()
+
+	newKfDef := func(name string, r Repo) *KfConfig {
+		return &KfConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "opendatahub"},
+			Spec: KfConfigSpec{
+				AppDir: path.Join(testDir, name),
+				Repos:  []Repo{r},
+			},
+		}
+	}
+	syncKfDef := func(kfDef *KfConfig) string {
+		kfDef.Status.Caches = nil
+		if err := kfDef.SyncCache(); err != nil {
+			t.Fatalf("Failed to sync the cache of %v: %v", kfDef.Name, err)
+		}
+		localPath := kfDef.Status.Caches[0].LocalPath
+		if !strings.HasPrefix(localPath, path.Join(cacheDir, sharedCacheObjectsDir)) {
+			t.Errorf("Expected the cache of %v in the shared cache; got %v", kfDef.Name, localPath)
+		}
+		return localPath
+	}
+	readVersion := func(localPath string) string {
+		data, err := ioutil.ReadFile(path.Join(localPath, "version"))
+		if err != nil {
+			t.Errorf("Failed to read the version in %v: %v", localPath, err)
+		}
+		return string(data)
+	}
+
+	// KfDefs fetching the same archive share it.
+	repo := Repo{Name: "manifests", URI: server.URL + "/odh-manifests.tar.gz"}
+	first := newKfDef("first", repo)
+	second := newKfDef("second", Repo{Name: "odh", URI: repo.URI})
+	v1Path := syncKfDef(first)
+	if localPath := syncKfDef(second); localPath != v1Path || getDownloads() != 1 {
+		t.Errorf("Expected %v to be downloaded once to %v; got %v downloads and %v", repo.URI, v1Path, getDownloads(), localPath)
+	}
+	if h := hits() - initialHits; h != 1 {
+		t.Errorf("Expected 1 cache hit; got %v", h)
+	}
+	if _, err := os.Stat(path.Join(testDir, "first", DefaultCacheDir, "manifests")); err == nil {
+		t.Errorf("Expected the archive not to be unpacked in the AppDir")
+	}
+
+	// A new version of the archive is a new entry; the previous one is still used by second.
+	setVersion("v2")
+	v2Path := syncKfDef(first)
+	if v2Path == v1Path || readVersion(v2Path) != "v2" || readVersion(v1Path) != "v1" {
+		t.Errorf("Expected v2 in a new entry; got %v in %v and %v in %v", readVersion(v2Path), v2Path, readVersion(v1Path), v1Path)
+	}
+	if n := testutil.ToFloat64(sharedCacheEntries); n != 2 {
+		t.Errorf("Expected 2 entries; got %v", n)
+	}
+
+	// Once second no longer uses v1 it is collected since the cache exceeds its maximum size.
+	evictions := testutil.ToFloat64(sharedCacheEvictions)
+	ReleaseSharedCache("opendatahub", "second")
+	if _, err := os.Stat(v1Path); !os.IsNotExist(err) {
+		t.Errorf("Expected %v to be removed; got %v", v1Path, err)
+	}
+	if n := testutil.ToFloat64(sharedCacheEvictions) - evictions; n != 1 {
+		t.Errorf("Expected 1 eviction; got %v", n)
+	}
+	if readVersion(v2Path) != "v2" {
+		t.Errorf("Expected the entry used by first to be kept")
+	}
+
+	// The index survives a restart and a pinned archive is found without being downloaded.
+	if err := EnableSharedCache(cacheDir, 0); err != nil {
+		t.Fatalf("Failed to enable the shared cache again: %v", err)
+	}
+	setVersion("v2")
+	pinned := newKfDef("pinned", Repo{Name: "manifests", URI: repo.URI, SHA256: fmt.Sprintf("%x", sha256.Sum256(archives["v2"]))})
+	if localPath := syncKfDef(pinned); localPath != v2Path || getDownloads() != 0 {
+		t.Errorf("Expected the pinned archive from %v without download; got %v downloads and %v", v2Path, getDownloads(), localPath)
+	}
+
+	// An unmodified archive whose entry was removed is downloaded again.
+	os.RemoveAll(path.Join(cacheDir, sharedCacheObjectsDir))
+	if err := EnableSharedCache(cacheDir, 0); err != nil {
+		t.Fatalf("Failed to enable the shared cache again: %v", err)
+	}
+	if localPath := syncKfDef(first); readVersion(localPath) != "v2" || getDownloads() != 1 {
+		t.Errorf("Expected v2 to be downloaded again; got %v downloads and %v", getDownloads(), readVersion(localPath))
+	}
+}
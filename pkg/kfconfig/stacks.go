@@ -0,0 +1,103 @@
+package kfconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+	kfapis "github.com/opendatahub-io/opendatahub-operator/apis"
+)
+
+// StacksFile, at the root of a manifests repo, lists the stacks of the repo and the applications
+// each of them bundles, e.g.
+//
+//	stacks:
+//	- name: kubeflow-apps
+//	  applications:
+//	  - centraldashboard
+//	  - jupyter-web-app
+const StacksFile = "stacks.yaml"
+
+// StackMetadata is the contents of StacksFile.
+type StackMetadata struct {
+	Stacks []Stack `json:"stacks,omitempty"`
+}
+
+// Stack is a kustomize package bundling several applications, generated in a single directory.
+type Stack struct {
+	Name         string   `json:"name"`
+	Applications []string `json:"applications,omitempty"`
+}
+
+// GetStacks returns the stacks declared in the StacksFile of the cached repos, in the order of the
+// repos. The applications of stacks declared by several repos are merged.
+func (c *KfConfig) GetStacks() ([]Stack, error) {
+	var stacks []Stack
+	index := map[string]int{}
+	for _, cache := range c.Status.Caches {
+		stacksFile := filepath.Join(cache.LocalPath, StacksFile)
+		data, err := ioutil.ReadFile(stacksFile)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, &kfapis.KfError{
+				Code:    int(kfapis.INTERNAL_ERROR),
+				Message: fmt.Sprintf("couldn't read %v: %v", stacksFile, err),
+			}
+		}
+		metadata := &StackMetadata{}
+		if err := yaml.Unmarshal(data, metadata); err != nil {
+			return nil, &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("invalid stacks file %v: %v", stacksFile, err),
+			}
+		}
+		for _, s := range metadata.Stacks {
+			if s.Name == "" {
+				return nil, &kfapis.KfError{
+					Code:    int(kfapis.INVALID_ARGUMENT),
+					Message: fmt.Sprintf("invalid stacks file %v: a stack has no name", stacksFile),
+				}
+			}
+			i, ok := index[s.Name]
+			if !ok {
+				index[s.Name] = len(stacks)
+				stacks = append(stacks, Stack{Name: s.Name})
+				i = len(stacks) - 1
+			}
+			for _, app := range s.Applications {
+				if !stacks[i].hasApplication(app) {
+					stacks[i].Applications = append(stacks[i].Applications, app)
+				}
+			}
+		}
+	}
+	return stacks, nil
+}
+
+// GetStackName returns the name of the stack bundling the application appName, or appName if no
+// stack declares it.
+func (c *KfConfig) GetStackName(appName string) (string, error) {
+	stacks, err := c.GetStacks()
+	if err != nil {
+		return "", err
+	}
+	for _, s := range stacks {
+		if s.hasApplication(appName) {
+			return s.Name, nil
+		}
+	}
+	return appName, nil
+}
+
+func (s *Stack) hasApplication(appName string) bool {
+	for _, app := range s.Applications {
+		if app == appName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package kfconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetStacks(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+	repos := map[string]string{
+		"manifests": "stacks:\n- name: odh-core\n  applications: [odh-dashboard, notebook-controller]\n- name: kubeflow-apps\n  applications: [jupyter-web-app]\n",
+		"extra":     "stacks:\n- name: odh-core\n  applications: [odh-dashboard, model-mesh]\n",
+		"plain":     "",
+		"broken":    "stacks:\n- applications: [a]\n",
+	}
+	for name, contents := range repos {
+		if err := os.MkdirAll(filepath.Join(testDir, name), 0755); err != nil {
+			t.Fatalf("Failed to create repo %v: %v", name, err)
+		}
+		if contents == "" {
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(testDir, name, StacksFile), []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write the stacks of %v: %v", name, err)
+		}
+	}
+	cache := func(name string) Cache {
+		return Cache{Name: name, LocalPath: filepath.Join(testDir, name)}
+	}
+
+	config := &KfConfig{
+		Spec: KfConfigSpec{
+			AppDir:       filepath.Join(testDir, "app"),
+			Applications: []Application{{Name: KfAppsStackName}, {Name: "odh-core"}},
+		},
+		Status: Status{Caches: []Cache{cache("manifests"), cache("plain"), cache("extra")}},
+	}
+	stacks, err := config.GetStacks()
+	if err != nil {
+		t.Fatalf("Failed to get the stacks: %v", err)
+	}
+	expected := []Stack{
+		{Name: "odh-core", Applications: []string{"odh-dashboard", "notebook-controller", "model-mesh"}},
+		{Name: KfAppsStackName, Applications: []string{"jupyter-web-app"}},
+	}
+	if !reflect.DeepEqual(stacks, expected) {
+		t.Errorf("Expected stacks %v; got %v", expected, stacks)
+	}
+
+	type testCase struct {
+		App      string
+		Expected string
+	}
+	for _, c := range []testCase{
+		{App: "model-mesh", Expected: "odh-core"},
+		{App: "jupyter-web-app", Expected: KfAppsStackName},
+		{App: "profiles", Expected: "profiles"},
+	} {
+		if stack, err := config.GetStackName(c.App); err != nil || stack != c.Expected {
+			t.Errorf("Case %v: expected stack %v; got %v, %v", c.App, c.Expected, stack, err)
+		}
+	}
+
+	// The parameters of the applications of a stack are set in the directory of the stack.
+	if err := config.SetApplicationParameter("notebook-controller", "image", "notebooks:v2"); err != nil {
+		t.Fatalf("Failed to set the parameter: %v", err)
+	}
+	patch := filepath.Join(config.Spec.AppDir, KustomizeDir, "odh-core", "notebook-controller-config.yaml")
+	if data, err := ioutil.ReadFile(patch); err != nil || !strings.Contains(string(data), "image: notebooks:v2") {
+		t.Errorf("Expected %v to set the image; got %v, %v", patch, string(data), err)
+	}
+
+	config.Status.Caches = append(config.Status.Caches, cache("broken"))
+	if _, err := config.GetStacks(); err == nil || !strings.Contains(err.Error(), "a stack has no name") {
+		t.Errorf("Expected an error for a stack without a name; got %v", err)
+	}
+}
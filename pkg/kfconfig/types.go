@@ -1,9 +1,6 @@
 package kfconfig
 
 import (
-	"archive/tar"
-	"bytes"
-	"compress/gzip"
 	"fmt"
 	"github.com/ghodss/yaml"
 	"github.com/hashicorp/go-getter/helper/url"
@@ -12,21 +9,22 @@ import (
 	"github.com/otiai10/copy"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
-	"io"
 	"io/ioutil"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"sigs.k8s.io/kustomize/v3/pkg/types"
 	"strings"
+	"sync"
 )
 
 const (
 	DefaultCacheDir = ".cache"
+	// maxConcurrentFetches is the number of repos SyncCache fetches at the same time.
+	maxConcurrentFetches = 4
 	// KfAppsStackName is the name that should be assigned to the application corresponding to the kubeflow
 	// application stack.
 	KfAppsStackName = "kubeflow-apps"
@@ -76,18 +74,72 @@ type KfConfigSpec struct {
 	Plugins      []Plugin      `json:"plugins,omitempty"`
 	Secrets      []Secret      `json:"secrets,omitempty"`
 	Repos        []Repo        `json:"repos,omitempty"`
+	Placement    *Placement    `json:"placement,omitempty"`
 }
 
 // Application defines an application to install
 type Application struct {
 	Name            string           `json:"name,omitempty"`
 	KustomizeConfig *KustomizeConfig `json:"kustomizeConfig,omitempty"`
+	HelmConfig      *HelmConfig      `json:"helmConfig,omitempty"`
+	Placement       *Placement       `json:"placement,omitempty"`
+	// Resources maps a container or workload name to its requests and limits.
+	Resources map[string]v1.ResourceRequirements `json:"resources,omitempty"`
+	// Outputs are values read from the objects of the application once applied, which other
+	// applications use in their params as ${output:application.name}.
+	Outputs []ApplicationOutput `json:"outputs,omitempty"`
+}
+
+// ApplicationOutput is a field of an object of an application, e.g. the host of its Route.
+type ApplicationOutput struct {
+	Name       string `json:"name"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	ObjectName string `json:"objectName"`
+	// Namespace of the object, the namespace of the KfDef by default. Empty for cluster scoped objects.
+	Namespace string `json:"namespace,omitempty"`
+	// FieldPath is a JSONPath expression selecting the value in the object, e.g. {.spec.host}.
+	FieldPath string `json:"fieldPath"`
 }
 
 type KustomizeConfig struct {
-	RepoRef    *RepoRef    `json:"repoRef,omitempty"`
-	Overlays   []string    `json:"overlays,omitempty"`
-	Parameters []NameValue `json:"parameters,omitempty"`
+	RepoRef               *RepoRef        `json:"repoRef,omitempty"`
+	Overlays              []string        `json:"overlays,omitempty"`
+	Parameters            []NameValue     `json:"parameters,omitempty"`
+	Include               []string        `json:"include,omitempty"`
+	PatchesStrategicMerge []string        `json:"patchesStrategicMerge,omitempty"`
+	PatchesJson6902       []PatchJson6902 `json:"patchesJson6902,omitempty"`
+	// ConditionalOverlays are applied after the Overlays, in order, when the cluster matches their conditions.
+	ConditionalOverlays []ConditionalOverlay `json:"conditionalOverlays,omitempty"`
+}
+
+// ConditionalOverlay is an overlay applied only when the cluster matches all its conditions.
+type ConditionalOverlay struct {
+	Name string `json:"name"`
+	// WhenAPIGroupPresent is an API group the cluster must serve, e.g. networking.istio.io.
+	WhenAPIGroupPresent string `json:"whenAPIGroupPresent,omitempty"`
+	// WhenPlatform is the platform of the cluster: OpenShift or Kubernetes.
+	WhenPlatform string `json:"whenPlatform,omitempty"`
+	// WhenClusterVersion is a constraint on the version of the cluster, the OpenShift version on
+	// OpenShift, e.g. ">=4.10". The operator is one of >=, >, <=, < or ==, >= if omitted.
+	WhenClusterVersion string `json:"whenClusterVersion,omitempty"`
+}
+
+type HelmConfig struct {
+	RepoRef     *RepoRef `json:"repoRef,omitempty"`
+	ReleaseName string   `json:"releaseName,omitempty"`
+	Namespace   string   `json:"namespace,omitempty"`
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Values     *runtime.RawExtension `json:"values,omitempty"`
+	ValuesFrom []ValuesReference     `json:"valuesFrom,omitempty"`
+}
+
+// ValuesReference refers to a key of a ConfigMap or Secret holding a Helm values file.
+type ValuesReference struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Key      string `json:"key,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
 }
 
 type RepoRef struct {
@@ -100,6 +152,28 @@ type NameValue struct {
 	Value string `json:"value,omitempty"`
 }
 
+// PatchJson6902 is an inline JSON patch for the resource selected by Target.
+type PatchJson6902 struct {
+	Target *PatchTarget `json:"target"`
+	Patch  string       `json:"patch"`
+}
+
+type PatchTarget struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Placement controls where the pods of the rendered workloads are scheduled.
+type Placement struct {
+	NodeSelector      map[string]string `json:"nodeSelector,omitempty"`
+	Tolerations       []v1.Toleration   `json:"tolerations,omitempty"`
+	Affinity          *v1.Affinity      `json:"affinity,omitempty"`
+	PriorityClassName string            `json:"priorityClassName,omitempty"`
+}
+
 type Plugin struct {
 	Name      string                `json:"name,omitempty"`
 	Namespace string                `json:"namespace,omitempty"`
@@ -147,11 +221,69 @@ type Repo struct {
 	// Can use any URI understood by go-getter:
 	// https://github.com/hashicorp/go-getter/blob/master/README.md#installation-and-usage
 	URI string `json:"uri,omitempty"`
+	// PullSecret is the name of a Secret of type kubernetes.io/dockerconfigjson in the KfDef
+	// namespace holding the registry credentials used to pull oci:// URIs.
+	PullSecret string `json:"pullSecret,omitempty"`
+	// AuthSecret is the name of a Secret in the KfDef namespace holding the credentials used
+	// to fetch the repo. git:: URIs accept a kubernetes.io/basic-auth or a kubernetes.io/ssh-auth
+	// Secret. http(s) archives accept a kubernetes.io/basic-auth Secret, a Secret with a bearer
+	// token under the token key and, alone or with either of them, a client certificate under
+	// the tls.crt and tls.key keys of a kubernetes.io/tls Secret.
+	AuthSecret string `json:"authSecret,omitempty"`
+	// CABundle refers to the key of a ConfigMap or Secret in the KfDef namespace holding PEM
+	// encoded certificates trusted, in addition to the system ones, by https archive downloads.
+	CABundle *KeyReference `json:"caBundle,omitempty"`
+	// SHA256 is the expected hex encoded sha256 digest of the repo archive. The archive is
+	// verified before it is unpacked. Only archives can be verified: git::, oci:// and directory
+	// repos with a sha256 or a signature are rejected.
+	SHA256 string `json:"sha256,omitempty"`
+	// Signature is a detached signature of the repo archive verified before it is unpacked.
+	Signature *RepoSignature `json:"signature,omitempty"`
+	// Update periodically checks a repo pointing to a mutable ref, i.e. a git branch or tag,
+	// an OCI tag or an http(s) archive without a sha256, for new versions.
+	Update *RepoUpdatePolicy `json:"update,omitempty"`
+}
+
+// RepoUpdatePolicy controls how new versions of a repo are detected and applied.
+type RepoUpdatePolicy struct {
+	// Interval between two checks. Defaults to 1h.
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Auto applies a new version as soon as it's found. Otherwise the repo is kept at its cached
+	// version, which the UpdateAvailable condition reports with the new one, until the repo
+	// changes in the spec or the operator restarts.
+	Auto bool `json:"auto,omitempty"`
+}
+
+// RepoSignature is a detached signature of a repo archive.
+type RepoSignature struct {
+	// URI where the signature can be obtained, e.g. the output of cosign sign-blob or a .minisig file.
+	URI string `json:"uri"`
+	// Format is either cosign or minisign. Defaults to cosign.
+	Format string `json:"format,omitempty"`
+	// PublicKey refers to the key of a Secret or ConfigMap in the KfDef namespace holding the
+	// public key, PEM encoded for cosign.
+	PublicKey KeyReference `json:"publicKey"`
+}
+
+// KeyReference refers to a key of a ConfigMap or Secret in the KfDef namespace.
+type KeyReference struct {
+	// Kind is either ConfigMap or Secret.
+	Kind string `json:"kind"`
+	// Name of the ConfigMap or Secret.
+	Name string `json:"name"`
+	// Key holding the value.
+	Key string `json:"key"`
 }
 
 type Status struct {
 	Conditions []Condition `json:"conditions,omitempty"`
 	Caches     []Cache     `json:"caches,omitempty"`
+	// ClusterFacts are the facts about the cluster to render the applications with.
+	ClusterFacts *ClusterFacts `json:"clusterFacts,omitempty"`
+	// Overlays are the overlays applied to the applications, conditional overlays included.
+	Overlays []ApplicationOverlays `json:"overlays,omitempty"`
+	// Outputs are the outputs of the applications read after they were applied.
+	Outputs []ApplicationOutputs `json:"outputs,omitempty"`
 }
 
 type Condition struct {
@@ -172,6 +304,45 @@ type Condition struct {
 type Cache struct {
 	Name      string `json:"name,omitempty"`
 	LocalPath string `json:"localPath,omitempty"`
+	// Revision is the commit SHA the repo resolved to for git repos, the manifest digest for
+	// oci repos, or the ETag, else the Last-Modified date, of http(s) archives.
+	Revision string `json:"revision,omitempty"`
+}
+
+// ApplicationOverlays are the overlays applied to an application.
+type ApplicationOverlays struct {
+	Name     string   `json:"name"`
+	Overlays []string `json:"overlays,omitempty"`
+}
+
+// ApplicationOutputs are the values of the outputs of an application.
+type ApplicationOutputs struct {
+	Name   string      `json:"name"`
+	Values []NameValue `json:"values,omitempty"`
+}
+
+// ClusterFacts are facts about the cluster discovered by the operator, usable as render params.
+type ClusterFacts struct {
+	// Platform is OpenShift or Kubernetes.
+	Platform string `json:"platform,omitempty"`
+	// Version is the OpenShift version on OpenShift, else the Kubernetes version.
+	Version           string `json:"version,omitempty"`
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// IngressDomain is the domain of the routes of the cluster on OpenShift.
+	IngressDomain string `json:"ingressDomain,omitempty"`
+	// APIGroups are the API groups served by the cluster.
+	APIGroups []string `json:"apiGroups,omitempty"`
+	// APIVersions are the group versions served by the cluster, e.g. apps/v1.
+	APIVersions         []string `json:"apiVersions,omitempty"`
+	DefaultStorageClass string   `json:"defaultStorageClass,omitempty"`
+	// Proxy is the cluster wide proxy configuration on OpenShift, if any.
+	Proxy *ClusterProxy `json:"proxy,omitempty"`
+}
+
+type ClusterProxy struct {
+	HTTPProxy  string `json:"httpProxy,omitempty"`
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	NoProxy    string `json:"noProxy,omitempty"`
 }
 
 type PluginKindType string
@@ -205,6 +376,19 @@ const (
 
 	// Pending means Kubeflow services is being updated.
 	Pending ConditionType = "Pending"
+
+	// RepoVerificationFailed means a repo archive did not match its sha256 or signature.
+	RepoVerificationFailed ConditionType = "RepoVerificationFailed"
+
+	// UpdateAvailable means a repo pointing to a mutable ref has a new version upstream.
+	UpdateAvailable ConditionType = "UpdateAvailable"
+
+	// InvalidParameters means the parameters of an application don't match its params.schema.yaml.
+	InvalidParameters ConditionType = "InvalidParameters"
+
+	// DeploymentConfigMigrationPending means DeploymentConfigs are kept until the Deployments
+	// converted from them are available.
+	DeploymentConfigMigrationPending ConditionType = "DeploymentConfigMigrationPending"
 )
 
 // Define plugin related conditions to be the format:
@@ -407,6 +591,12 @@ func (c *KfConfig) SetPluginFailed(pluginKind PluginKindType, msg string) {
 
 // SyncCache will synchronize the local cache of any repositories.
 // On success the status is updated with pointers to the cache.
+// URIs with the oci scheme are pulled from an OCI registry, see fetchOCI, and URIs
+// prefixed with git:: are cloned at their ref, see fetchGit. URIs with the configmap and
+// pvc schemes are read without network access from a ConfigMap or a mounted volume, see
+// fetchConfigMap and fetchPVC. Archives are checked against the sha256 and signature of the
+// repo before they are unpacked, see verifyArchive. Remote repos are cached in the shared
+// cache rather than the AppDir once EnableSharedCache is called.
 //
 // TODO(jlewi): I'm not sure this handles head references correctly.
 // e.g. suppose we have a URI like
@@ -456,9 +646,21 @@ func (c *KfConfig) SyncCache() error {
 		}
 	}
 
+	// Repos whose cache is out of date are fetched concurrently; their caches are recorded in
+	// the order of the spec.
+	var repos []Repo
 	for _, r := range c.Spec.Repos {
 		cacheDir := path.Join(baseCacheDir, r.Name)
 
+		if cache, ok := c.GetRepoCache(r.Name); ok && sharedCache != nil {
+			if _, isShared := sharedCache.key(cache.LocalPath); isShared {
+				if _, err := os.Stat(cache.LocalPath); err == nil {
+					log.Infof("%v is in the shared cache; not resyncing ", cache.LocalPath)
+					continue
+				}
+			}
+		}
+
 		// Can we use a checksum or other mechanism to verify if the existing location is good?
 		// If there was a problem the first time around then removing it might provide a way to recover.
 		if _, err := os.Stat(cacheDir); err == nil {
@@ -474,170 +676,217 @@ func (c *KfConfig) SyncCache() error {
 				log.Infof("%v exists; not resyncing ", cacheDir)
 				continue
 			}
-
-			log.Infof("Deleting cachedir %v because Status.ReposCache is out of date", cacheDir)
-
-			// TODO(jlewi): The reason the cachedir might exist but not be stored in KfDef.status
-			// is because of a backwards compatibility path in which we download the cache to construct
-			// the KfDef. Specifically coordinator.CreateKfDefFromOptions is calling kftypes.DownloadFromCache
-			// We don't want to rely on that method to set the cache because we have logic
-			// below to set LocalPath that we don't want to duplicate.
-			// Unfortunately this means we end up fetching the repo twice which is very inefficient.
-			if err := os.RemoveAll(cacheDir); err != nil {
-				log.Errorf("There was a problem deleting directory %v; error %v", cacheDir, err)
-				return errors.WithStack(err)
-			}
 		}
+		repos = append(repos, r)
+	}
 
-		u, err := url.Parse(r.URI)
-
-		if err != nil {
-			log.Errorf("Could not parse URI %v; error %v", r.URI, err)
-			return errors.WithStack(err)
-		}
+	caches := make([]*Cache, len(repos))
+	errs := make([]error, len(repos))
+	fetches := make(chan struct{}, maxConcurrentFetches)
+	var wg sync.WaitGroup
+	for i, r := range repos {
+		wg.Add(1)
+		go func(i int, r Repo) {
+			defer wg.Done()
+			fetches <- struct{}{}
+			defer func() { <-fetches }()
+			caches[i], errs[i] = c.syncRepo(r, path.Join(baseCacheDir, r.Name))
+		}(i, r)
+	}
+	wg.Wait()
 
-		log.Infof("Fetching %v to %v", r.URI, cacheDir)
-		if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
-			log.Errorf("Could not create dir %v; error %v", cacheDir, err)
-			return errors.WithStack(err)
+	var syncErr error
+	for i := range repos {
+		if errs[i] == nil {
+			c.setRepoCache(*caches[i])
+			continue
 		}
-
-		// Manifests are local dir
-		if fi, err := os.Stat(r.URI); err == nil && fi.Mode().IsDir() {
-			// check whether the cache directory is a sub directory of manifests
-			absCacheDir, err := filepath.Abs(cacheDir)
-			if err != nil {
-				return errors.WithStack(err)
-			}
-
-			absURI, err := filepath.Abs(r.URI)
-			if err != nil {
-				return errors.WithStack(err)
-			}
-
-			relDir, err := filepath.Rel(absURI, absCacheDir)
-			if err != nil {
-				return errors.WithStack(err)
-			}
-
-			if !strings.HasPrefix(relDir, ".."+string(filepath.Separator)) {
-				return errors.WithStack(errors.New("SyncCache: could not sync cache when the cache path " + cacheDir + " is sub directory of manifests " + r.URI))
-			}
-
-			if err := copy.Copy(r.URI, cacheDir); err != nil {
-				return errors.WithStack(err)
-			}
-		} else {
-			t := &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-			}
-			t.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
-			t.RegisterProtocol("", http.NewFileTransport(http.Dir("/")))
-			hclient := &http.Client{Transport: t}
-			req, _ := http.NewRequest("GET", r.URI, nil)
-			req.Header.Set("User-Agent", "kfctl")
-			resp, err := hclient.Do(req)
-			if err != nil {
-				return &kfapis.KfError{
-					Code:    int(kfapis.INVALID_ARGUMENT),
-					Message: fmt.Sprintf("couldn't download URI %v: %v", r.URI, err),
-				}
-			}
-			defer resp.Body.Close()
-
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				log.Errorf("Could not read response body; error %v", err)
-				return errors.WithStack(err)
-			}
-			if err := untar(body, cacheDir); err != nil {
-				log.Errorf("Could not untar file %v; error %v", r.URI, err)
-				return errors.WithStack(err)
-			}
+		var verificationErr *RepoVerificationError
+		if errors.As(errs[i], &verificationErr) {
+			c.SetCondition(RepoVerificationFailed, v1.ConditionTrue, "", verificationErr.Error())
 		}
-
-		// This is a bit of a hack to deal with the fact that GitHub tarballs
-		// can unpack to a directory containing the commit.
-		localPath := cacheDir
-		files, filesErr := ioutil.ReadDir(cacheDir)
-		if filesErr != nil {
-			log.Errorf("Error reading cachedir; error %v", filesErr)
-			return errors.WithStack(filesErr)
+		if syncErr == nil {
+			syncErr = errs[i]
 		}
-		if u.Scheme == "http" || u.Scheme == "https" {
-			subdir := files[0].Name()
-			localPath = path.Join(cacheDir, subdir)
-			log.Infof("Updating localPath to %v", localPath)
-		} else if u.Scheme == "file" {
-			filePath := strings.TrimPrefix(r.URI, "file:")
-			log.Infof("Probing file path: %v", filePath)
-			if fileInfo, err := os.Stat(filePath); err != nil {
-				return &kfapis.KfError{
-					Code:    int(kfapis.INVALID_ARGUMENT),
-					Message: fmt.Sprintf("couldn't stat the path %v: %v", filePath, err),
-				}
-			} else if !fileInfo.IsDir() {
-				subdir := files[0].Name()
-				localPath = path.Join(cacheDir, subdir)
-				log.Infof("Updating localPath to %v", localPath)
-			}
+	}
+	if sharedCache != nil {
+		var localPaths []string
+		for _, cache := range c.Status.Caches {
+			localPaths = append(localPaths, cache.LocalPath)
 		}
+		sharedCache.setRefs(c.Namespace+"/"+c.Name, localPaths)
+	}
+	return syncErr
+}
 
-		c.Status.Caches = append(c.Status.Caches, Cache{
-			Name:      r.Name,
-			LocalPath: localPath,
-		})
+// setRepoCache records cache in the status, replacing the out of date cache of the same repo.
+func (c *KfConfig) setRepoCache(cache Cache) {
+	for i := range c.Status.Caches {
+		if c.Status.Caches[i].Name == cache.Name {
+			c.Status.Caches[i] = cache
+			return
+		}
+	}
+	c.Status.Caches = append(c.Status.Caches, cache)
+}
 
-		log.Infof("Fetch succeeded; LocalPath %v", localPath)
+// LocalRepoDir returns the absolute path of uri if it's a local directory, which SyncCache
+// copies rather than fetches.
+func LocalRepoDir(uri string) (string, bool) {
+	if strings.HasPrefix(uri, GitPrefix) {
+		return "", false
 	}
-	return nil
+	if fi, err := os.Stat(uri); err != nil || !fi.IsDir() {
+		return "", false
+	}
+	dir, err := filepath.Abs(uri)
+	if err != nil {
+		return "", false
+	}
+	return dir, true
 }
 
-func untar(body []byte, cacheDir string) error {
-	gzf, err := gzip.NewReader(bytes.NewReader(body))
+// syncRepo fetches r into cacheDir and returns its cache.
+func (c *KfConfig) syncRepo(r Repo, cacheDir string) (*Cache, error) {
+	u, err := url.Parse(r.URI)
+
 	if err != nil {
-		return err
+		log.Errorf("Could not parse URI %v; error %v", r.URI, err)
+		return nil, errors.WithStack(err)
 	}
 
-	tarReader := tar.NewReader(gzf)
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
+	log.Infof("Fetching %v to %v", r.URI, cacheDir)
+	revision := ""
+	fi, statErr := os.Stat(r.URI)
+	isArchive := !strings.HasPrefix(r.URI, GitPrefix) && u.Scheme != OCIScheme && u.Scheme != ConfigMapScheme &&
+		u.Scheme != PVCScheme && !(statErr == nil && fi.Mode().IsDir())
+	// unpackedArchive is true when cacheDir holds a tarball which unpacks to a single directory.
+	unpackedArchive := u.Scheme == ConfigMapScheme
+	isShared := sharedCache != nil && (isArchive || strings.HasPrefix(r.URI, GitPrefix) || u.Scheme == OCIScheme)
+	if strings.HasPrefix(r.URI, GitPrefix) || u.Scheme == OCIScheme || (statErr == nil && fi.Mode().IsDir()) {
+		if err := checkVerifiable(r); err != nil {
+			return nil, err
+		}
+	}
+	if !isArchive && !isShared {
+		// Archives are only removed once fetchArchive knows they changed.
+		if err := resetCacheDir(cacheDir); err != nil {
+			return nil, err
+		}
+	}
+
+	if isShared {
+		if cacheDir, revision, err = sharedCache.fetch(c, c.Namespace+"/"+c.Name, r, u); err != nil {
+			log.Errorf("Could not fetch %v into the shared cache; error %v", r.URI, err)
+			return nil, err
+		}
+	} else if strings.HasPrefix(r.URI, GitPrefix) {
+		if revision, err = c.fetchGit(r, cacheDir); err != nil {
+			log.Errorf("Could not clone git repo %v; error %v", r.URI, err)
+			return nil, err
+		}
+	} else if u.Scheme == OCIScheme {
+		if revision, err = c.fetchOCI(r, cacheDir); err != nil {
+			log.Errorf("Could not pull OCI artifact %v; error %v", r.URI, err)
+			return nil, err
+		}
+	} else if u.Scheme == ConfigMapScheme {
+		if err := c.fetchConfigMap(r, cacheDir); err != nil {
+			log.Errorf("Could not read ConfigMap %v; error %v", r.URI, err)
+			return nil, err
 		}
+	} else if u.Scheme == PVCScheme {
+		if unpackedArchive, err = c.fetchPVC(r, cacheDir); err != nil {
+			log.Errorf("Could not read volume %v; error %v", r.URI, err)
+			return nil, err
+		}
+	} else if !isArchive {
+		// Manifests are local dir
+		// check whether the cache directory is a sub directory of manifests
+		absCacheDir, err := filepath.Abs(cacheDir)
 		if err != nil {
-			return err
+			return nil, errors.WithStack(err)
 		}
-		if header == nil {
-			continue
+
+		absURI, err := filepath.Abs(r.URI)
+		if err != nil {
+			return nil, errors.WithStack(err)
 		}
 
-		target := filepath.Join(cacheDir, header.Name)
+		relDir, err := filepath.Rel(absURI, absCacheDir)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
 
-		switch header.Typeflag {
+		if !strings.HasPrefix(relDir, ".."+string(filepath.Separator)) {
+			return nil, errors.WithStack(errors.New("SyncCache: could not sync cache when the cache path " + cacheDir + " is sub directory of manifests " + r.URI))
+		}
 
-		case tar.TypeDir:
-			if _, err := os.Stat(target); err != nil {
-				if err := os.MkdirAll(target, 0755); err != nil {
-					return err
-				}
-			}
+		if err := copy.Copy(r.URI, cacheDir); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	} else if err := c.fetchArchive(r, cacheDir); err != nil {
+		log.Errorf("Could not fetch archive %v; error %v", r.URI, err)
+		return nil, err
+	} else if meta := readArchiveMeta(cacheDir); meta != nil {
+		revision = meta.revision()
+	}
 
-		case tar.TypeReg:
-			f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
-			if err != nil {
-				return err
+	// This is a bit of a hack to deal with the fact that GitHub tarballs
+	// can unpack to a directory containing the commit.
+	localPath := cacheDir
+	files, filesErr := ioutil.ReadDir(cacheDir)
+	if filesErr != nil {
+		log.Errorf("Error reading cachedir; error %v", filesErr)
+		return nil, errors.WithStack(filesErr)
+	}
+	if u.Scheme == "http" || u.Scheme == "https" || unpackedArchive {
+		subdir := files[0].Name()
+		localPath = path.Join(cacheDir, subdir)
+		log.Infof("Updating localPath to %v", localPath)
+	} else if u.Scheme == "file" {
+		filePath := strings.TrimPrefix(r.URI, "file:")
+		log.Infof("Probing file path: %v", filePath)
+		if fileInfo, err := os.Stat(filePath); err != nil {
+			return nil, &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("couldn't stat the path %v: %v", filePath, err),
 			}
+		} else if !fileInfo.IsDir() {
+			subdir := files[0].Name()
+			localPath = path.Join(cacheDir, subdir)
+			log.Infof("Updating localPath to %v", localPath)
+		}
+	}
 
-			if _, err := io.Copy(f, tarReader); err != nil {
-				return err
-			}
+	log.Infof("Fetch succeeded; LocalPath %v", localPath)
+	return &Cache{
+		Name:      r.Name,
+		LocalPath: localPath,
+		Revision:  revision,
+	}, nil
+}
 
-			if err := f.Close(); err != nil {
-				return err
-			}
+// resetCacheDir removes any previous content of cacheDir and recreates it empty.
+func resetCacheDir(cacheDir string) error {
+	if _, err := os.Stat(cacheDir); err == nil {
+		log.Infof("Deleting cachedir %v because Status.ReposCache is out of date", cacheDir)
+
+		// TODO(jlewi): The reason the cachedir might exist but not be stored in KfDef.status
+		// is because of a backwards compatibility path in which we download the cache to construct
+		// the KfDef. Specifically coordinator.CreateKfDefFromOptions is calling kftypes.DownloadFromCache
+		// We don't want to rely on that method to set the cache because we have logic
+		// below to set LocalPath that we don't want to duplicate.
+		// Unfortunately this means we end up fetching the repo twice which is very inefficient.
+		if err := os.RemoveAll(cacheDir); err != nil {
+			log.Errorf("There was a problem deleting directory %v; error %v", cacheDir, err)
+			return errors.WithStack(err)
 		}
 	}
+	if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
+		log.Errorf("Could not create dir %v; error %v", cacheDir, err)
+		return errors.WithStack(err)
+	}
 	return nil
 }
 
@@ -834,31 +1083,13 @@ func (c *KfConfig) SetApplicationParameter(appName string, paramName string, val
 		// the kubeflow-apps stack. So when we call SetApplicationParameter("jupyter-web-app",...)
 		// we actually want to modify the config map inside ${KFAPP}/kustomize/kubeflow-apps
 		//
-		// TODO(jlewi): Is there a better way handle this other than hardcoding the path.
-		appToStack := map[string]string{
-			"centraldashboard": KfAppsStackName,
-			"cloud-endpoints":  "cloud-endpoints",
-			"default-install":  KfAppsStackName,
-			"istio-stack":      "istio-stack",
-			"iap-ingress":      "iap-ingress",
-			"jupyter-web-app":  KfAppsStackName,
-			"metacontroller":   "metacontroller",
-			"profiles":         KfAppsStackName,
-			"dex":              "dex",
-			// Spartakus is its own application because we want kfctl to be able to remove it.
-			"spartakus": "spartakus",
-			// AWS Specific
-			"aws-alb-ingress-controller": KfAppsStackName,
-			"istio-ingress":              "istio-ingress",
+		// The manifests repos declare their stacks in StacksFile.
+		appNameDir, err := c.GetStackName(appName)
+		if err != nil {
+			return err
 		}
-
-		appNameDir, ok := appToStack[appName]
-
-		if !ok {
-			// Default to assuming appNameDir is the same as appName if not explicitly
-			// specified?
-			appNameDir = appName
-			log.Warnf("No stack directory specified for app %v; defaulting to %v", appName, appNameDir)
+		if appNameDir == appName {
+			log.Warnf("No stack declares app %v; defaulting to %v", appName, appNameDir)
 		}
 		kustomizeDir := filepath.Join(c.Spec.AppDir, KustomizeDir, appNameDir)
 		return setApplicationParameterInConfigMap(kustomizeDir, appName, paramName, value)
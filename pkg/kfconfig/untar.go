@@ -0,0 +1,215 @@
+package kfconfig
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Limits enforced when unpacking a repo archive. They are variables so that tests can lower them.
+var (
+	// maxArchiveSize is the maximum total size of the unpacked files.
+	maxArchiveSize int64 = 2 << 30
+	// maxArchiveFileSize is the maximum size of a single unpacked file.
+	maxArchiveFileSize int64 = 512 << 20
+	// maxArchiveEntries is the maximum number of entries in an archive.
+	maxArchiveEntries = 100000
+)
+
+// untar unpacks the gzipped tarball read from r into cacheDir. Entries are streamed to disk
+// and may not escape cacheDir: absolute names, names with .. elements, entries below a
+// symlink and symlinks or hard links resolving outside cacheDir are rejected.
+func untar(r io.Reader, cacheDir string) error {
+	gzf, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("could not decompress archive: %v", err)
+	}
+	defer gzf.Close()
+
+	root, err := filepath.Abs(cacheDir)
+	if err != nil {
+		return err
+	}
+	var symlinks []string
+	var size int64
+	tarReader := tar.NewReader(gzf)
+	for entries := 0; ; entries++ {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read archive entry %v: %v", entries+1, err)
+		}
+		if entries >= maxArchiveEntries {
+			return fmt.Errorf("archive has more than %v entries", maxArchiveEntries)
+		}
+
+		name, err := archiveEntryPath(header.Name)
+		if err != nil {
+			return fmt.Errorf("archive entry %q: %v", header.Name, err)
+		}
+		if name == "." {
+			continue
+		}
+		target := filepath.Join(root, filepath.FromSlash(name))
+		if err := checkNoSymlinkParents(root, name); err != nil {
+			return fmt.Errorf("archive entry %q: %v", header.Name, err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("archive entry %q: %v", header.Name, err)
+			}
+
+		case tar.TypeReg:
+			if header.Size > maxArchiveFileSize {
+				return fmt.Errorf("archive entry %q: size %v exceeds the limit of %v bytes", header.Name, header.Size, maxArchiveFileSize)
+			}
+			if size += header.Size; size > maxArchiveSize {
+				return fmt.Errorf("archive entry %q: unpacked archive exceeds the limit of %v bytes", header.Name, maxArchiveSize)
+			}
+			if err := writeArchiveFile(target, tarReader, header); err != nil {
+				return fmt.Errorf("archive entry %q: %v", header.Name, err)
+			}
+
+		case tar.TypeSymlink:
+			if path.IsAbs(header.Linkname) {
+				return fmt.Errorf("archive entry %q: symlink to absolute path %v", header.Name, header.Linkname)
+			}
+			if _, err := archiveEntryPath(path.Join(path.Dir(name), header.Linkname)); err != nil {
+				return fmt.Errorf("archive entry %q: symlink to %v: %v", header.Name, header.Linkname, err)
+			}
+			if err := prepareArchiveTarget(target); err != nil {
+				return fmt.Errorf("archive entry %q: %v", header.Name, err)
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return fmt.Errorf("archive entry %q: %v", header.Name, err)
+			}
+			symlinks = append(symlinks, header.Name)
+
+		case tar.TypeLink:
+			linkName, err := archiveEntryPath(header.Linkname)
+			if err != nil {
+				return fmt.Errorf("archive entry %q: hard link to %v: %v", header.Name, header.Linkname, err)
+			}
+			if err := checkNoSymlinkParents(root, linkName); err != nil {
+				return fmt.Errorf("archive entry %q: hard link to %v: %v", header.Name, header.Linkname, err)
+			}
+			source := filepath.Join(root, filepath.FromSlash(linkName))
+			if fi, err := os.Lstat(source); err != nil || !fi.Mode().IsRegular() {
+				return fmt.Errorf("archive entry %q: hard link to %v which is not a previously unpacked file", header.Name, header.Linkname)
+			}
+			if err := prepareArchiveTarget(target); err != nil {
+				return fmt.Errorf("archive entry %q: %v", header.Name, err)
+			}
+			if err := os.Link(source, target); err != nil {
+				return fmt.Errorf("archive entry %q: %v", header.Name, err)
+			}
+
+		case tar.TypeXGlobalHeader:
+
+		default:
+			log.Warnf("Skipping archive entry %q of unsupported type %v", header.Name, string(header.Typeflag))
+		}
+	}
+
+	// Symlinks are checked once every entry is unpacked since a chain of links which are
+	// each inside cacheDir can still resolve outside of it.
+	if len(symlinks) > 0 {
+		if root, err = filepath.EvalSymlinks(root); err != nil {
+			return err
+		}
+	}
+	for _, name := range symlinks {
+		resolved, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(path.Clean(name))))
+		if err != nil {
+			// Dangling links can't be followed outside cacheDir.
+			continue
+		}
+		if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("archive entry %q: symlink resolves to %v outside of the cache dir", name, resolved)
+		}
+	}
+	return nil
+}
+
+// archiveEntryPath returns the cleaned slash separated path of an archive entry, rejecting
+// absolute paths and paths with .. elements.
+func archiveEntryPath(name string) (string, error) {
+	if path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("absolute path")
+	}
+	for _, element := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if element == ".." {
+			return "", fmt.Errorf("path contains ..")
+		}
+	}
+	return path.Clean(name), nil
+}
+
+// checkNoSymlinkParents returns an error if one of the parent directories of name below
+// root is a symlink, which would make writing name follow it.
+func checkNoSymlinkParents(root string, name string) error {
+	dir := root
+	elements := strings.Split(name, "/")
+	for _, element := range elements[:len(elements)-1] {
+		dir = filepath.Join(dir, element)
+		fi, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("parent directory %v is a symlink", element)
+		}
+	}
+	return nil
+}
+
+// prepareArchiveTarget creates the parent directories of target and removes a file or
+// symlink unpacked earlier at target so that it is replaced rather than followed.
+func prepareArchiveTarget(target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	fi, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%v is already a directory", filepath.Base(target))
+	}
+	return os.Remove(target)
+}
+
+func writeArchiveFile(target string, r io.Reader, header *tar.Header) error {
+	if err := prepareArchiveTarget(target); err != nil {
+		return err
+	}
+	// Drop the setuid, setgid and sticky bits while keeping the file readable by the operator.
+	mode := os.FileMode(header.Mode).Perm() | 0600
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	// The tar reader doesn't return more than header.Size bytes for an entry.
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
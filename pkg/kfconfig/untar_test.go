@@ -0,0 +1,187 @@
+package kfconfig
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+type archiveEntry struct {
+	Name     string
+	Type     byte
+	Content  string
+	Linkname string
+}
+
+func newArchive(t *testing.T, entries []archiveEntry) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.Name, Typeflag: e.Type, Linkname: e.Linkname, Mode: 0644}
+		switch e.Type {
+		case tar.TypeDir:
+			header.Mode = 0755
+		case tar.TypeReg:
+			header.Size = int64(len(e.Content))
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("Failed to write tar header %v: %v", e.Name, err)
+		}
+		if _, err := tw.Write([]byte(e.Content)); err != nil {
+			t.Fatalf("Failed to write tar content %v: %v", e.Name, err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestUntar(t *testing.T) {
+	type testCase struct {
+		Name     string
+		Entries  []archiveEntry
+		Archive  []byte
+		Expected map[string]string
+		Error    string
+	}
+
+	testCases := []testCase{
+		{
+			Name: "valid",
+			Entries: []archiveEntry{
+				{Name: "manifests/", Type: tar.TypeDir},
+				{Name: "manifests/base/kustomization.yaml", Type: tar.TypeReg, Content: "resources: []\n"},
+				{Name: "./manifests/params.env", Type: tar.TypeReg, Content: "key=value\n"},
+				{Name: "manifests/overlays/params.env", Type: tar.TypeSymlink, Linkname: "../params.env"},
+				{Name: "manifests/copy.env", Type: tar.TypeLink, Linkname: "manifests/params.env"},
+				{Name: "manifests/fifo", Type: tar.TypeFifo},
+			},
+			Expected: map[string]string{
+				"manifests/base/kustomization.yaml": "resources: []\n",
+				"manifests/params.env":              "key=value\n",
+				"manifests/overlays/params.env":     "key=value\n",
+				"manifests/copy.env":                "key=value\n",
+			},
+		},
+		{
+			Name:    "parent-path",
+			Entries: []archiveEntry{{Name: "manifests/../../evil", Type: tar.TypeReg, Content: "evil"}},
+			Error:   `archive entry "manifests/../../evil": path contains ..`,
+		},
+		{
+			Name:    "absolute-path",
+			Entries: []archiveEntry{{Name: "/tmp/evil", Type: tar.TypeReg, Content: "evil"}},
+			Error:   `archive entry "/tmp/evil": absolute path`,
+		},
+		{
+			Name:    "absolute-symlink",
+			Entries: []archiveEntry{{Name: "etc", Type: tar.TypeSymlink, Linkname: "/etc"}},
+			Error:   `archive entry "etc": symlink to absolute path /etc`,
+		},
+		{
+			Name:    "symlink-outside",
+			Entries: []archiveEntry{{Name: "manifests/up", Type: tar.TypeSymlink, Linkname: "../../"}},
+			Error:   `archive entry "manifests/up": symlink to ../../: path contains ..`,
+		},
+		{
+			Name: "write-through-symlink",
+			Entries: []archiveEntry{
+				{Name: "dir/", Type: tar.TypeDir},
+				{Name: "link", Type: tar.TypeSymlink, Linkname: "dir"},
+				{Name: "link/evil", Type: tar.TypeReg, Content: "evil"},
+			},
+			Error: `archive entry "link/evil": parent directory link is a symlink`,
+		},
+		{
+			Name: "symlink-chain-outside",
+			Entries: []archiveEntry{
+				{Name: "x/", Type: tar.TypeDir},
+				{Name: "a/b/l", Type: tar.TypeSymlink, Linkname: "../../x"},
+				{Name: "a/b/m", Type: tar.TypeSymlink, Linkname: "l/../.."},
+			},
+			Error: `archive entry "a/b/m": symlink resolves to`,
+		},
+		{
+			Name:    "hard-link-outside",
+			Entries: []archiveEntry{{Name: "passwd", Type: tar.TypeLink, Linkname: "/etc/passwd"}},
+			Error:   `archive entry "passwd": hard link to /etc/passwd: absolute path`,
+		},
+		{
+			Name:    "file-too-large",
+			Entries: []archiveEntry{{Name: "large", Type: tar.TypeReg, Content: strings.Repeat("a", 101)}},
+			Error:   `archive entry "large": size 101 exceeds the limit of 100 bytes`,
+		},
+		{
+			Name: "archive-too-large",
+			Entries: []archiveEntry{
+				{Name: "a", Type: tar.TypeReg, Content: strings.Repeat("a", 100)},
+				{Name: "b", Type: tar.TypeReg, Content: strings.Repeat("b", 100)},
+				{Name: "c", Type: tar.TypeReg, Content: strings.Repeat("c", 100)},
+			},
+			Error: `archive entry "c": unpacked archive exceeds the limit of 250 bytes`,
+		},
+		{
+			Name: "too-many-entries",
+			Entries: []archiveEntry{
+				{Name: "1/", Type: tar.TypeDir}, {Name: "2/", Type: tar.TypeDir}, {Name: "3/", Type: tar.TypeDir},
+				{Name: "4/", Type: tar.TypeDir}, {Name: "5/", Type: tar.TypeDir}, {Name: "6/", Type: tar.TypeDir},
+				{Name: "7/", Type: tar.TypeDir},
+			},
+			Error: "archive has more than 6 entries",
+		},
+		{
+			Name:    "not-gzip",
+			Archive: []byte("<html>Not Found</html>"),
+			Error:   "could not decompress archive",
+		},
+	}
+
+	defer func(size, fileSize int64, entries int) {
+		maxArchiveSize, maxArchiveFileSize, maxArchiveEntries = size, fileSize, entries
+	}(maxArchiveSize, maxArchiveFileSize, maxArchiveEntries)
+	maxArchiveSize, maxArchiveFileSize, maxArchiveEntries = 250, 100, 6
+
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	for _, c := range testCases {
+		cacheDir := path.Join(testDir, c.Name, "cache")
+		if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
+			t.Fatalf("Failed to create cache dir: %v", err)
+		}
+		archive := c.Archive
+		if archive == nil {
+			archive = newArchive(t, c.Entries)
+		}
+		err := untar(bytes.NewReader(archive), cacheDir)
+		if c.Error != "" {
+			if err == nil || !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("Case %v: expected error containing %v; got %v", c.Name, c.Error, err)
+			}
+			if files, _ := ioutil.ReadDir(path.Join(testDir, c.Name)); len(files) != 1 {
+				t.Errorf("Case %v: files were written outside of the cache dir", c.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Case %v: failed to untar: %v", c.Name, err)
+		}
+		for name, expected := range c.Expected {
+			data, err := ioutil.ReadFile(path.Join(cacheDir, name))
+			if err != nil {
+				t.Errorf("Case %v: failed to read %v: %v", c.Name, name, err)
+			} else if string(data) != expected {
+				t.Errorf("Case %v: expected %v to contain %q; got %q", c.Name, name, expected, string(data))
+			}
+		}
+	}
+}
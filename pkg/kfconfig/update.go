@@ -0,0 +1,165 @@
+package kfconfig
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	kfapis "github.com/opendatahub-io/opendatahub-operator/apis"
+)
+
+// DefaultRepoUpdateInterval is the interval between two checks for new versions of a repo.
+const DefaultRepoUpdateInterval = time.Hour
+
+// UpdateInterval returns the interval between two checks for new versions.
+func (p *RepoUpdatePolicy) UpdateInterval() time.Duration {
+	if p.Interval == nil || p.Interval.Duration <= 0 {
+		return DefaultRepoUpdateInterval
+	}
+	return p.Interval.Duration
+}
+
+// IsMutableRepo returns true if r points to a ref which may resolve to new versions: a git
+// branch or tag, an OCI tag or an http(s) archive without a sha256.
+func IsMutableRepo(r Repo) bool {
+	u, err := url.Parse(r.URI)
+	if err != nil || pinnedDigest(r, u) != "" {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(r.URI, GitPrefix):
+		src, err := parseGitURI(r.URI)
+		return err == nil && !commitSHA.MatchString(src.Ref)
+	case u.Scheme == OCIScheme:
+		return true
+	case u.Scheme == "http" || u.Scheme == "https":
+		return r.SHA256 == ""
+	}
+	return false
+}
+
+// LatestRevision returns the revision the ref of r points to upstream, in the form of
+// Cache.Revision, without fetching the repo.
+func (c *KfConfig) LatestRevision(r Repo) (string, error) {
+	if !IsMutableRepo(r) {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("repo %v doesn't point to a git, oci or http(s) ref which may change", r.Name),
+		}
+	}
+	if strings.HasPrefix(r.URI, GitPrefix) {
+		return c.latestGitRevision(r)
+	}
+	if strings.HasPrefix(r.URI, OCIScheme+"://") {
+		o, err := c.newOCIClient(r)
+		if err != nil {
+			return "", err
+		}
+		manifest, err := o.manifest()
+		if err != nil {
+			return "", &kfapis.KfError{
+				Code:    int(kfapis.INVALID_ARGUMENT),
+				Message: fmt.Sprintf("couldn't get the manifest of %v: %v", r.URI, err),
+			}
+		}
+		return manifest.digest, nil
+	}
+	return c.latestArchiveRevision(r)
+}
+
+// latestGitRevision returns the commit the ref of the git repo r points to.
+func (c *KfConfig) latestGitRevision(r Repo) (string, error) {
+	src, err := parseGitURI(r.URI)
+	if err != nil {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: err.Error(),
+		}
+	}
+	env, cleanup, err := c.gitEnv(r, src)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	ref := src.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// Annotated tags are only listed with the commit they point to when asked for.
+	out, err := git("", env, "ls-remote", "--", src.URL, ref, ref+"^{}")
+	if err != nil {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't list the refs of %v: %v", r.URI, err),
+		}
+	}
+	revision, ok := lsRemoteRevision(out, ref)
+	if !ok {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("%v has no ref %v", src.URL, ref),
+		}
+	}
+	return revision, nil
+}
+
+// lsRemoteRevision returns the commit ref resolves to in the output of git ls-remote. Branches
+// take precedence over tags, as with git fetch, and annotated tags resolve to their commit. Refs
+// only ending with ref, such as refs/heads/feature/<ref>, don't match.
+func lsRemoteRevision(out string, ref string) (string, bool) {
+	refs := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		refs[fields[1]] = fields[0]
+	}
+	for _, name := range []string{ref, "refs/heads/" + ref, "refs/tags/" + ref + "^{}", "refs/tags/" + ref, ref + "^{}"} {
+		if revision, ok := refs[name]; ok {
+			return revision, true
+		}
+	}
+	return "", false
+}
+
+// latestArchiveRevision returns the ETag, else the Last-Modified date, of the archive r.URI.
+func (c *KfConfig) latestArchiveRevision(r Repo) (string, error) {
+	hclient, err := c.newArchiveClient(r)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("HEAD", r.URI, nil)
+	if err != nil {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("invalid URI %v: %v", r.URI, err),
+		}
+	}
+	req.Header.Set("User-Agent", "kfctl")
+	resp, err := hclient.Do(req)
+	if err != nil {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't check URI %v: %v", r.URI, err),
+		}
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't check URI %v: %v", r.URI, resp.Status),
+		}
+	}
+	meta := &archiveMeta{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	if meta.revision() == "" {
+		return "", &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("%v has neither an ETag nor a Last-Modified header", r.URI),
+		}
+	}
+	return meta.revision(), nil
+}
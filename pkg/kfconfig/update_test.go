@@ -0,0 +1,182 @@
+package kfconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLsRemoteRevision(t *testing.T) {
+	type testCase struct {
+		Name     string
+		Ref      string
+		Expected string
+	}
+	out := strings.Join([]string{
+		"1111111111111111111111111111111111111111\tHEAD",
+		"2222222222222222222222222222222222222222\trefs/heads/v1",
+		"3333333333333333333333333333333333333333\trefs/tags/v1",
+		"4444444444444444444444444444444444444444\trefs/tags/v2",
+		"5555555555555555555555555555555555555555\trefs/tags/v2^{}",
+	}, "\n")
+	testCases := []testCase{
+		{Name: "head", Ref: "HEAD", Expected: "1111111111111111111111111111111111111111"},
+		{Name: "branch-before-tag", Ref: "v1", Expected: "2222222222222222222222222222222222222222"},
+		{Name: "annotated-tag", Ref: "v2", Expected: "5555555555555555555555555555555555555555"},
+		{Name: "full-ref", Ref: "refs/tags/v1", Expected: "3333333333333333333333333333333333333333"},
+	}
+	for _, c := range testCases {
+		if revision, ok := lsRemoteRevision(out, c.Ref); !ok || revision != c.Expected {
+			t.Errorf("Case %v: expected %v; got %v", c.Name, c.Expected, revision)
+		}
+	}
+	if revision, ok := lsRemoteRevision("", "master"); ok {
+		t.Errorf("Expected no revision without refs; got %v", revision)
+	}
+	suffixOnly := "6666666666666666666666666666666666666666\trefs/heads/feature/v1"
+	if revision, ok := lsRemoteRevision(suffixOnly, "v1"); ok {
+		t.Errorf("Expected no revision for a ref only ending with v1; got %v", revision)
+	}
+}
+
+func TestLatestRevision(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+	bare, first, second := newTestGitRepo(t, testDir)
+
+	archiveServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/etag.tar.gz":
+			w.Header().Set("ETag", `"v2"`)
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2023 15:04:05 GMT")
+		case "/last-modified.tar.gz":
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2023 15:04:05 GMT")
+		case "/unversioned.tar.gz":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer archiveServer.Close()
+
+	registryServer, manifestDigest := newTestRegistry(t, map[string]string{
+		"kfdef/kustomization.yaml": "resources: []\n",
+	})
+	defer registryServer.Close()
+	registry := strings.TrimPrefix(registryServer.URL, "http://")
+	kubeClient := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "pull-secret", Namespace: "opendatahub"},
+		Type:       v1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{v1.DockerConfigJsonKey: []byte(
+			fmt.Sprintf(`{"auths": {"%v": {"username": "user", "password": "secret"}}}`, registry))},
+	})
+	defer func(f func() (kubernetes.Interface, error)) { newKubeClient = f }(newKubeClient)
+	newKubeClient = func() (kubernetes.Interface, error) {
+		return kubeClient, nil
+	}
+
+	type testCase struct {
+		Name     string
+		Repo     Repo
+		Expected string
+		Error    string
+	}
+	testCases := []testCase{
+		{
+			Name:     "git-default-branch",
+			Repo:     Repo{URI: GitPrefix + "file://" + bare},
+			Expected: second,
+		},
+		{
+			Name:     "git-branch",
+			Repo:     Repo{URI: GitPrefix + "file://" + bare + "?ref=master&depth=1"},
+			Expected: second,
+		},
+		{
+			Name:     "git-annotated-tag",
+			Repo:     Repo{URI: GitPrefix + "file://" + bare + "?ref=v1"},
+			Expected: first,
+		},
+		{
+			Name:  "git-missing-ref",
+			Repo:  Repo{URI: GitPrefix + "file://" + bare + "?ref=missing"},
+			Error: "has no ref missing",
+		},
+		{
+			Name:  "git-option-ref",
+			Repo:  Repo{URI: GitPrefix + "file://" + bare + "?ref=--upload-pack=touch%20" + testDir + "/pwned"},
+			Error: "doesn't point to",
+		},
+		{
+			Name:  "git-commit",
+			Repo:  Repo{Name: "manifests", URI: GitPrefix + "file://" + bare + "?ref=" + first},
+			Error: "repo manifests doesn't point to",
+		},
+		{
+			Name:     "oci-tag",
+			Repo:     Repo{URI: "oci://" + registry + "/manifests:latest", PullSecret: "pull-secret"},
+			Expected: manifestDigest,
+		},
+		{
+			Name:  "oci-digest",
+			Repo:  Repo{Name: "manifests", URI: "oci://" + registry + "/manifests@" + manifestDigest},
+			Error: "repo manifests doesn't point to",
+		},
+		{
+			Name:     "archive-etag",
+			Repo:     Repo{URI: archiveServer.URL + "/etag.tar.gz"},
+			Expected: `"v2"`,
+		},
+		{
+			Name:     "archive-last-modified",
+			Repo:     Repo{URI: archiveServer.URL + "/last-modified.tar.gz"},
+			Expected: "Mon, 02 Jan 2023 15:04:05 GMT",
+		},
+		{
+			Name:  "archive-unversioned",
+			Repo:  Repo{URI: archiveServer.URL + "/unversioned.tar.gz"},
+			Error: "has neither an ETag nor a Last-Modified header",
+		},
+		{
+			Name:  "archive-not-found",
+			Repo:  Repo{URI: archiveServer.URL + "/missing.tar.gz"},
+			Error: "404",
+		},
+		{
+			Name:  "archive-sha256",
+			Repo:  Repo{Name: "manifests", URI: archiveServer.URL + "/etag.tar.gz", SHA256: strings.Repeat("0", 64)},
+			Error: "repo manifests doesn't point to",
+		},
+		{
+			Name:  "local-dir",
+			Repo:  Repo{Name: "manifests", URI: testDir},
+			Error: "repo manifests doesn't point to",
+		},
+	}
+	for _, c := range testCases {
+		kfDef := &KfConfig{ObjectMeta: metav1.ObjectMeta{Name: "kfdef", Namespace: "opendatahub"}}
+		revision, err := kfDef.LatestRevision(c.Repo)
+		if c.Error != "" {
+			if err == nil || !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("Case %v: expected an error containing %q; got %v", c.Name, c.Error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case %v: failed to get the latest revision: %v", c.Name, err)
+		} else if revision != c.Expected {
+			t.Errorf("Case %v: expected revision %v; got %v", c.Name, c.Expected, revision)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package kfconfig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	kfapis "github.com/opendatahub-io/opendatahub-operator/apis"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// CosignFormat and MinisignFormat are the supported formats of repo signatures.
+	CosignFormat   = "cosign"
+	MinisignFormat = "minisign"
+)
+
+// maxSignedMessageSize is the maximum size of an archive verified with a signature over the
+// whole archive, ed25519 or legacy minisign, which has to be held in memory. It is a variable
+// so that tests can lower it.
+var maxSignedMessageSize int64 = 256 << 20
+
+// RepoVerificationError reports a repo archive not matching its sha256 or signature.
+type RepoVerificationError struct {
+	Repo   string
+	Reason string
+}
+
+func (e *RepoVerificationError) Error() string {
+	return fmt.Sprintf("repo %v failed verification: %v", e.Repo, e.Reason)
+}
+
+// IsRepoVerificationError returns true if err, or an error it wraps, is a RepoVerificationError.
+func IsRepoVerificationError(err error) bool {
+	var verificationErr *RepoVerificationError
+	return errors.As(err, &verificationErr)
+}
+
+// verificationFailed returns the error reporting that r failed verification. SyncCache sets
+// the RepoVerificationFailed condition from it.
+func verificationFailed(r Repo, format string, args ...interface{}) error {
+	err := &RepoVerificationError{Repo: r.Name, Reason: fmt.Sprintf(format, args...)}
+	return &kfapis.KfError{
+		Code:    int(kfapis.INVALID_ARGUMENT),
+		Message: err.Error(),
+		Err:     err,
+	}
+}
+
+// checkVerifiable returns an error if r has a sha256 or a signature, which only archives can be
+// verified against. It's called for the repos fetched as a tree of files, e.g. git clones.
+func checkVerifiable(r Repo) error {
+	if r.SHA256 == "" && r.Signature == nil {
+		return nil
+	}
+	return &kfapis.KfError{
+		Code:    int(kfapis.INVALID_ARGUMENT),
+		Message: fmt.Sprintf("repo %v has a sha256 or a signature but %v isn't an archive they could verify", r.Name, r.URI),
+	}
+}
+
+// verifyArchive checks archive against the sha256 digest and the detached signature of r.
+// The signature is downloaded with client. The archive is read once per check.
+func (c *KfConfig) verifyArchive(r Repo, archive io.ReadSeeker, client *http.Client) error {
+	if r.SHA256 != "" {
+		sum, err := readDigest(archive, sha256.New())
+		if err != nil {
+			return &kfapis.KfError{
+				Code:    int(kfapis.INTERNAL_ERROR),
+				Message: fmt.Sprintf("couldn't read archive of repo %v: %v", r.Name, err),
+			}
+		}
+		expected := strings.ToLower(strings.TrimPrefix(r.SHA256, "sha256:"))
+		if actual := hex.EncodeToString(sum); actual != expected {
+			return verificationFailed(r, "sha256 mismatch: expected %v; got %v", expected, actual)
+		}
+	}
+	if r.Signature == nil {
+		return nil
+	}
+
+	req, err := http.NewRequest("GET", r.Signature.URI, nil)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("invalid signature URI %v: %v", r.Signature.URI, err),
+		}
+	}
+	req.Header.Set("User-Agent", "kfctl")
+	resp, err := client.Do(req)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't download signature %v: %v", r.Signature.URI, err),
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't download signature %v: %v", r.Signature.URI, resp.Status),
+		}
+	}
+	signature, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INTERNAL_ERROR),
+			Message: fmt.Sprintf("couldn't read signature %v: %v", r.Signature.URI, err),
+		}
+	}
+	publicKey, err := c.getKey(r.Signature.PublicKey)
+	if err != nil {
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("couldn't get the public key of repo %v: %v", r.Name, err),
+		}
+	}
+
+	switch r.Signature.Format {
+	case "", CosignFormat:
+		err = verifyCosign(archive, signature, publicKey)
+	case MinisignFormat:
+		err = verifyMinisign(archive, signature, publicKey)
+	default:
+		return &kfapis.KfError{
+			Code:    int(kfapis.INVALID_ARGUMENT),
+			Message: fmt.Sprintf("unsupported signature format %v; expected %v or %v", r.Signature.Format, CosignFormat, MinisignFormat),
+		}
+	}
+	if err != nil {
+		return verificationFailed(r, "%v signature: %v", r.Signature.URI, err)
+	}
+	return nil
+}
+
+// getKey returns the value of the ConfigMap or Secret key ref.
+func (c *KfConfig) getKey(ref KeyReference) ([]byte, error) {
+	switch ref.Kind {
+	case "ConfigMap":
+		cm, err := c.getConfigMap(ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		if data, ok := cm.Data[ref.Key]; ok {
+			return []byte(data), nil
+		}
+		if data, ok := cm.BinaryData[ref.Key]; ok {
+			return data, nil
+		}
+	case "Secret":
+		secret, err := c.getSecret(ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		if data, ok := secret.Data[ref.Key]; ok {
+			return data, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported kind %v; expected ConfigMap or Secret", ref.Kind)
+	}
+	return nil, fmt.Errorf("%v %v has no key %v", ref.Kind, ref.Name, ref.Key)
+}
+
+// readDigest returns the digest of archive computed with h and rewinds archive.
+func readDigest(archive io.ReadSeeker, h hash.Hash) ([]byte, error) {
+	if _, err := io.Copy(h, archive); err != nil {
+		return nil, err
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// readAll returns the content of archive and rewinds it. Ed25519 signatures are computed over
+// the whole message so it has to be held in memory to be verified, up to maxSignedMessageSize.
+func readAll(archive io.ReadSeeker) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(archive, maxSignedMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSignedMessageSize {
+		return nil, fmt.Errorf("archive exceeds the limit of %v bytes of archives signed without a prehash; "+
+			"sign it with minisign -H or with an ECDSA or RSA key", maxSignedMessageSize)
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// verifyCosign verifies a base64 encoded signature as produced by cosign sign-blob with the
+// PEM encoded ECDSA, Ed25519 or RSA public key.
+func verifyCosign(archive io.ReadSeeker, signature []byte, publicKey []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("signature is not base64 encoded: %v", err)
+	}
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return fmt.Errorf("public key is not PEM encoded")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %v", err)
+	}
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		digest, err := readDigest(archive, sha256.New())
+		if err != nil {
+			return err
+		}
+		if !ecdsa.VerifyASN1(key, digest, sig) {
+			return fmt.Errorf("invalid signature")
+		}
+	case ed25519.PublicKey:
+		data, err := readAll(archive)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(key, data, sig) {
+			return fmt.Errorf("invalid signature")
+		}
+	case *rsa.PublicKey:
+		digest, err := readDigest(archive, sha256.New())
+		if err != nil {
+			return err
+		}
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig) != nil &&
+			rsa.VerifyPSS(key, crypto.SHA256, digest, sig, nil) != nil {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return nil
+}
+
+// minisignLines returns the lines of a minisign key or signature file, without the untrusted comment.
+func minisignLines(data []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// verifyMinisign verifies a minisign signature, legacy or prehashed, and its trusted comment.
+func verifyMinisign(archive io.ReadSeeker, signature []byte, publicKey []byte) error {
+	keyLines := minisignLines(publicKey)
+	if len(keyLines) == 0 {
+		return fmt.Errorf("public key is empty")
+	}
+	key, err := base64.StdEncoding.DecodeString(keyLines[0])
+	if err != nil || len(key) != 2+8+ed25519.PublicKeySize || string(key[:2]) != "Ed" {
+		return fmt.Errorf("invalid minisign public key")
+	}
+
+	sigLines := minisignLines(signature)
+	if len(sigLines) != 3 || !strings.HasPrefix(sigLines[1], "trusted comment: ") {
+		return fmt.Errorf("invalid minisign signature file")
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigLines[0])
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("invalid minisign signature")
+	}
+	if string(sig[2:10]) != string(key[2:10]) {
+		return fmt.Errorf("signature key id %X does not match public key id %X", sig[2:10], key[2:10])
+	}
+
+	var message []byte
+	switch string(sig[:2]) {
+	case "Ed":
+		message, err = readAll(archive)
+	case "ED":
+		h, _ := blake2b.New512(nil)
+		message, err = readDigest(archive, h)
+	default:
+		return fmt.Errorf("unsupported minisign signature algorithm %q", sig[:2])
+	}
+	if err != nil {
+		return err
+	}
+	pub := ed25519.PublicKey(key[10:])
+	if !ed25519.Verify(pub, message, sig[10:]) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	trustedComment := strings.TrimPrefix(sigLines[1], "trusted comment: ")
+	globalSig, err := base64.StdEncoding.DecodeString(sigLines[2])
+	if err != nil || !ed25519.Verify(pub, append(append([]byte{}, sig[10:]...), trustedComment...), globalSig) {
+		return fmt.Errorf("invalid trusted comment signature")
+	}
+	return nil
+}
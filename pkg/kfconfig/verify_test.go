@@ -0,0 +1,310 @@
+package kfconfig
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	kfapis "github.com/opendatahub-io/opendatahub-operator/apis"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func pemPublicKey(t *testing.T, pub crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestVerifyCosign(t *testing.T) {
+	archive := []byte("manifests")
+	digest := sha256.Sum256(archive)
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecSig, _ := ecdsa.SignASN1(rand.Reader, ecKey, digest[:])
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaSig, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+
+	type testCase struct {
+		Name      string
+		Archive   []byte
+		Signature []byte
+		PublicKey []byte
+		Error     string
+	}
+	testCases := []testCase{
+		{
+			Name:      "ecdsa",
+			Archive:   archive,
+			Signature: ecSig,
+			PublicKey: pemPublicKey(t, &ecKey.PublicKey),
+		},
+		{
+			Name:      "ed25519",
+			Archive:   archive,
+			Signature: ed25519.Sign(edKey, archive),
+			PublicKey: pemPublicKey(t, edPub),
+		},
+		{
+			Name:      "rsa",
+			Archive:   archive,
+			Signature: rsaSig,
+			PublicKey: pemPublicKey(t, &rsaKey.PublicKey),
+		},
+		{
+			Name:      "tampered",
+			Archive:   []byte("tampered"),
+			Signature: ecSig,
+			PublicKey: pemPublicKey(t, &ecKey.PublicKey),
+			Error:     "invalid signature",
+		},
+		{
+			Name:      "wrong-key",
+			Archive:   archive,
+			Signature: rsaSig,
+			PublicKey: pemPublicKey(t, &ecKey.PublicKey),
+			Error:     "invalid signature",
+		},
+	}
+	for _, c := range testCases {
+		signature := []byte(base64.StdEncoding.EncodeToString(c.Signature) + "\n")
+		err := verifyCosign(bytes.NewReader(c.Archive), signature, c.PublicKey)
+		if c.Error == "" && err != nil {
+			t.Errorf("Case %v: failed to verify: %v", c.Name, err)
+		}
+		if c.Error != "" && (err == nil || !strings.Contains(err.Error(), c.Error)) {
+			t.Errorf("Case %v: expected error containing %v; got %v", c.Name, c.Error, err)
+		}
+	}
+
+	// Ed25519 signatures are verified over the whole archive, held in memory up to a limit.
+	defer func(n int64) { maxSignedMessageSize = n }(maxSignedMessageSize)
+	maxSignedMessageSize = int64(len(archive)) - 1
+	signature := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(edKey, archive)))
+	if err := verifyCosign(bytes.NewReader(archive), signature, pemPublicKey(t, edPub)); err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Errorf("Expected an ed25519 signed archive over the size limit to be rejected; got %v", err)
+	}
+	signature = []byte(base64.StdEncoding.EncodeToString(ecSig))
+	if err := verifyCosign(bytes.NewReader(archive), signature, pemPublicKey(t, &ecKey.PublicKey)); err != nil {
+		t.Errorf("Expected an ecdsa signed archive over the size limit to be streamed; got %v", err)
+	}
+}
+
+func TestIsRepoVerificationError(t *testing.T) {
+	err := verificationFailed(Repo{Name: "manifests"}, "sha256 mismatch")
+	wrapped := &kfapis.KfError{Code: int(kfapis.INTERNAL_ERROR), Message: fmt.Sprintf("could not sync cache. Error: %v", err), Err: err}
+	if !IsRepoVerificationError(err) || !IsRepoVerificationError(errors.WithStack(wrapped)) {
+		t.Errorf("Expected %v to be a verification error", wrapped)
+	}
+	if IsRepoVerificationError(fmt.Errorf("repo manifests failed verification")) || IsRepoVerificationError(nil) {
+		t.Errorf("Expected errors only mentioning verification not to be verification errors")
+	}
+}
+
+// minisign returns a minisign public key file and a prehashed signature file of archive.
+func minisign(t *testing.T, archive []byte, trustedComment string) ([]byte, []byte) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	keyID := []byte("01234567")
+	key := append(append([]byte("Ed"), keyID...), pub...)
+	hash := blake2b.Sum512(archive)
+	sig := ed25519.Sign(priv, hash[:])
+	globalSig := ed25519.Sign(priv, append(append([]byte{}, sig...), trustedComment...))
+
+	publicKey := fmt.Sprintf("untrusted comment: minisign public key\n%v\n", base64.StdEncoding.EncodeToString(key))
+	signature := fmt.Sprintf("untrusted comment: signature from minisign secret key\n%v\ntrusted comment: %v\n%v\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte("ED"), keyID...), sig...)),
+		trustedComment,
+		base64.StdEncoding.EncodeToString(globalSig))
+	return []byte(publicKey), []byte(signature)
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	archive := []byte("manifests")
+	publicKey, signature := minisign(t, archive, "timestamp:1666000000")
+
+	if err := verifyMinisign(bytes.NewReader(archive), signature, publicKey); err != nil {
+		t.Errorf("Failed to verify: %v", err)
+	}
+	if err := verifyMinisign(bytes.NewReader([]byte("tampered")), signature, publicKey); err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Errorf("Expected an invalid signature error for a tampered archive; got %v", err)
+	}
+	tampered := []byte(strings.Replace(string(signature), "timestamp:1666000000", "timestamp:1766000000", 1))
+	if err := verifyMinisign(bytes.NewReader(archive), tampered, publicKey); err == nil || !strings.Contains(err.Error(), "invalid trusted comment signature") {
+		t.Errorf("Expected an invalid trusted comment error; got %v", err)
+	}
+	otherKey, _ := minisign(t, archive, "")
+	if err := verifyMinisign(bytes.NewReader(archive), signature, otherKey); err == nil {
+		t.Errorf("Expected an error verifying with another key")
+	}
+}
+
+func TestSyncCacheVerification(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "manifests-v1/", Mode: 0755, Typeflag: tar.TypeDir})
+	tw.WriteHeader(&tar.Header{Name: "manifests-v1/version", Mode: 0644, Size: 3, Typeflag: tar.TypeReg})
+	tw.Write([]byte("v1\n"))
+	tw.Close()
+	gz.Close()
+	archive := buf.Bytes()
+	archivePath := path.Join(testDir, "manifests.tar.gz")
+	ioutil.WriteFile(archivePath, archive, 0644)
+	sum := sha256.Sum256(archive)
+
+	publicKey, signature := minisign(t, archive, "manifests v1")
+	ioutil.WriteFile(path.Join(testDir, "manifests.tar.gz.minisig"), signature, 0644)
+	otherKey, _ := minisign(t, archive, "")
+
+	kubeClient := fake.NewSimpleClientset(
+		&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "release-keys", Namespace: "opendatahub"},
+			Data: map[string]string{
+				"minisign.pub": string(publicKey),
+				"other.pub":    string(otherKey),
+			},
+		},
+	)
+	defer func(f func() (kubernetes.Interface, error)) { newKubeClient = f }(newKubeClient)
+	newKubeClient = func() (kubernetes.Interface, error) {
+		return kubeClient, nil
+	}
+
+	signatureFor := func(key string) *RepoSignature {
+		return &RepoSignature{
+			URI:       "file:" + path.Join(testDir, "manifests.tar.gz.minisig"),
+			Format:    MinisignFormat,
+			PublicKey: KeyReference{Kind: "ConfigMap", Name: "release-keys", Key: key},
+		}
+	}
+
+	type testCase struct {
+		Name               string
+		Repo               Repo
+		VerificationFailed bool
+	}
+	testCases := []testCase{
+		{
+			Name: "verified",
+			Repo: Repo{SHA256: fmt.Sprintf("%x", sum), Signature: signatureFor("minisign.pub")},
+		},
+		{
+			Name:               "sha256-mismatch",
+			Repo:               Repo{SHA256: strings.Repeat("0", 64)},
+			VerificationFailed: true,
+		},
+		{
+			Name:               "signature-mismatch",
+			Repo:               Repo{SHA256: fmt.Sprintf("%x", sum), Signature: signatureFor("other.pub")},
+			VerificationFailed: true,
+		},
+	}
+	for _, c := range testCases {
+		c.Repo.Name = "manifests"
+		c.Repo.URI = "file:" + archivePath
+		kfDef := &KfConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "opendatahub", Namespace: "opendatahub"},
+			Spec: KfConfigSpec{
+				AppDir: path.Join(testDir, c.Name),
+				Repos:  []Repo{c.Repo},
+			},
+		}
+		err := kfDef.SyncCache()
+		if !c.VerificationFailed {
+			if err != nil {
+				t.Fatalf("Case %v: failed to sync cache: %v", c.Name, err)
+			}
+			cacheDir := path.Join(testDir, c.Name, DefaultCacheDir, "manifests")
+			if _, err := os.Stat(path.Join(cacheDir, "manifests-v1", "version")); err != nil {
+				t.Errorf("Case %v: archive was not unpacked: %v", c.Name, err)
+			}
+			continue
+		}
+		if !IsRepoVerificationError(err) {
+			t.Errorf("Case %v: expected a verification error; got %v", c.Name, err)
+		}
+		if cond, err := kfDef.GetCondition(RepoVerificationFailed); err != nil || cond.Status != v1.ConditionTrue {
+			t.Errorf("Case %v: expected condition %v to be set; got %v", c.Name, RepoVerificationFailed, err)
+		}
+		files, _ := ioutil.ReadDir(path.Join(testDir, c.Name, DefaultCacheDir, "manifests"))
+		if len(files) != 0 {
+			t.Errorf("Case %v: archive was unpacked despite failing verification", c.Name)
+		}
+	}
+}
+
+func TestSyncCacheUnverifiable(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+	manifestsDir := path.Join(testDir, "manifests")
+	defer func(dir string) { pvcMountDir = dir }(pvcMountDir)
+	pvcMountDir = path.Join(testDir, "mnt")
+	for _, dir := range []string{manifestsDir, path.Join(pvcMountDir, "opendatahub", "manifests", "odh-manifests")} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatalf("Failed to create %v: %v", dir, err)
+		}
+	}
+
+	type testCase struct {
+		Name string
+		URI  string
+		Repo Repo
+	}
+	testCases := []testCase{
+		{Name: "git", URI: "git::https://github.com/opendatahub-io/odh-manifests.git?ref=v1.0.0", Repo: Repo{SHA256: strings.Repeat("0", 64)}},
+		{Name: "oci", URI: "oci://quay.io/opendatahub/manifests:v1.0.0", Repo: Repo{Signature: &RepoSignature{URI: "https://example.com/manifests.sig"}}},
+		{Name: "directory", URI: manifestsDir, Repo: Repo{SHA256: strings.Repeat("0", 64)}},
+		{Name: "pvc-directory", URI: "pvc://opendatahub/manifests/odh-manifests", Repo: Repo{SHA256: strings.Repeat("0", 64)}},
+	}
+	for _, c := range testCases {
+		c.Repo.Name = "manifests"
+		c.Repo.URI = c.URI
+		kfDef := &KfConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "opendatahub", Namespace: "opendatahub"},
+			Spec: KfConfigSpec{
+				AppDir: path.Join(testDir, c.Name),
+				Repos:  []Repo{c.Repo},
+			},
+		}
+		err := kfDef.SyncCache()
+		var kfErr *kfapis.KfError
+		if !errors.As(err, &kfErr) || kfErr.Code != int(kfapis.INVALID_ARGUMENT) || !strings.Contains(err.Error(), "isn't an archive") {
+			t.Errorf("Case %v: expected an invalid argument error; got %v", c.Name, err)
+		}
+	}
+}
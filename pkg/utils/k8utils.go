@@ -68,6 +68,7 @@ const (
 	SetAnnotation              = "set-kubeflow-annotation"
 	KfDefInstance              = "kfdef-instance"
 	InstallByOperator          = "install-by-operator"
+	ConvertDeploymentConfigs   = "convert-deploymentconfigs"
 )
 
 func generateRandStr(length int) string {